@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"net/http"
 	neturl "net/url"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -18,7 +20,8 @@ type httpCacher struct {
 	logger *logrus.Logger
 	mutex  sync.Mutex
 
-	path string
+	path   string
+	tmpSeq uint64
 
 	defaultTTL time.Duration
 }
@@ -134,16 +137,16 @@ func (c *httpCacher) Write(input *Input) error {
 	c.mutex.Unlock()
 
 	cachePath := c.generateCachePath(input.URL)
-	f, err := CreateFile(fs, cachePath)
+	err := c.writeFile(fs, cachePath, func(f File) error {
+		if writeError := WriteHTTP(f, input); writeError != nil {
+			return fmt.Errorf("WriteHTTP: %w", writeError)
+		}
+
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	defer func() { _ = f.Close() }()
-
-	writeError := WriteHTTP(f, input)
-	if writeError != nil {
-		return fmt.Errorf("WriteHTTP: %s", writeError)
-	}
 
 	c.logger.WithFields(logrus.Fields{
 		"url":  input.URL,
@@ -153,6 +156,82 @@ func (c *httpCacher) Write(input *Input) error {
 	return nil
 }
 
+// writeFile writes to a temporary file first then renames it over the cache path
+// so that readers never see a partial entry and the existing one is kept intact if writing fails
+func (c *httpCacher) writeFile(fs Fs, cachePath string, write func(File) error) error {
+	tmpPath := fmt.Sprintf("%s.%d.tmp", cachePath, atomic.AddUint64(&c.tmpSeq, 1))
+	f, err := CreateFile(fs, tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writeError := write(f)
+	closeError := f.Close()
+	if writeError == nil && closeError != nil {
+		writeError = fmt.Errorf("f.Close: %w", closeError)
+	}
+	if writeError != nil {
+		_ = fs.RemoveAll(tmpPath)
+		return writeError
+	}
+
+	renameError := fs.Rename(tmpPath, cachePath)
+	if renameError != nil {
+		_ = fs.RemoveAll(tmpPath)
+		return fmt.Errorf("fs.Rename: %w", renameError)
+	}
+
+	return nil
+}
+
+// rewriteHeader replaces the header block of the cache file with the one returned by update,
+// the body is streamed to the new file without being loaded in memory.
+// It returns false without writing anything if update returns nil.
+func (c *httpCacher) rewriteHeader(fs Fs, cachePath string, update func([]byte) ([]byte, error)) (bool, error) {
+	f, openError := fs.OpenFile(cachePath, os.O_RDONLY, 0)
+	if openError != nil {
+		return false, openError
+	}
+	defer func() { _ = f.Close() }()
+
+	br := bufio.NewReader(f)
+	var header []byte
+	for {
+		line, readError := br.ReadBytes('\n')
+		if readError != nil {
+			return false, fmt.Errorf("br.ReadBytes: %w", readError)
+		}
+
+		firstLine := len(header) == 0
+		header = append(header, line...)
+		if !firstLine && len(line) == 1 {
+			// reached the empty line after header
+			break
+		}
+	}
+
+	updated, updateError := update(header)
+	if updateError != nil {
+		return false, updateError
+	}
+	if updated == nil {
+		return false, nil
+	}
+
+	writeError := c.writeFile(fs, cachePath, func(w File) error {
+		if _, err := w.Write(updated); err != nil {
+			return fmt.Errorf("w.Write: %w", err)
+		}
+		if _, err := io.Copy(w, br); err != nil {
+			return fmt.Errorf("io.Copy: %w", err)
+		}
+
+		return nil
+	})
+
+	return writeError == nil, writeError
+}
+
 func (c *httpCacher) Bump(url *neturl.URL, ttl time.Duration) error {
 	c.mutex.Lock()
 	fs := c.fs
@@ -227,6 +306,82 @@ func (c *httpCacher) Bump(url *neturl.URL, ttl time.Duration) error {
 	return writeError
 }
 
+func (c *httpCacher) Revalidate(url *neturl.URL, header http.Header, ttl time.Duration) error {
+	c.mutex.Lock()
+	fs := c.fs
+	c.mutex.Unlock()
+
+	cachePath := c.generateCachePath(url)
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	// validators are only updated if the not modified response includes them
+	updates := make(http.Header)
+	if etag := header.Get(HeaderETag); len(etag) > 0 {
+		updates.Set(HeaderETag, etag)
+	}
+	if lastModified, err := http.ParseTime(header.Get(HeaderLastModified)); err == nil {
+		updates.Set(HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+		updates.Set(CustomHeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+	updates.Set(HeaderCacheControl, fmt.Sprintf("public, max-age=%d", expires.Unix()-now.Unix()))
+	updates.Set(HeaderExpires, expires.UTC().Format(http.TimeFormat))
+	updates.Set(CustomHeaderExpires, fmt.Sprintf("%020d", expires.UnixNano()))
+	updates.Set(CustomHeaderFetched, fmt.Sprintf("%020d", now.UnixNano()))
+
+	_, rewriteError := c.rewriteHeader(fs, cachePath, func(header []byte) ([]byte, error) {
+		updated, updateError := updateHTTPHeader(header, updates)
+		if updateError != nil {
+			return nil, fmt.Errorf("updateHTTPHeader: %w", updateError)
+		}
+
+		return updated, nil
+	})
+	if rewriteError != nil {
+		return rewriteError
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"url":  url,
+		"path": cachePath,
+		"time": expires,
+	}).Info("Revalidated")
+
+	return nil
+}
+
+func (c *httpCacher) SetStale(url *neturl.URL, stale bool) error {
+	c.mutex.Lock()
+	fs := c.fs
+	c.mutex.Unlock()
+
+	cachePath := c.generateCachePath(url)
+	now := time.Now()
+	rewritten, rewriteError := c.rewriteHeader(fs, cachePath, func(header []byte) ([]byte, error) {
+		updated, updateError := updateHTTPStaleHeader(header, stale, now)
+		if updateError != nil {
+			return nil, fmt.Errorf("updateHTTPStaleHeader: %w", updateError)
+		}
+
+		return updated, nil
+	})
+	if rewriteError != nil {
+		return rewriteError
+	}
+	if !rewritten {
+		// nothing to change
+		return nil
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"url":   url,
+		"path":  cachePath,
+		"stale": stale,
+	}).Info("Updated cache staleness")
+
+	return nil
+}
+
 func (c *httpCacher) WritePlaceholder(url *neturl.URL, ttl time.Duration) error {
 	c.mutex.Lock()
 	fs := c.fs
@@ -270,6 +425,21 @@ func (c *httpCacher) Open(url *neturl.URL) (io.ReadCloser, error) {
 	return f, err
 }
 
+func (c *httpCacher) GetInfo(url *neturl.URL) (*Info, error) {
+	c.mutex.Lock()
+	fs := c.fs
+	c.mutex.Unlock()
+
+	cachePath := c.generateCachePath(url)
+	f, err := fs.OpenFile(cachePath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return ReadHTTPInfo(f)
+}
+
 func (c *httpCacher) generateCachePath(url *neturl.URL) string {
 	c.mutex.Lock()
 	path := c.path
@@ -1,13 +1,17 @@
 package cacher_test
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"regexp"
 	"strconv"
+	"strings"
+	"testing/iotest"
 	"time"
 
 	. "github.com/daohoangson/go-sitemirror/cacher"
@@ -167,6 +171,82 @@ var _ = Describe("HttpCacher", func() {
 			Expect(readError).To(HaveOccurred())
 		})
 
+		It("should write body reader", func() {
+			url, _ := url.Parse("https://domain.com/http/cacher/write/body/reader")
+			input := &Input{URL: url, StatusCode: 200, BodyReader: strings.NewReader("foo")}
+			cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+			c := newHttpCacherWithRootPath()
+			writeError := c.Write(input)
+			Expect(writeError).ToNot(HaveOccurred())
+
+			written, _ := os.ReadFile(cachePath)
+			writtenString := string(written)
+			contentLength, _ := strconv.ParseInt(getHeaderValue(writtenString, HeaderContentLength), 10, 64)
+			Expect(contentLength).To(Equal(int64(3)))
+			Expect(getContent(writtenString)).To(Equal("foo"))
+		})
+
+		It("should keep existing entry while writing body reader", func() {
+			url, _ := url.Parse("https://domain.com/http/cacher/write/body/reader/in/progress")
+			cachePath := GenerateHTTPCachePath(rootPath, url)
+
+			c := newHttpCacherWithRootPath()
+			_ = c.Write(&Input{URL: url, StatusCode: 200, Body: "foo"})
+
+			pr, pw := io.Pipe()
+			ch := make(chan error)
+			go func() {
+				ch <- c.Write(&Input{URL: url, StatusCode: 200, BodyReader: pr})
+			}()
+
+			_, _ = pw.Write([]byte("bar"))
+			written, _ := os.ReadFile(cachePath)
+			Expect(getContent(string(written))).To(Equal("foo"))
+
+			_ = pw.Close()
+			Expect(<-ch).ToNot(HaveOccurred())
+			written, _ = os.ReadFile(cachePath)
+			Expect(getContent(string(written))).To(Equal("bar"))
+		})
+
+		It("should not write (body reader error)", func() {
+			url, _ := url.Parse("https://domain.com/http/cacher/write/body/reader/error")
+			bodyReader := io.MultiReader(strings.NewReader("foo"), iotest.ErrReader(errors.New("bar")))
+			input := &Input{URL: url, StatusCode: 200, BodyReader: bodyReader}
+			cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+			c := newHttpCacherWithRootPath()
+			writeError := c.Write(input)
+			Expect(writeError).To(HaveOccurred())
+
+			_, readError := os.ReadFile(cachePath)
+			Expect(readError).To(HaveOccurred())
+
+			entries, _ := os.ReadDir(path.Dir(cachePath))
+			Expect(entries).To(BeEmpty())
+		})
+
+		It("should keep existing entry (body reader error)", func() {
+			url, _ := url.Parse("https://domain.com/http/cacher/write/body/reader/error/existing")
+			cachePath := GenerateHTTPCachePath(rootPath, url)
+
+			c := newHttpCacherWithRootPath()
+			_ = c.Write(&Input{URL: url, StatusCode: 200, Body: "foo"})
+			existing, _ := os.ReadFile(cachePath)
+
+			bodyReader := io.MultiReader(strings.NewReader("bar"), iotest.ErrReader(errors.New("bar")))
+			writeError := c.Write(&Input{URL: url, StatusCode: 200, BodyReader: bodyReader})
+			Expect(writeError).To(HaveOccurred())
+
+			written, _ := os.ReadFile(cachePath)
+			Expect(string(written)).To(Equal(string(existing)))
+			Expect(getContent(string(written))).To(Equal("foo"))
+
+			entries, _ := os.ReadDir(path.Dir(cachePath))
+			Expect(entries).To(HaveLen(1))
+		})
+
 		Describe("Bump", func() {
 			It("should bump", func() {
 				url, _ := url.Parse("https://domain.com/http/cacher/bump")
@@ -247,6 +327,172 @@ var _ = Describe("HttpCacher", func() {
 			})
 		})
 
+		Describe("Revalidate", func() {
+			It("should merge validators", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/revalidate")
+				header := make(http.Header)
+				header.Set(HeaderETag, `"v1"`)
+				header.Set(HeaderLastModified, "Mon, 02 Jan 2006 15:04:05 GMT")
+				header.Set("X-Foo", "bar")
+				input := &Input{URL: url, StatusCode: 200, Header: header, Body: "Hello World."}
+				cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+				c := newHttpCacherWithRootPath()
+				_ = c.Write(input)
+				written, _ := c.GetInfo(url)
+				Expect(written.Fetched).ToNot(BeNil())
+
+				notModified := make(http.Header)
+				notModified.Set(HeaderETag, `"v2"`)
+				notModified.Set(HeaderLastModified, "Tue, 03 Jan 2006 15:04:05 GMT")
+				Expect(c.Revalidate(url, notModified, time.Hour)).To(Succeed())
+
+				revalidated, _ := os.ReadFile(cachePath)
+				revalidatedString := string(revalidated)
+				Expect(getHeaderValue(revalidatedString, http.CanonicalHeaderKey(HeaderETag))).To(Equal(`"v2"`))
+				Expect(getHeaderValue(revalidatedString, HeaderLastModified)).To(Equal("Tue, 03 Jan 2006 15:04:05 GMT"))
+				Expect(getHeaderValue(revalidatedString, CustomHeaderLastModified)).To(Equal("Tue, 03 Jan 2006 15:04:05 GMT"))
+				Expect(getHeaderValue(revalidatedString, "X-Foo")).To(Equal("bar"))
+				Expect(strings.Count(revalidatedString, "\n"+http.CanonicalHeaderKey(HeaderETag)+":")).To(Equal(1))
+				Expect(revalidatedString).To(HaveSuffix("\n\nHello World."))
+
+				info, _ := c.GetInfo(url)
+				Expect(info.Expires.After(time.Now().Add(59 * time.Minute))).To(BeTrue())
+				Expect(info.Fetched.After(*written.Fetched)).To(BeTrue())
+				expires, _ := http.ParseTime(info.Header.Get(HeaderExpires))
+				Expect(expires.After(time.Now().Add(59 * time.Minute))).To(BeTrue())
+			})
+
+			It("should keep validators", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/revalidate/keep")
+				header := make(http.Header)
+				header.Set(HeaderETag, `"v1"`)
+				input := &Input{URL: url, StatusCode: 200, Header: header, Body: "Hello World."}
+				cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+				c := newHttpCacherWithRootPath()
+				_ = c.Write(input)
+
+				Expect(c.Revalidate(url, make(http.Header), time.Hour)).To(Succeed())
+
+				revalidated, _ := os.ReadFile(cachePath)
+				Expect(getHeaderValue(string(revalidated), http.CanonicalHeaderKey(HeaderETag))).To(Equal(`"v1"`))
+				Expect(string(revalidated)).ToNot(ContainSubstring(CustomHeaderLastModified))
+			})
+
+			It("should keep streamed body", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/revalidate/stream")
+				body := strings.Repeat("Hello World.\n", 10000)
+				input := &Input{URL: url, StatusCode: 200, BodyReader: strings.NewReader(body)}
+				cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+				c := newHttpCacherWithRootPath()
+				Expect(c.Write(input)).To(Succeed())
+
+				notModified := make(http.Header)
+				notModified.Set(HeaderETag, `"v2"`)
+				Expect(c.Revalidate(url, notModified, time.Hour)).To(Succeed())
+
+				revalidated, _ := os.ReadFile(cachePath)
+				revalidatedString := string(revalidated)
+				Expect(getHeaderValue(revalidatedString, http.CanonicalHeaderKey(HeaderETag))).To(Equal(`"v2"`))
+				Expect(getHeaderValue(revalidatedString, HeaderContentLength)).To(Equal(fmt.Sprintf("%020d", len(body))))
+				Expect(revalidatedString).To(HaveSuffix("\n\n" + body))
+			})
+
+			It("should handle placeholder", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/revalidate/placeholder")
+				c := newHttpCacherWithRootPath()
+				_ = c.WritePlaceholder(url, time.Minute)
+
+				Expect(c.Revalidate(url, make(http.Header), time.Hour)).ToNot(Succeed())
+				expectPlaceholder(url)
+			})
+		})
+
+		Describe("SetStale", func() {
+			It("should add and remove stale header", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/stale")
+				input := &Input{URL: url, StatusCode: 200, Body: "Hello World."}
+				cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+				c := newHttpCacherWithRootPath()
+				_ = c.Write(input)
+				written, _ := os.ReadFile(cachePath)
+				writtenString := string(written)
+
+				Expect(c.SetStale(url, true)).To(Succeed())
+				stale, _ := os.ReadFile(cachePath)
+				staleString := string(stale)
+				staleValue := getHeaderValue(staleString, CustomHeaderStale)
+				Expect(staleValue).ToNot(BeEmpty())
+				Expect(staleString).To(HaveSuffix("\n\nHello World."))
+
+				Expect(c.SetStale(url, true)).To(Succeed())
+				stale, _ = os.ReadFile(cachePath)
+				Expect(getHeaderValue(string(stale), CustomHeaderStale)).To(Equal(staleValue))
+
+				info, _ := c.GetInfo(url)
+				Expect(info.StatusCode).To(Equal(200))
+				Expect(info.Header.Get(CustomHeaderStale)).To(Equal(staleValue))
+
+				Expect(c.SetStale(url, false)).To(Succeed())
+				fresh, _ := os.ReadFile(cachePath)
+				Expect(string(fresh)).To(Equal(writtenString))
+			})
+
+			It("should keep streamed body", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/stale/stream")
+				body := strings.Repeat("Hello World.\n", 10000)
+				input := &Input{URL: url, StatusCode: 200, BodyReader: strings.NewReader(body)}
+				cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+				c := newHttpCacherWithRootPath()
+				Expect(c.Write(input)).To(Succeed())
+
+				Expect(c.SetStale(url, true)).To(Succeed())
+				stale, _ := os.ReadFile(cachePath)
+				staleString := string(stale)
+				Expect(getHeaderValue(staleString, CustomHeaderStale)).ToNot(BeEmpty())
+				Expect(staleString).To(HaveSuffix("\n\n" + body))
+
+				entries, _ := os.ReadDir(path.Dir(cachePath))
+				for _, entry := range entries {
+					Expect(entry.Name()).ToNot(HaveSuffix(".tmp"))
+				}
+			})
+
+			It("should not change file without stale header", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/stale/no/header")
+				input := &Input{URL: url, StatusCode: 200, Body: "Hello World."}
+				cachePath := GenerateHTTPCachePath(rootPath, input.URL)
+
+				c := newHttpCacherWithRootPath()
+				_ = c.Write(input)
+				written, _ := os.ReadFile(cachePath)
+
+				Expect(c.SetStale(url, false)).To(Succeed())
+				fresh, _ := os.ReadFile(cachePath)
+				Expect(fresh).To(Equal(written))
+			})
+
+			It("should handle no file", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/stale/no/file")
+				c := newHttpCacherWithRootPath()
+
+				Expect(c.SetStale(url, true)).ToNot(Succeed())
+			})
+
+			It("should handle placeholder", func() {
+				url, _ := url.Parse("https://domain.com/http/cacher/stale/placeholder")
+				c := newHttpCacherWithRootPath()
+				_ = c.WritePlaceholder(url, time.Minute)
+
+				Expect(c.SetStale(url, true)).ToNot(Succeed())
+				expectPlaceholder(url)
+			})
+		})
+
 		Describe("WritePlaceholder", func() {
 			It("should write", func() {
 				url, _ := url.Parse("https://domain.com/http/cacher/write/placeholder")
@@ -274,6 +520,28 @@ var _ = Describe("HttpCacher", func() {
 		})
 	})
 
+	Describe("GetInfo", func() {
+		It("should get info", func() {
+			url, _ := url.Parse("https://domain.com/cacher/get/info")
+			c := newHttpCacherWithRootPath()
+			_ = c.Write(&Input{URL: url, StatusCode: http.StatusOK, Body: "foo/bar"})
+
+			info, err := c.GetInfo(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.StatusCode).To(Equal(http.StatusOK))
+			Expect(info.Header.Get(CustomHeaderURL)).To(Equal(url.String()))
+			Expect(info.Expires).ToNot(BeNil())
+		})
+
+		It("should not get info (no file)", func() {
+			url, _ := url.Parse("https://domain.com/cacher/get/info/no/file")
+			c := newHttpCacherWithRootPath()
+
+			_, err := c.GetInfo(url)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("Open", func() {
 		It("should open without error", func() {
 			url, _ := url.Parse("https://domain.com/cacher/delete/ok")
@@ -23,8 +23,11 @@ type Cacher interface {
 	CheckCacheExists(*url.URL) bool
 	Write(*Input) error
 	Bump(*url.URL, time.Duration) error
+	Revalidate(*url.URL, http.Header, time.Duration) error
+	SetStale(*url.URL, bool) error
 	WritePlaceholder(*url.URL, time.Duration) error
 	Open(*url.URL) (io.ReadCloser, error)
+	GetInfo(*url.URL) (*Info, error)
 }
 
 // Input struct to be used with cacher func
@@ -35,6 +38,19 @@ type Input struct {
 
 	Body   string
 	Header http.Header
+
+	// BodyReader is used instead of .Body if specified,
+	// the data is streamed without being buffered in memory.
+	BodyReader io.Reader
+}
+
+// Info represents metadata of cached data
+type Info struct {
+	StatusCode int
+	Expires    *time.Time
+	Fetched    *time.Time
+
+	Header http.Header
 }
 
 // Fs represents file system with funcs to manipulate directories and files
@@ -43,6 +59,7 @@ type Fs interface {
 	MkdirAll(string, os.FileMode) error
 	OpenFile(string, int, os.FileMode) (File, error)
 	RemoveAll(string) error
+	Rename(string, string) error
 }
 
 // File represents a file, similar to *os.File
@@ -71,21 +88,44 @@ const (
 	CustomHeaderCrossHostRef = "X-Mirror-Cross-Host-Ref"
 	// CustomHeaderExpires header key for cache expire time in nanosecond
 	CustomHeaderExpires = "X-Mirror-Expires"
+	// CustomHeaderLastModified header key for the last modified value sent by the origin,
+	// it is kept separately because Last-Modified falls back to the cache write time
+	CustomHeaderLastModified = "X-Mirror-Last-Modified"
+	// CustomHeaderFetched header key for the time in nanosecond of the last successful fetch,
+	// it is not updated by bumps so it can be used to limit staleness
+	CustomHeaderFetched = "X-Mirror-Fetched"
+	// CustomHeaderStale header key for the time in nanosecond since the cached data
+	// has been kept after a failed refresh
+	CustomHeaderStale = "X-Mirror-Stale"
 )
 
 const (
 	// HeaderCacheControl http cache control header key
 	HeaderCacheControl = "Cache-Control"
+	// HeaderAcceptEncoding http accept encoding request header key
+	HeaderAcceptEncoding = "Accept-Encoding"
+	// HeaderContentEncoding http content encoding header key
+	HeaderContentEncoding = "Content-Encoding"
 	// HeaderContentLength http content length header key
 	HeaderContentLength = "Content-Length"
 	// HeaderContentType http content type header key
 	HeaderContentType = "Content-Type"
+	// HeaderETag http entity tag header key
+	HeaderETag = "ETag"
 	// HeaderExpires http expires header key
 	HeaderExpires = "Expires"
+	// HeaderIfModifiedSince http conditional request header key for last modified
+	HeaderIfModifiedSince = "If-Modified-Since"
+	// HeaderIfNoneMatch http conditional request header key for entity tag
+	HeaderIfNoneMatch = "If-None-Match"
 	// HeaderLastModified http last modified header key
 	HeaderLastModified = "Last-Modified"
 	// HeaderLocation http location header key
 	HeaderLocation = "Location"
+	// HeaderRetryAfter http retry after header key
+	HeaderRetryAfter = "Retry-After"
+	// HeaderWarning http warning header key
+	HeaderWarning = "Warning"
 )
 
 const (
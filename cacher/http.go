@@ -2,23 +2,85 @@ package cacher
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"time"
 )
 
 var (
+	readHTTPInfoStatusCodeRegexp        = regexp.MustCompile(`^HTTP (\d+)\n$`)
+	readHTTPInfoHeaderRegexp            = regexp.MustCompile(`^([^:]+): (.*)\n$`)
 	writeHTTPCachingHeadersMaxAgeRegexp = regexp.MustCompile(`max-age\s*=\s*(\d+)(\s|$)`)
 	writeHTTPPlaceholderFirstLine       = fmt.Sprintf("HTTP %d\n", http.StatusNoContent)
 )
 
+// ReadHTTPInfo reads status code and headers from cache data in http format.
+// Internal headers are kept as is, the body is not read.
+func ReadHTTPInfo(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+
+	firstLine, firstLineError := br.ReadString('\n')
+	if firstLineError != nil {
+		return nil, fmt.Errorf("br.ReadString(StatusCode): %w", firstLineError)
+	}
+
+	statusCodeMatches := readHTTPInfoStatusCodeRegexp.FindStringSubmatch(firstLine)
+	if statusCodeMatches == nil {
+		return nil, fmt.Errorf("unexpected first line: %q", firstLine)
+	}
+
+	statusCode, _ := strconv.Atoi(statusCodeMatches[1])
+	info := &Info{
+		StatusCode: statusCode,
+		Header:     make(http.Header),
+	}
+
+	for {
+		line, lineError := br.ReadString('\n')
+		if lineError != nil {
+			return nil, fmt.Errorf("br.ReadString(Header): %w", lineError)
+		}
+
+		if line == "\n" {
+			break
+		}
+
+		headerMatches := readHTTPInfoHeaderRegexp.FindStringSubmatch(line)
+		if headerMatches == nil {
+			return nil, fmt.Errorf("unexpected header line: %q", line)
+		}
+
+		headerKey, headerValue := headerMatches[1], headerMatches[2]
+		switch headerKey {
+		case CustomHeaderExpires:
+			if expires, err := strconv.ParseInt(headerValue, 10, 64); err == nil {
+				t := time.Unix(0, expires)
+				info.Expires = &t
+			}
+		case CustomHeaderFetched:
+			if fetched, err := strconv.ParseInt(headerValue, 10, 64); err == nil {
+				t := time.Unix(0, fetched)
+				info.Fetched = &t
+			}
+		}
+
+		info.Header.Add(headerKey, headerValue)
+	}
+
+	return info, nil
+}
+
 // WriteHTTP writes cache data in http format
 func WriteHTTP(w io.Writer, input *Input) error {
-	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
 	defer func() { _ = bw.Flush() }()
 
 	_, statusCodeError := bw.WriteString(fmt.Sprintf("HTTP %d\n", input.StatusCode))
@@ -43,6 +105,15 @@ func WriteHTTP(w io.Writer, input *Input) error {
 		return fmt.Errorf("writeHTTPHeader: %w", httpHeaderError)
 	}
 
+	if input.BodyReader != nil {
+		bodyReaderError := writeHTTPBodyReader(bw, cw, input.BodyReader)
+		if bodyReaderError != nil {
+			return fmt.Errorf("writeHTTPBodyReader: %w", bodyReaderError)
+		}
+
+		return nil
+	}
+
 	_, bodyError := writeHTTPBody(bw, input)
 	if bodyError != nil {
 		return fmt.Errorf("writeHTTPBody: %w", bodyError)
@@ -53,43 +124,34 @@ func WriteHTTP(w io.Writer, input *Input) error {
 
 // WriteHTTPCachingHeaders writes caching related headers
 // like last modified, cache control, expires.
+// The origin last modified value is kept if available so it can be used for revalidation,
+// otherwise the current time is used as last modified.
 func WriteHTTPCachingHeaders(bw *bufio.Writer, input *Input) error {
-	var (
-		now     = time.Now()
-		expires *time.Time
-	)
+	now := time.Now()
 
-	_, lastModifiedError := bw.WriteString(fmt.Sprintf("%s: %s\n", HeaderLastModified, now.Format(http.TimeFormat)))
-	if lastModifiedError != nil {
-		return fmt.Errorf("bw.WriteString(LastModified): %w", lastModifiedError)
+	_, fetchedError := bw.WriteString(formatFetchedHeader(now))
+	if fetchedError != nil {
+		return fmt.Errorf("bw.WriteString(Fetched): %w", fetchedError)
 	}
 
-	if expires == nil {
-		inputHeaderExpires := input.Header.Get(HeaderExpires)
-		if len(inputHeaderExpires) > 0 {
-			t, err := time.Parse(http.TimeFormat, inputHeaderExpires)
-			if err == nil && t.After(now) {
-				expires = &t
-			}
-		}
-	}
+	lastModified := now
+	originLastModified, originLastModifiedError := http.ParseTime(input.Header.Get(HeaderLastModified))
+	if originLastModifiedError == nil {
+		lastModified = originLastModified
 
-	if expires == nil {
-		inputHeaderCacheControl := input.Header.Get(HeaderCacheControl)
-		maxAgeSubmatch := writeHTTPCachingHeadersMaxAgeRegexp.FindStringSubmatch(inputHeaderCacheControl)
-		if maxAgeSubmatch != nil {
-			if maxAge, err := strconv.ParseInt(maxAgeSubmatch[1], 10, 64); err == nil && maxAge > 0 {
-				expires = &time.Time{}
-				*expires = now.Add(time.Duration(maxAge) * time.Second)
-			}
+		// only the origin value is used for revalidation
+		_, customError := bw.WriteString(fmt.Sprintf("%s: %s\n", CustomHeaderLastModified, lastModified.UTC().Format(http.TimeFormat)))
+		if customError != nil {
+			return fmt.Errorf("bw.WriteString(CustomLastModified): %w", customError)
 		}
 	}
 
-	if expires == nil && input.TTL > 0 {
-		expires = &time.Time{}
-		*expires = now.Add(input.TTL)
+	_, lastModifiedError := bw.WriteString(fmt.Sprintf("%s: %s\n", HeaderLastModified, lastModified.UTC().Format(http.TimeFormat)))
+	if lastModifiedError != nil {
+		return fmt.Errorf("bw.WriteString(LastModified): %w", lastModifiedError)
 	}
 
+	expires := GetExpires(input.Header, input.TTL, now)
 	if expires != nil {
 		_, cacheControlError := bw.WriteString(fmt.Sprintf("%s: public, max-age=%d\n%s: %s\n",
 			HeaderCacheControl, expires.Unix()-now.Unix(),
@@ -108,10 +170,48 @@ func WriteHTTPCachingHeaders(bw *bufio.Writer, input *Input) error {
 	return nil
 }
 
+// GetExpires returns expire time derived from http header (Expires or Cache-Control max-age),
+// falling back to the specified ttl. It returns nil if none is available.
+func GetExpires(header http.Header, ttl time.Duration, now time.Time) *time.Time {
+	var expires *time.Time
+
+	if expires == nil {
+		headerExpires := header.Get(HeaderExpires)
+		if len(headerExpires) > 0 {
+			t, err := time.Parse(http.TimeFormat, headerExpires)
+			if err == nil && t.After(now) {
+				expires = &t
+			}
+		}
+	}
+
+	if expires == nil {
+		headerCacheControl := header.Get(HeaderCacheControl)
+		maxAgeSubmatch := writeHTTPCachingHeadersMaxAgeRegexp.FindStringSubmatch(headerCacheControl)
+		if maxAgeSubmatch != nil {
+			if maxAge, err := strconv.ParseInt(maxAgeSubmatch[1], 10, 64); err == nil && maxAge > 0 {
+				expires = &time.Time{}
+				*expires = now.Add(time.Duration(maxAge) * time.Second)
+			}
+		}
+	}
+
+	if expires == nil && ttl > 0 {
+		expires = &time.Time{}
+		*expires = now.Add(ttl)
+	}
+
+	return expires
+}
+
 func formatExpiresHeader(expires time.Time) string {
 	return fmt.Sprintf("%s: %020d\n", CustomHeaderExpires, expires.UnixNano())
 }
 
+func formatFetchedHeader(fetched time.Time) string {
+	return fmt.Sprintf("%s: %020d\n", CustomHeaderFetched, fetched.UnixNano())
+}
+
 func writeHTTPHeader(bw *bufio.Writer, input *Input) error {
 	if input.Header == nil {
 		return nil
@@ -123,6 +223,8 @@ func writeHTTPHeader(bw *bufio.Writer, input *Input) error {
 			continue
 		case HeaderExpires:
 			continue
+		case HeaderLastModified:
+			continue
 		default:
 			for _, headerValue := range headerValues {
 				_, writeError := bw.WriteString(fmt.Sprintf("%s: %s\n", headerKey, headerValue))
@@ -150,6 +252,140 @@ func writeHTTPBody(bw *bufio.Writer, input *Input) (int, error) {
 	}
 }
 
+// writeHTTPBodyReader streams body to the writer, which must also be an io.WriterAt.
+// The body length is not known beforehand so a fixed width Content-Length is written first
+// and updated after the body has been copied.
+func writeHTTPBodyReader(bw *bufio.Writer, cw *countingWriter, r io.Reader) error {
+	wa, ok := cw.w.(io.WriterAt)
+	if !ok {
+		return errors.New("io.WriterAt is required to stream body")
+	}
+
+	_, prefixError := bw.WriteString(fmt.Sprintf("%s: ", HeaderContentLength))
+	if prefixError != nil {
+		return fmt.Errorf("bw.WriteString(Content-Length): %w", prefixError)
+	}
+	contentLengthOffset := cw.n + int64(bw.Buffered())
+
+	_, contentLengthError := bw.WriteString(formatContentLength(0) + "\n\n")
+	if contentLengthError != nil {
+		return fmt.Errorf("bw.WriteString(Content-Length): %w", contentLengthError)
+	}
+
+	bodyLen, copyError := io.Copy(bw, r)
+	if copyError != nil {
+		return fmt.Errorf("io.Copy: %w", copyError)
+	}
+
+	flushError := bw.Flush()
+	if flushError != nil {
+		return fmt.Errorf("bw.Flush: %w", flushError)
+	}
+
+	_, writeAtError := wa.WriteAt([]byte(formatContentLength(bodyLen)), contentLengthOffset)
+	if writeAtError != nil {
+		return fmt.Errorf("WriteAt(Content-Length): %w", writeAtError)
+	}
+
+	return nil
+}
+
+func formatContentLength(contentLength int64) string {
+	return fmt.Sprintf("%020d", contentLength)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// updateHTTPStaleHeader adds or removes the stale header of cache data in http format.
+// It returns nil if the data already has the expected staleness.
+func updateHTTPStaleHeader(data []byte, stale bool, now time.Time) ([]byte, error) {
+	firstLineEnd := bytes.IndexByte(data, '\n')
+	if firstLineEnd < 0 || !readHTTPInfoStatusCodeRegexp.Match(data[:firstLineEnd+1]) {
+		return nil, errors.New("unexpected first line")
+	}
+	if bytes.Equal(data[:firstLineEnd+1], []byte(writeHTTPPlaceholderFirstLine)) {
+		return nil, errors.New("placeholder cannot be stale")
+	}
+
+	headerEnd := bytes.Index(data, []byte("\n\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("unexpected end of header")
+	}
+
+	found := false
+	var header bytes.Buffer
+	for _, line := range bytes.SplitAfter(data[firstLineEnd+1:headerEnd+1], []byte("\n")) {
+		if bytes.HasPrefix(line, []byte(CustomHeaderStale+":")) {
+			found = true
+			continue
+		}
+		header.Write(line)
+	}
+	if found == stale {
+		return nil, nil
+	}
+
+	updated := make([]byte, 0, len(data)+64)
+	updated = append(updated, data[:firstLineEnd+1]...)
+	if stale {
+		updated = append(updated, fmt.Sprintf("%s: %d\n", CustomHeaderStale, now.UnixNano())...)
+	}
+	updated = append(updated, header.Bytes()...)
+	updated = append(updated, data[headerEnd+1:]...)
+
+	return updated, nil
+}
+
+// updateHTTPHeader replaces header lines of cache data in http format with the specified values.
+func updateHTTPHeader(data []byte, header http.Header) ([]byte, error) {
+	firstLineEnd := bytes.IndexByte(data, '\n')
+	if firstLineEnd < 0 || !readHTTPInfoStatusCodeRegexp.Match(data[:firstLineEnd+1]) {
+		return nil, errors.New("unexpected first line")
+	}
+	if bytes.Equal(data[:firstLineEnd+1], []byte(writeHTTPPlaceholderFirstLine)) {
+		return nil, errors.New("placeholder cannot be updated")
+	}
+
+	headerEnd := bytes.Index(data, []byte("\n\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("unexpected end of header")
+	}
+
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	updated := make([]byte, 0, len(data)+256)
+	updated = append(updated, data[:firstLineEnd+1]...)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			updated = append(updated, fmt.Sprintf("%s: %s\n", key, value)...)
+		}
+	}
+	for _, line := range bytes.SplitAfter(data[firstLineEnd+1:headerEnd+1], []byte("\n")) {
+		if colon := bytes.IndexByte(line, ':'); colon > 0 {
+			if _, ok := header[http.CanonicalHeaderKey(string(line[:colon]))]; ok {
+				continue
+			}
+		}
+		updated = append(updated, line...)
+	}
+	updated = append(updated, data[headerEnd+1:]...)
+
+	return updated, nil
+}
+
 func writeHTTPPlaceholder(w io.Writer, url *url.URL, expires time.Time) error {
 	_, writeError := w.Write([]byte(fmt.Sprintf(
 		"%s%s: %s\n%s\n",
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	neturl "net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/daohoangson/go-sitemirror/cacher"
@@ -84,6 +85,36 @@ var _ = Describe("Http", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("should write origin Last-Modified header", func() {
+			input := input2xx
+			lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+			input.Header.Set(HeaderLastModified, lastModified)
+			_ = WriteHTTP(&buffer, input)
+
+			written := buffer.String()
+			Expect(strings.Count(written, "\n"+HeaderLastModified+":")).To(Equal(1))
+			Expect(getHeaderValue(written, HeaderLastModified)).To(Equal(lastModified))
+			Expect(getHeaderValue(written, CustomHeaderLastModified)).To(Equal(lastModified))
+		})
+
+		It("should not write origin Last-Modified header without one", func() {
+			input := input2xx
+			_ = WriteHTTP(&buffer, input)
+
+			written := buffer.String()
+			Expect(written).ToNot(ContainSubstring(CustomHeaderLastModified))
+		})
+
+		It("should write ETag header", func() {
+			input := input2xx
+			etag := `"foo"`
+			input.Header.Set(HeaderETag, etag)
+			_ = WriteHTTP(&buffer, input)
+
+			written := buffer.String()
+			Expect(getHeaderValue(written, http.CanonicalHeaderKey(HeaderETag))).To(Equal(etag))
+		})
+
 		Describe("Caching", func() {
 			It("should write our Expires header", func() {
 				input := input2xx
@@ -249,6 +280,14 @@ var _ = Describe("Http", func() {
 				Expect(written).To(HaveSuffix("\n\n"))
 			})
 
+			It("should not write body reader (no io.WriterAt)", func() {
+				input := input2xx
+				input.BodyReader = strings.NewReader("foo/bar")
+				err := WriteHTTP(&buffer, input)
+
+				Expect(err).To(HaveOccurred())
+			})
+
 			It("should write body string", func() {
 				input := input2xx
 				input.Body = "foo/bar"
@@ -279,4 +318,75 @@ var _ = Describe("Http", func() {
 			})
 		})
 	})
+
+	Describe("GetExpires", func() {
+		now := time.Now()
+
+		It("should return nil", func() {
+			Expect(GetExpires(nil, 0, now)).To(BeNil())
+		})
+
+		It("should use Expires", func() {
+			header := make(http.Header)
+			expires := now.Add(time.Hour)
+			header.Set(HeaderExpires, expires.UTC().Format(http.TimeFormat))
+
+			Expect(GetExpires(header, time.Minute, now).Unix()).To(Equal(expires.Unix()))
+		})
+
+		It("should use Cache-Control max-age", func() {
+			header := make(http.Header)
+			header.Set(HeaderCacheControl, "public, max-age=3600")
+
+			Expect(*GetExpires(header, time.Minute, now)).To(Equal(now.Add(time.Hour)))
+		})
+
+		It("should use ttl", func() {
+			Expect(*GetExpires(make(http.Header), time.Minute, now)).To(Equal(now.Add(time.Minute)))
+		})
+	})
+
+	Describe("ReadHTTPInfo", func() {
+		It("should read status code and header", func() {
+			expires := time.Now().Add(time.Hour)
+			url, _ := neturl.Parse("https://domain.com/http/read/info")
+			input := &Input{
+				StatusCode: http.StatusOK,
+				URL:        url,
+				Header:     make(http.Header),
+				Body:       "foo/bar",
+			}
+			input.Header.Add(HeaderExpires, expires.Format(http.TimeFormat))
+
+			var buffer bytes.Buffer
+			_ = WriteHTTP(&buffer, input)
+
+			info, err := ReadHTTPInfo(&buffer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.StatusCode).To(Equal(http.StatusOK))
+			Expect(info.Header.Get(CustomHeaderURL)).To(Equal(url.String()))
+			Expect(info.Header.Get(HeaderContentLength)).To(Equal("7"))
+			Expect(info.Expires.Unix()).To(Equal(expires.Unix()))
+		})
+
+		It("should handle empty data", func() {
+			_, err := ReadHTTPInfo(bytes.NewReader([]byte{}))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should handle invalid first line", func() {
+			_, err := ReadHTTPInfo(bytes.NewReader([]byte("HTTP\n\n")))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should handle invalid header line", func() {
+			_, err := ReadHTTPInfo(bytes.NewReader([]byte("HTTP 200\nfoo\n\n")))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should handle missing end of header", func() {
+			_, err := ReadHTTPInfo(bytes.NewReader([]byte("HTTP 200\nKey: Value\n")))
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
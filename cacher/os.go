@@ -24,3 +24,7 @@ func (fs *realFs) OpenFile(name string, flag int, perm os.FileMode) (File, error
 func (fs *realFs) RemoveAll(path string) error {
 	return os.RemoveAll(path)
 }
+
+func (fs *realFs) Rename(oldpath string, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
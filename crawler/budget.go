@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	neturl "net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/daohoangson/go-sitemirror/cacher"
+)
+
+// hostBudget keeps track of downloads per host to enforce crawl budgets
+type hostBudget struct {
+	pages     uint64
+	bytes     uint64
+	exhausted string
+}
+
+// checkHostBudget returns the reason if crawl budget for the url host has been exhausted
+func (c *crawler) checkHostBudget(url *neturl.URL) string {
+	host := getHostBudgetKey(url)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if budget, ok := c.hostBudgets[host]; ok {
+		return budget.exhausted
+	}
+
+	return ""
+}
+
+// recordHostBudget counts the download against its host budget, only html downloads count as pages
+func (c *crawler) recordHostBudget(downloaded *Downloaded) {
+	var (
+		host     = getHostBudgetKey(downloaded.Input.URL)
+		maxPages = c.GetHostMaxPages()
+		maxBytes = c.GetHostMaxBytes()
+	)
+
+	c.mutex.Lock()
+	budget, ok := c.hostBudgets[host]
+	if !ok {
+		budget = &hostBudget{}
+		c.hostBudgets[host] = budget
+	}
+
+	if isPage(downloaded) {
+		budget.pages++
+	}
+	budget.bytes += downloaded.bodySize
+
+	exhausted := ""
+	if len(budget.exhausted) == 0 {
+		if maxPages > 0 && budget.pages >= maxPages {
+			exhausted = BudgetExhaustedPages
+		} else if maxBytes > 0 && budget.bytes >= maxBytes {
+			exhausted = BudgetExhaustedBytes
+		}
+		budget.exhausted = exhausted
+	}
+	pages, bytes := budget.pages, budget.bytes
+	c.mutex.Unlock()
+
+	if len(exhausted) > 0 {
+		c.logger.WithFields(logrus.Fields{
+			"host":   host,
+			"reason": exhausted,
+			"pages":  pages,
+			"bytes":  bytes,
+		}).Warn("Exhausted host crawl budget")
+	}
+}
+
+func (c *crawler) GetHostsBudgetExhausted() map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	hosts := make(map[string]string)
+	for host, budget := range c.hostBudgets {
+		if len(budget.exhausted) > 0 {
+			hosts[host] = budget.exhausted
+		}
+	}
+
+	return hosts
+}
+
+func (c *crawler) GetBudgetSkippedCount() uint64 {
+	return atomic.LoadUint64(&c.budgetSkippedCount)
+}
+
+func isPage(downloaded *Downloaded) bool {
+	for _, contentType := range downloaded.GetHeaderValues(cacher.HeaderContentType) {
+		if strings.Split(contentType, ";")[0] == "text/html" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getHostBudgetKey(url *neturl.URL) string {
+	return NormalizeURL(url, false).Host
+}
@@ -0,0 +1,138 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+)
+
+// persistentJar saves cookies to a file so sessions survive restarts
+type persistentJar struct {
+	*cookiejar.Jar
+
+	logger *logrus.Logger
+	mutex  sync.Mutex
+	path   string
+
+	entries map[string]persistentCookie
+}
+
+type persistentCookie struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// newCookieJar returns a cookie jar, cookies are loaded from and saved to the file at path unless it is empty
+func newCookieJar(path string, logger *logrus.Logger) (http.CookieJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, fmt.Errorf("cookiejar.New: %w", err)
+	}
+
+	if len(path) == 0 {
+		return jar, nil
+	}
+
+	pj := &persistentJar{
+		Jar:     jar,
+		logger:  logger,
+		path:    path,
+		entries: make(map[string]persistentCookie),
+	}
+
+	if err = pj.load(); err != nil {
+		return nil, err
+	}
+
+	return pj, nil
+}
+
+func (pj *persistentJar) SetCookies(u *neturl.URL, cookies []*http.Cookie) {
+	pj.Jar.SetCookies(u, cookies)
+
+	origin := (&neturl.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+	now := time.Now()
+
+	pj.mutex.Lock()
+	defer pj.mutex.Unlock()
+
+	for _, cookie := range cookies {
+		key := fmt.Sprintf("%s|%s|%s|%s", u.Host, cookie.Domain, cookie.Path, cookie.Name)
+		if cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(now)) {
+			delete(pj.entries, key)
+			continue
+		}
+
+		saved := *cookie
+		if saved.MaxAge > 0 {
+			// max age is relative, save the absolute time instead
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+
+		pj.entries[key] = persistentCookie{URL: origin, Cookie: &saved}
+	}
+
+	if err := pj.save(); err != nil {
+		pj.logger.WithField("path", pj.path).WithError(err).Error("Cannot save cookies")
+	}
+}
+
+func (pj *persistentJar) load() error {
+	data, err := os.ReadFile(pj.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var entries map[string]persistentCookie
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	now := time.Now()
+	for key, entry := range entries {
+		if entry.Cookie == nil || (!entry.Cookie.Expires.IsZero() && entry.Cookie.Expires.Before(now)) {
+			continue
+		}
+
+		u, parseError := neturl.Parse(entry.URL)
+		if parseError != nil {
+			continue
+		}
+
+		pj.Jar.SetCookies(u, []*http.Cookie{entry.Cookie})
+		pj.entries[key] = entry
+	}
+
+	return nil
+}
+
+func (pj *persistentJar) save() error {
+	data, err := json.Marshal(pj.entries)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	tmpPath := pj.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, pj.path); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	return nil
+}
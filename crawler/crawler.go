@@ -10,7 +10,7 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/hectane/go-nonblockingchan"
+	"github.com/daohoangson/go-sitemirror/cacher"
 	"github.com/tevino/abool"
 )
 
@@ -21,21 +21,36 @@ type crawler struct {
 	logger *logrus.Logger
 	mutex  sync.Mutex
 
-	autoDownloadDepth uint64
-	noCrossHost       *abool.AtomicBool
-	requestHeader     http.Header
-	workerCount       uint64
+	autoDownloadDepth     uint64
+	cookieJarPath         string
+	dropTrackingParams    *abool.AtomicBool
+	hostConcurrency       uint64
+	hostMaxBytes          uint64
+	hostMaxPages          uint64
+	hostRequestsPerSecond float64
+	login                 *Login
+	maxBodySize           uint64
+	noCrossHost           *abool.AtomicBool
+	respectRobotsTxt      *abool.AtomicBool
+	requestHeader         http.Header
+	retries               uint64
+	retryDelay            int64
+	workerCount           uint64
 
 	urlRewriter         *func(*neturl.URL)
 	onURLShouldQueue    *func(*neturl.URL) bool
+	onURLShouldProcess  *func(*neturl.URL) bool
 	onURLShouldDownload *func(*neturl.URL) bool
 	onDownload          *func(*neturl.URL)
 	onDownloaded        *func(*Downloaded)
 
 	output           chan *Downloaded
-	queue            *nbc.NonBlockingChan
+	frontier         *frontier
+	frontierPath     string
+	queue            *queue
 	queueOpen        bool
 	workerStartOnce  sync.Once
+	workerSeq        uint64
 	workersStarted   uint64
 	workersRunning   int64
 	enqueuedCount    uint64
@@ -43,6 +58,14 @@ type crawler struct {
 	downloadingCount int64
 	downloadedCount  uint64
 	linkFoundCount   uint64
+
+	loginMutex      sync.Mutex
+	loginGeneration uint64
+
+	budgetSkippedCount uint64
+	hostBudgets        map[string]*hostBudget
+	robotsTxts         map[string]*robotsTxtEntry
+	seen               *seenSet
 }
 
 // New returns a new crawler instance
@@ -64,10 +87,17 @@ func (c *crawler) init(client *http.Client, logger *logrus.Logger) {
 	c.logger = logger
 
 	c.autoDownloadDepth = 1
+	c.dropTrackingParams = abool.New()
 	c.noCrossHost = abool.New()
+	c.respectRobotsTxt = abool.New()
 	c.requestHeader = make(http.Header)
 	c.workerCount = 4
 
+	c.queue = newQueue()
+	c.hostBudgets = make(map[string]*hostBudget)
+	c.robotsTxts = make(map[string]*robotsTxtEntry)
+	c.seen = newSeenSet(SeenCapacity)
+
 	userAgent := fmt.Sprintf("go-sitemirror/%s (Googlebot wannabe)", version)
 	c.requestHeader.Add("User-Agent", userAgent)
 	logger.WithFields(logrus.Fields{
@@ -97,6 +127,224 @@ func (c *crawler) GetAutoDownloadDepth() uint64 {
 	return atomic.LoadUint64(&c.autoDownloadDepth)
 }
 
+// SetCookieJarPath enables the cookie jar for all requests,
+// cookies are persisted at the specified path unless it is empty.
+func (c *crawler) SetCookieJarPath(path string) error {
+	jar, err := newCookieJar(path, c.logger)
+	if err != nil {
+		return fmt.Errorf("newCookieJar: %w", err)
+	}
+
+	c.mutex.Lock()
+	old := c.cookieJarPath
+	// copy the client to avoid changing the shared instance
+	client := *c.client
+	client.Jar = jar
+	c.client = &client
+	c.cookieJarPath = path
+	c.mutex.Unlock()
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": path,
+	}).Info("Updated crawler cookie jar path")
+
+	return nil
+}
+
+func (c *crawler) GetCookieJarPath() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.cookieJarPath
+}
+
+func (c *crawler) GetCookieJar() http.CookieJar {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.client.Jar
+}
+
+func (c *crawler) SetDropTrackingParams(value bool) {
+	old := c.dropTrackingParams.IsSet()
+	c.dropTrackingParams.SetTo(value)
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": value,
+	}).Info("Updated crawler drop tracking params")
+}
+
+func (c *crawler) GetDropTrackingParams() bool {
+	return c.dropTrackingParams.IsSet()
+}
+
+// SetFrontierPath persists queued and visited urls at the specified path of fs.
+// Pending items from the previous run are enqueued again immediately.
+func (c *crawler) SetFrontierPath(fs cacher.Fs, path string) error {
+	f, items, err := openFrontier(fs, path)
+	if err != nil {
+		return fmt.Errorf("openFrontier: %w", err)
+	}
+
+	c.mutex.Lock()
+	old := c.frontier
+	oldPath := c.frontierPath
+	c.frontier = f
+	c.frontierPath = path
+	c.mutex.Unlock()
+
+	if old != nil {
+		_ = old.close()
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"old":     oldPath,
+		"new":     path,
+		"pending": len(items),
+	}).Info("Updated crawler frontier path")
+
+	for _, item := range items {
+		c.Enqueue(item)
+	}
+
+	return nil
+}
+
+func (c *crawler) GetFrontierPath() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.frontierPath
+}
+
+func (c *crawler) SetHostConcurrency(concurrency uint64) {
+	old := atomic.LoadUint64(&c.hostConcurrency)
+	atomic.StoreUint64(&c.hostConcurrency, concurrency)
+	c.queue.setMaxInFlight(concurrency)
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": concurrency,
+	}).Info("Updated crawler host concurrency")
+}
+
+func (c *crawler) GetHostConcurrency() uint64 {
+	return atomic.LoadUint64(&c.hostConcurrency)
+}
+
+func (c *crawler) SetHostMaxBytes(bytes uint64) {
+	old := atomic.LoadUint64(&c.hostMaxBytes)
+	atomic.StoreUint64(&c.hostMaxBytes, bytes)
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": bytes,
+	}).Info("Updated crawler host max bytes")
+}
+
+func (c *crawler) GetHostMaxBytes() uint64 {
+	return atomic.LoadUint64(&c.hostMaxBytes)
+}
+
+func (c *crawler) SetHostMaxPages(pages uint64) {
+	old := atomic.LoadUint64(&c.hostMaxPages)
+	atomic.StoreUint64(&c.hostMaxPages, pages)
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": pages,
+	}).Info("Updated crawler host max pages")
+}
+
+func (c *crawler) GetHostMaxPages() uint64 {
+	return atomic.LoadUint64(&c.hostMaxPages)
+}
+
+func (c *crawler) SetHostRequestsPerSecond(rps float64) error {
+	if rps < 0 {
+		return errors.New("rps cannot be negative")
+	}
+
+	var interval time.Duration
+	if rps > 0 {
+		interval = time.Duration(float64(time.Second) / rps)
+	}
+
+	c.mutex.Lock()
+	old := c.hostRequestsPerSecond
+	c.hostRequestsPerSecond = rps
+	c.mutex.Unlock()
+	c.queue.setInterval(interval)
+
+	c.logger.WithFields(logrus.Fields{
+		"old":      old,
+		"new":      rps,
+		"interval": interval,
+	}).Info("Updated crawler host requests per second")
+	return nil
+}
+
+func (c *crawler) GetHostRequestsPerSecond() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.hostRequestsPerSecond
+}
+
+// SetLogin submits the login form before the next download and again after session expiry,
+// the cookie jar is enabled if needed.
+func (c *crawler) SetLogin(login *Login) error {
+	if login != nil {
+		if login.URL == nil || !login.URL.IsAbs() {
+			return errors.New("login url must be absolute")
+		}
+
+		if c.GetCookieJar() == nil {
+			if err := c.SetCookieJarPath(""); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.loginMutex.Lock()
+	c.mutex.Lock()
+	old := c.login
+	c.login = login
+	c.mutex.Unlock()
+	c.loginGeneration = 0
+	c.loginMutex.Unlock()
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old.String(),
+		"new": login.String(),
+	}).Info("Updated crawler login")
+
+	return nil
+}
+
+func (c *crawler) GetLogin() *Login {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.login
+}
+
+func (c *crawler) SetMaxBodySize(size uint64) {
+	old := atomic.LoadUint64(&c.maxBodySize)
+	atomic.StoreUint64(&c.maxBodySize, size)
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": size,
+	}).Info("Updated crawler max body size")
+}
+
+func (c *crawler) GetMaxBodySize() uint64 {
+	return atomic.LoadUint64(&c.maxBodySize)
+}
+
 func (c *crawler) SetNoCrossHost(value bool) {
 	old := c.noCrossHost.IsSet()
 	c.noCrossHost.SetTo(value)
@@ -111,6 +359,49 @@ func (c *crawler) GetNoCrossHost() bool {
 	return c.noCrossHost.IsSet()
 }
 
+func (c *crawler) SetRespectRobotsTxt(value bool) {
+	old := c.respectRobotsTxt.IsSet()
+	c.respectRobotsTxt.SetTo(value)
+	c.queue.setRespectCrawlDelay(value)
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": value,
+	}).Info("Updated crawler respect robots.txt")
+}
+
+func (c *crawler) GetRespectRobotsTxt() bool {
+	return c.respectRobotsTxt.IsSet()
+}
+
+func (c *crawler) SetRetries(retries uint64) {
+	old := atomic.LoadUint64(&c.retries)
+	atomic.StoreUint64(&c.retries, retries)
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": retries,
+	}).Info("Updated crawler retries")
+}
+
+func (c *crawler) GetRetries() uint64 {
+	return atomic.LoadUint64(&c.retries)
+}
+
+func (c *crawler) SetRetryDelay(delay time.Duration) {
+	old := time.Duration(atomic.LoadInt64(&c.retryDelay))
+	atomic.StoreInt64(&c.retryDelay, int64(delay))
+
+	c.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": delay,
+	}).Info("Updated crawler retry delay")
+}
+
+func (c *crawler) GetRetryDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.retryDelay))
+}
+
 func (c *crawler) AddRequestHeader(key string, value string) {
 	c.mutex.Lock()
 	c.requestHeader.Add(key, value)
@@ -147,17 +438,24 @@ func (c *crawler) GetRequestHeaderValues(key string) []string {
 	return nil
 }
 
+// SetWorkerCount updates the number of workers, it can be called while the crawler is running.
+// Extra workers exit after finishing their current item.
 func (c *crawler) SetWorkerCount(count uint64) error {
 	if count < 1 {
 		return errors.New("workerCount must be greater than 1")
 	}
 
-	if c.HasStarted() {
-		return errors.New("cannot SetWorkerCount after Start")
-	}
-
+	c.mutex.Lock()
 	old := atomic.LoadUint64(&c.workerCount)
 	atomic.StoreUint64(&c.workerCount, count)
+	if c.queueOpen {
+		if count > old {
+			c.startWorkers(count - old)
+		} else if count < old {
+			c.queue.retire(int(old - count))
+		}
+	}
+	c.mutex.Unlock()
 
 	c.logger.WithFields(logrus.Fields{
 		"old": old,
@@ -182,6 +480,12 @@ func (c *crawler) SetOnURLShouldQueue(f func(*neturl.URL) bool) {
 	c.mutex.Unlock()
 }
 
+func (c *crawler) SetOnURLShouldProcess(f func(*neturl.URL) bool) {
+	c.mutex.Lock()
+	c.onURLShouldProcess = &f
+	c.mutex.Unlock()
+}
+
 func (c *crawler) SetOnURLShouldDownload(f func(*neturl.URL) bool) {
 	c.mutex.Lock()
 	c.onURLShouldDownload = &f
@@ -261,60 +565,64 @@ func (c *crawler) IsBusy() bool {
 
 func (c *crawler) Start() {
 	c.workerStartOnce.Do(func() {
+		c.mutex.Lock()
 		workerCount := atomic.LoadUint64(&c.workerCount)
-
 		loggerContext := c.logger.WithFields(logrus.Fields{
 			"workers": workerCount,
 		})
 		loggerContext.Debug("Starting crawler")
 
-		c.mutex.Lock()
-		c.queue = nbc.New()
 		c.output = make(chan *Downloaded)
 		c.queueOpen = true
+		c.startWorkers(workerCount)
 		c.mutex.Unlock()
 
-		for i := uint64(0); i < workerCount; i++ {
-			go func(workerID uint64) {
-				atomic.AddUint64(&c.workersStarted, 1)
-				atomic.AddInt64(&c.workersRunning, 1)
-
-				for {
-					if v, ok := <-c.queue.Recv; ok {
-						if item, ok := v.(QueueItem); ok {
-							downloaded := c.doDownload(item)
-
-							c.doAutoQueue(workerID, item, downloaded)
-						}
-					} else {
-						break
-					}
-				}
-
-				atomic.AddInt64(&c.workersRunning, -1)
-			}(i + 1)
-		}
-
 		loggerContext.Info("Started crawler")
 	})
 }
 
+// Pause stops workers from picking up queued items, on-demand downloads still work
+func (c *crawler) Pause() {
+	c.queue.setPaused(true)
+
+	c.logger.Info("Paused crawler")
+}
+
+func (c *crawler) Resume() {
+	c.queue.setPaused(false)
+
+	c.logger.Info("Resumed crawler")
+}
+
+func (c *crawler) IsPaused() bool {
+	return c.queue.isPaused()
+}
+
 func (c *crawler) Stop() {
-	if !c.HasStarted() {
-		c.logger.Debug("Crawler hasn't started")
-		return
-	}
+	// workers may not have been counted yet, check the queue instead
+	c.mutex.Lock()
+	if !c.queueOpen {
+		started := c.output != nil
+		c.mutex.Unlock()
 
-	if c.HasStopped() {
-		c.logger.Debug("Crawler has already stopped")
+		if started {
+			c.logger.Debug("Crawler has already stopped")
+		} else {
+			c.logger.Debug("Crawler hasn't started")
+		}
 		return
 	}
-
-	c.mutex.Lock()
 	c.queueOpen = false
 	close(c.output)
-	close(c.queue.Send)
+	dropped := c.queue.close()
+	frontier := c.frontier
 	c.mutex.Unlock()
+	atomic.AddInt64(&c.queuingCount, -int64(dropped))
+
+	if frontier != nil {
+		// dropped items are kept in the frontier to be resumed later
+		_ = frontier.close()
+	}
 
 	c.logger.Info("Stopped crawler")
 }
@@ -325,7 +633,7 @@ func (c *crawler) Enqueue(item QueueItem) {
 }
 
 func (c *crawler) Download(item QueueItem) *Downloaded {
-	return c.doDownload(item)
+	return c.doDownload(item, false)
 }
 
 func (c *crawler) Downloaded() (*Downloaded, bool) {
@@ -346,20 +654,127 @@ func (c *crawler) DownloadedNotBlocking() *Downloaded {
 	}
 }
 
+func (c *crawler) startWorkers(count uint64) {
+	for i := uint64(0); i < count; i++ {
+		workerID := atomic.AddUint64(&c.workerSeq, 1)
+
+		go func() {
+			atomic.AddUint64(&c.workersStarted, 1)
+			atomic.AddInt64(&c.workersRunning, 1)
+
+			for {
+				item, ok := c.queue.pop()
+				if !ok {
+					break
+				}
+
+				// the item is busy until its result has been processed and its links enqueued
+				atomic.AddInt64(&c.downloadingCount, 1)
+				atomic.AddInt64(&c.queuingCount, -1)
+
+				var downloaded *Downloaded
+				if reason := c.checkHostBudget(item.URL); len(reason) > 0 {
+					// the budget may have run out after the item was queued
+					atomic.AddUint64(&c.budgetSkippedCount, 1)
+					c.logger.WithFields(logrus.Fields{
+						"worker": workerID,
+						"url":    item.URL,
+						"reason": reason,
+					}).Debug("Skipped download as host budget exhausted")
+				} else {
+					c.queue.setCrawlDelay(item.URL.Host, c.getCrawlDelay(item.URL))
+					downloaded = c.doDownload(item, true)
+				}
+				c.queue.done(item.URL.Host)
+				c.doneEnqueued(item, downloaded)
+
+				c.doAutoQueue(workerID, item, downloaded)
+				atomic.AddInt64(&c.downloadingCount, -1)
+			}
+
+			atomic.AddInt64(&c.workersRunning, -1)
+			c.logger.WithField("worker", workerID).Debug("Worker exited")
+		}()
+	}
+}
+
 func (c *crawler) doEnqueue(item QueueItem) {
+	// the url itself is kept as is to match links rewritten in cached pages
+	key := c.getSeenKey(item.URL)
+
+	c.mutex.Lock()
+	frontier := c.frontier
+	c.mutex.Unlock()
+
+	// journal access may wait for compaction, it must not block other workers
+	visited := !item.ForceDownload && frontier != nil && frontier.isVisited(key)
+
+	c.mutex.Lock()
+	duplicate := false
+	if !item.ForceDownload {
+		duplicate = visited || c.seen.has(key)
+	}
+	if !duplicate {
+		c.seen.add(key)
+	}
+	c.mutex.Unlock()
+
+	if duplicate {
+		c.logger.WithField("item", item).Debug("Skipped as duplicate")
+		return
+	}
+
 	atomic.AddUint64(&c.enqueuedCount, 1)
-	atomic.AddInt64(&c.queuingCount, 1)
+
+	if frontier != nil {
+		// pushed before queuing so that done is never recorded first,
+		// items that cannot be queued are resumed next time
+		if err := frontier.push(item); err != nil {
+			c.logger.WithField("item", item).WithError(err).Error("Cannot write frontier")
+		}
+	}
 
 	c.mutex.Lock()
 	if c.queueOpen {
-		c.queue.Send <- item
+		atomic.AddInt64(&c.queuingCount, 1)
+		c.queue.push(item)
 	}
 	c.mutex.Unlock()
 
 	c.logger.WithField("item", item).Debug("Enqueued")
 }
 
-func (c *crawler) doDownload(item QueueItem) *Downloaded {
+func (c *crawler) doneEnqueued(item QueueItem, downloaded *Downloaded) {
+	failed := downloaded != nil && downloaded.Error != nil
+	key := c.getSeenKey(item.URL)
+
+	c.mutex.Lock()
+	frontier := c.frontier
+	if failed {
+		// allow the url to be enqueued again
+		c.seen.remove(key)
+	}
+	c.mutex.Unlock()
+
+	if frontier == nil {
+		return
+	}
+
+	visitedKey := ""
+	if downloaded != nil && !failed {
+		visitedKey = key
+	}
+	if err := frontier.done(item, visitedKey); err != nil {
+		c.logger.WithField("item", item).WithError(err).Error("Cannot write frontier")
+	}
+}
+
+// getSeenKey returns the normalized url to be used for deduplication
+func (c *crawler) getSeenKey(url *neturl.URL) string {
+	return NormalizeURL(url, c.dropTrackingParams.IsSet()).String()
+}
+
+func (c *crawler) doDownload(item QueueItem, queued bool) *Downloaded {
 	var (
 		start          = time.Now()
 		loggerContext  = c.logger.WithField("item", item)
@@ -371,6 +786,7 @@ func (c *crawler) doDownload(item QueueItem) *Downloaded {
 	client := c.client
 	requestHeader := c.requestHeader
 	urlRewriter := c.urlRewriter
+	onURLShouldProcess := c.onURLShouldProcess
 	onDownload := c.onDownload
 	onURLShouldDownload := c.onURLShouldDownload
 	onDownloaded := c.onDownloaded
@@ -380,8 +796,11 @@ func (c *crawler) doDownload(item QueueItem) *Downloaded {
 		(*onDownload)(item.URL)
 	}
 
-	atomic.AddInt64(&c.downloadingCount, 1)
-	atomic.AddInt64(&c.queuingCount, -1)
+	if !queued {
+		// queued items are counted by their worker
+		atomic.AddInt64(&c.downloadingCount, 1)
+		defer atomic.AddInt64(&c.downloadingCount, -1)
+	}
 
 	if item.ForceDownload {
 		// do not trigger onURLShouldDownload
@@ -392,29 +811,69 @@ func (c *crawler) doDownload(item QueueItem) *Downloaded {
 		}
 	}
 
+	if shouldDownload && queued && !c.checkRobotsTxtAllowed(item.URL) {
+		// queued items are crawled on our own initiative, even if they are forced to refresh
+		shouldDownload = false
+		loggerContext.Debug("Skipped as disallowed by robots.txt")
+	}
+
 	if shouldDownload {
-		loggerContext.Debug("Downloading")
-		downloaded = Download(&Input{
+		header := requestHeader
+		if len(item.ETag) > 0 || len(item.LastModified) > 0 {
+			header = make(http.Header)
+			for headerKey, headerValues := range requestHeader {
+				header[headerKey] = headerValues
+			}
+
+			if len(item.ETag) > 0 {
+				header.Set(cacher.HeaderIfNoneMatch, item.ETag)
+			}
+			if len(item.LastModified) > 0 {
+				header.Set(cacher.HeaderIfModifiedSince, item.LastModified)
+			}
+		}
+
+		loginGeneration := c.ensureLogin()
+
+		input := &Input{
 			Client:      client,
-			Header:      requestHeader,
+			Header:      header,
+			MaxBodySize: c.GetMaxBodySize(),
 			NoCrossHost: c.noCrossHost.IsSet(),
+			Retries:     c.GetRetries(),
+			RetryDelay:  c.GetRetryDelay(),
 			Rewriter:    urlRewriter,
 			URL:         item.URL,
-		})
+
+			ShouldProcess: onURLShouldProcess,
+
+			// the body can only be streamed to a synchronous callback
+			StreamBody: onDownloaded != nil,
+		}
+
+		loggerContext.Debug("Downloading")
+		downloaded = Download(input)
+
+		if loginGeneration > 0 && c.checkLoginExpired(downloaded) {
+			loggerContext.Info("Session expired, logging in again")
+			_ = downloaded.Close()
+			c.relogin(loginGeneration)
+			downloaded = Download(input)
+		}
 		atomic.AddUint64(&c.downloadedCount, 1)
 	}
 
-	atomic.AddInt64(&c.downloadingCount, -1)
-
 	if downloaded != nil {
 		if downloaded.Error != nil {
 			loggerContext.WithFields(logrus.Fields{
-				"error":   downloaded.Error,
-				"elapsed": time.Since(start),
+				"error":    downloaded.Error,
+				"attempts": downloaded.Attempts,
+				"elapsed":  time.Since(start),
 			}).Error("Error downloading")
 		} else {
 			loggerContext.WithFields(logrus.Fields{
 				"statusCode": downloaded.StatusCode,
+				"attempts":   downloaded.Attempts,
 				"elapsed":    time.Since(start),
 				"total":      atomic.LoadUint64(&c.downloadedCount),
 			}).Info("Downloaded")
@@ -422,9 +881,16 @@ func (c *crawler) doDownload(item QueueItem) *Downloaded {
 
 		if onDownloaded != nil {
 			(*onDownloaded)(downloaded)
+			_ = downloaded.Close()
 		} else if c.IsRunning() {
 			c.output <- downloaded
 		}
+
+		if queued {
+			// streamed body has been consumed at this point,
+			// on demand downloads are requested by users and do not use up the crawl budget
+			c.recordHostBudget(downloaded)
+		}
 	}
 
 	return downloaded
@@ -436,14 +902,15 @@ func (c *crawler) doAutoQueue(workerID uint64, item QueueItem, downloaded *Downl
 	}
 
 	// use the same depth for asset links as they are required for proper rendering
-	c.doAutoQueueURLs(workerID, downloaded.GetAssetURLs(), downloaded.Input.URL, item.Depth)
+	c.doAutoQueueURLs(workerID, downloaded.GetAssetURLs(), downloaded.Input.URL, item.Depth, PriorityAsset)
 
 	// increase depth for other discovered links
 	// they will need to satisfy depth limit before crawling
-	c.doAutoQueueURLs(workerID, downloaded.GetDiscoveredURLs(), downloaded.Input.URL, item.Depth+1)
+	c.doAutoQueueURLs(workerID, downloaded.GetDiscoveredURLs(), downloaded.Input.URL, item.Depth+1,
+		PriorityDiscovered-int(item.Depth+1))
 }
 
-func (c *crawler) doAutoQueueURLs(workerID uint64, urls []*neturl.URL, source *neturl.URL, nextDepth uint64) {
+func (c *crawler) doAutoQueueURLs(workerID uint64, urls []*neturl.URL, source *neturl.URL, nextDepth uint64, priority int) {
 	var (
 		count         = len(urls)
 		loggerContext = c.logger.WithFields(logrus.Fields{
@@ -476,9 +943,24 @@ func (c *crawler) doAutoQueueURLs(workerID uint64, urls []*neturl.URL, source *n
 			}
 		}
 
+		if !c.checkRobotsTxtAllowed(url) {
+			loggerContext.WithField("url", url).Debug("Skipped as disallowed by robots.txt")
+			continue
+		}
+
+		if reason := c.checkHostBudget(url); len(reason) > 0 {
+			atomic.AddUint64(&c.budgetSkippedCount, 1)
+			loggerContext.WithFields(logrus.Fields{
+				"url":    url,
+				"reason": reason,
+			}).Debug("Skipped as host budget exhausted")
+			continue
+		}
+
 		c.doEnqueue(QueueItem{
-			URL:   url,
-			Depth: nextDepth,
+			URL:      url,
+			Depth:    nextDepth,
+			Priority: priority,
 		})
 
 		loggerContext.WithField("url", url).Debug("Auto-enqueued")
@@ -1,12 +1,19 @@
 package crawler_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	neturl "net/url"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/daohoangson/go-sitemirror/cacher"
 	. "github.com/daohoangson/go-sitemirror/crawler"
 	t "github.com/daohoangson/go-sitemirror/testing"
 	"github.com/jarcoal/httpmock"
@@ -63,6 +70,954 @@ var _ = Describe("Crawler", func() {
 		Expect(c.GetNoCrossHost()).To(BeTrue())
 	})
 
+	Describe("RespectRobotsTxt", func() {
+		It("should not respect by default", func() {
+			c := newCrawler()
+
+			Expect(c.GetRespectRobotsTxt()).To(BeFalse())
+		})
+
+		It("should skip disallowed link", func() {
+			url := "https://robots.domain.com/RespectRobotsTxt/skip"
+			urlAllowed := "https://robots.domain.com/RespectRobotsTxt/allowed"
+			urlDisallowed := "https://robots.domain.com/RespectRobotsTxt/private/disallowed"
+			html := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>", urlAllowed, urlDisallowed))
+			httpmock.RegisterResponder("GET", "https://robots.domain.com/robots.txt",
+				httpmock.NewStringResponder(200, "User-agent: *\nDisallow: /RespectRobotsTxt/private\n"))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+			httpmock.RegisterResponder("GET", urlAllowed, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", urlDisallowed, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetRespectRobotsTxt(true)
+			enqueueURL(c, url)
+			defer c.Stop()
+
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(url))
+
+			downloaded, _ = c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(urlAllowed))
+
+			time.Sleep(sleepTime)
+			Expect(c.IsBusy()).To(BeFalse())
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64Two))
+			Expect(c.GetDownloadedCount()).To(Equal(uint64Two))
+		})
+
+		It("should skip disallowed enqueued url", func() {
+			url := "https://robots.domain.com/RespectRobotsTxt/private/enqueued"
+			httpmock.RegisterResponder("GET", "https://robots.domain.com/robots.txt",
+				httpmock.NewStringResponder(200, "User-agent: *\nDisallow: /RespectRobotsTxt/private\n"))
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetRespectRobotsTxt(true)
+			parsedURL, _ := neturl.Parse(url)
+			c.Enqueue(QueueItem{URL: parsedURL, ForceDownload: true})
+			defer c.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(c.IsBusy()).To(BeFalse())
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64One))
+			Expect(c.GetDownloadedCount()).To(Equal(uint64Zero))
+		})
+
+		It("should allow all without robots.txt", func() {
+			url := "https://robots.domain.com/RespectRobotsTxt/no/robots"
+			urlTarget := "https://robots.domain.com/RespectRobotsTxt/no/robots/target"
+			html := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>", urlTarget))
+			httpmock.RegisterResponder("GET", "https://robots.domain.com/robots.txt",
+				httpmock.NewStringResponder(http.StatusNotFound, ""))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+			httpmock.RegisterResponder("GET", urlTarget, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetRespectRobotsTxt(true)
+			enqueueURL(c, url)
+			defer c.Stop()
+
+			c.Downloaded()
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(urlTarget))
+		})
+
+		It("should disallow all on server error", func() {
+			url := "https://robots.domain.com/RespectRobotsTxt/server/error"
+			httpmock.RegisterResponder("GET", "https://robots.domain.com/robots.txt",
+				httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetRespectRobotsTxt(true)
+			parsedURL, _ := neturl.Parse(url)
+			c.Enqueue(QueueItem{URL: parsedURL, ForceDownload: true})
+			defer c.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(c.IsBusy()).To(BeFalse())
+			Expect(c.GetDownloadedCount()).To(Equal(uint64Zero))
+		})
+
+		Context("RobotsTxtErrorTTL", func() {
+			var robotsTxtErrorTTL time.Duration
+
+			BeforeEach(func() {
+				robotsTxtErrorTTL = RobotsTxtErrorTTL
+				RobotsTxtErrorTTL = sleepTime
+			})
+
+			AfterEach(func() {
+				RobotsTxtErrorTTL = robotsTxtErrorTTL
+			})
+
+			It("should fetch again after network error", func() {
+				url := "https://robots.domain.com/RespectRobotsTxt/network/error"
+				urlDisallowed := "https://robots.domain.com/RespectRobotsTxt/private/network/error"
+				var requests int64
+				httpmock.RegisterResponder("GET", "https://robots.domain.com/robots.txt", func(req *http.Request) (*http.Response, error) {
+					if atomic.AddInt64(&requests, 1) == 1 {
+						return nil, errors.New("connection reset")
+					}
+					return httpmock.NewStringResponse(200, "User-agent: *\nDisallow: /RespectRobotsTxt/private\n"), nil
+				})
+				httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(200, ""))
+				httpmock.RegisterResponder("GET", urlDisallowed, httpmock.NewStringResponder(200, ""))
+
+				c := newCrawler()
+				c.SetRespectRobotsTxt(true)
+				defer c.Stop()
+
+				parsedURL, _ := neturl.Parse(url)
+				c.Enqueue(QueueItem{URL: parsedURL, ForceDownload: true})
+				downloaded, _ := c.Downloaded()
+				Expect(downloaded.Input.URL.String()).To(Equal(url))
+
+				time.Sleep(2 * sleepTime)
+				parsedURLDisallowed, _ := neturl.Parse(urlDisallowed)
+				c.Enqueue(QueueItem{URL: parsedURLDisallowed, ForceDownload: true})
+				Eventually(c.IsBusy).Should(BeFalse())
+				Expect(c.GetDownloadedCount()).To(Equal(uint64One))
+				Expect(atomic.LoadInt64(&requests)).To(Equal(int64(2)))
+			})
+		})
+
+		It("should wait for crawl delay", func() {
+			crawlDelay := 20 * time.Millisecond
+			url1 := "https://robots.domain.com/RespectRobotsTxt/crawl/delay/1"
+			url2 := "https://robots.domain.com/RespectRobotsTxt/crawl/delay/2"
+			httpmock.RegisterResponder("GET", "https://robots.domain.com/robots.txt",
+				httpmock.NewStringResponder(200, "User-agent: *\nCrawl-delay: 0.02\n"))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetRespectRobotsTxt(true)
+			start := time.Now()
+			enqueueURL(c, url1)
+			enqueueURL(c, url2)
+			defer c.Stop()
+
+			c.Downloaded()
+			c.Downloaded()
+			Expect(time.Since(start)).To(BeNumerically(">=", crawlDelay))
+		})
+
+		It("should not wait for crawl delay on demand", func() {
+			url := "https://robots.domain.com/RespectRobotsTxt/crawl/delay/on/demand"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", "https://robots.domain.com/robots.txt",
+				httpmock.NewStringResponder(200, "User-agent: *\nCrawl-delay: 10\n"))
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetRespectRobotsTxt(true)
+			c.Download(QueueItem{URL: parsedURL})
+
+			start := time.Now()
+			c.Download(QueueItem{URL: parsedURL})
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Describe("HostConcurrency", func() {
+		It("should not limit by default", func() {
+			c := newCrawler()
+
+			Expect(c.GetHostConcurrency()).To(Equal(uint64Zero))
+		})
+
+		It("should limit concurrent requests per host", func() {
+			var (
+				inFlight    int64
+				maxInFlight int64
+			)
+			responder := func(req *http.Request) (*http.Response, error) {
+				current := atomic.AddInt64(&inFlight, 1)
+				for {
+					max := atomic.LoadInt64(&maxInFlight)
+					if current <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, current) {
+						break
+					}
+				}
+
+				time.Sleep(sleepTime)
+				atomic.AddInt64(&inFlight, -1)
+
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			}
+			for i := 0; i < 3; i++ {
+				httpmock.RegisterResponder("GET", fmt.Sprintf("https://concurrency.domain.com/%d", i), responder)
+			}
+
+			c := newCrawler()
+			c.SetHostConcurrency(1)
+			for i := 0; i < 3; i++ {
+				enqueueURL(c, fmt.Sprintf("https://concurrency.domain.com/%d", i))
+			}
+			defer c.Stop()
+
+			for i := 0; i < 3; i++ {
+				c.Downloaded()
+			}
+			Expect(atomic.LoadInt64(&maxInFlight)).To(Equal(int64(1)))
+		})
+	})
+
+	Describe("CookieJar", func() {
+		var cookieJarPath string
+
+		var downloadURL = func(c Crawler, url string) *Downloaded {
+			parsedURL, err := neturl.Parse(url)
+			Expect(err).ToNot(HaveOccurred())
+
+			return c.Download(QueueItem{URL: parsedURL, ForceDownload: true})
+		}
+
+		var cookieResponder = func(value string) httpmock.Responder {
+			return func(req *http.Request) (*http.Response, error) {
+				resp := httpmock.NewStringResponse(http.StatusOK, "")
+				resp.Header.Set("Set-Cookie", fmt.Sprintf("session=%s; Path=/; Max-Age=3600", value))
+				return resp, nil
+			}
+		}
+
+		var sessionResponder = func(value string) httpmock.Responder {
+			return func(req *http.Request) (*http.Response, error) {
+				if cookie, err := req.Cookie("session"); err == nil && cookie.Value == value {
+					return httpmock.NewStringResponse(http.StatusOK, ""), nil
+				}
+
+				return httpmock.NewStringResponse(http.StatusForbidden, ""), nil
+			}
+		}
+
+		BeforeEach(func() {
+			dir, _ := os.MkdirTemp("", "_TestCrawlerCookieJar_")
+			cookieJarPath = filepath.Join(dir, "cookies")
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(filepath.Dir(cookieJarPath))
+		})
+
+		It("should not use cookie jar by default", func() {
+			c := newCrawler()
+
+			Expect(c.GetCookieJar()).To(BeNil())
+			Expect(c.GetCookieJarPath()).To(Equal(""))
+		})
+
+		It("should send cookies", func() {
+			url0 := "https://domain.com/crawler/cookies/0"
+			url1 := "https://domain.com/crawler/cookies/1"
+			httpmock.RegisterResponder("GET", url0, cookieResponder("foo"))
+			httpmock.RegisterResponder("GET", url1, sessionResponder("foo"))
+
+			c := newCrawler()
+			Expect(c.SetCookieJarPath("")).To(Succeed())
+
+			downloadURL(c, url0)
+			downloaded := downloadURL(c, url1)
+			Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+			Expect(http.DefaultClient.Jar).To(BeNil())
+		})
+
+		It("should persist cookies", func() {
+			url0 := "https://domain.com/crawler/cookies/persist/0"
+			url1 := "https://domain.com/crawler/cookies/persist/1"
+			httpmock.RegisterResponder("GET", url0, cookieResponder("bar"))
+			httpmock.RegisterResponder("GET", url1, sessionResponder("bar"))
+
+			c1 := newCrawler()
+			Expect(c1.SetCookieJarPath(cookieJarPath)).To(Succeed())
+			Expect(c1.GetCookieJarPath()).To(Equal(cookieJarPath))
+			downloadURL(c1, url0)
+
+			c2 := newCrawler()
+			Expect(c2.SetCookieJarPath(cookieJarPath)).To(Succeed())
+			downloaded := downloadURL(c2, url1)
+			Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("should not set cookie jar path (bad file)", func() {
+			_ = os.WriteFile(cookieJarPath, []byte("not json"), 0600)
+
+			c := newCrawler()
+			err := c.SetCookieJarPath(cookieJarPath)
+
+			Expect(err).To(HaveOccurred())
+		})
+
+		Describe("Login", func() {
+			const loginURL = "https://domain.com/crawler/login"
+
+			It("should not set relative login url", func() {
+				c := newCrawler()
+				relativeURL, _ := neturl.Parse("/login")
+				err := c.SetLogin(&Login{URL: relativeURL})
+
+				Expect(err).To(HaveOccurred())
+				Expect(c.GetLogin()).To(BeNil())
+			})
+
+			It("should redact form values", func() {
+				parsedLoginURL, _ := neturl.Parse(loginURL)
+				login := &Login{
+					URL:  parsedLoginURL,
+					Form: neturl.Values{"username": {"foo"}, "password": {"secret"}},
+				}
+
+				Expect(login.String()).To(Equal(loginURL + " [password username]"))
+			})
+
+			It("should login before download", func() {
+				url := "https://domain.com/crawler/login/before"
+				var loginForm neturl.Values
+				httpmock.RegisterResponder("POST", loginURL, func(req *http.Request) (*http.Response, error) {
+					_ = req.ParseForm()
+					loginForm = req.PostForm
+					return cookieResponder("user")(req)
+				})
+				httpmock.RegisterResponder("GET", url, sessionResponder("user"))
+
+				c := newCrawler()
+				parsedLoginURL, _ := neturl.Parse(loginURL)
+				Expect(c.SetLogin(&Login{
+					URL:  parsedLoginURL,
+					Form: neturl.Values{"username": {"foo"}, "password": {"bar"}},
+				})).To(Succeed())
+				Expect(c.GetCookieJar()).ToNot(BeNil())
+
+				downloaded := downloadURL(c, url)
+				Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+				Expect(loginForm.Get("username")).To(Equal("foo"))
+				Expect(loginForm.Get("password")).To(Equal("bar"))
+			})
+
+			It("should login again after session expired", func() {
+				url := "https://domain.com/crawler/login/expired"
+				var loginCount int64
+				httpmock.RegisterResponder("POST", loginURL, func(req *http.Request) (*http.Response, error) {
+					count := atomic.AddInt64(&loginCount, 1)
+					return cookieResponder(fmt.Sprintf("%d", count))(req)
+				})
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					if cookie, err := req.Cookie("session"); err == nil && cookie.Value == "2" {
+						return httpmock.NewStringResponse(http.StatusOK, ""), nil
+					}
+
+					resp := httpmock.NewStringResponse(http.StatusFound, "")
+					resp.Header.Set("Location", "/crawler/login?next=expired")
+					return resp, nil
+				})
+
+				c := newCrawler()
+				parsedLoginURL, _ := neturl.Parse(loginURL)
+				Expect(c.SetLogin(&Login{URL: parsedLoginURL})).To(Succeed())
+
+				downloaded := downloadURL(c, url)
+				Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+				Expect(atomic.LoadInt64(&loginCount)).To(Equal(int64(2)))
+			})
+
+			It("should login again after failure", func() {
+				url := "https://domain.com/crawler/login/failure"
+				var loginCount int64
+				httpmock.RegisterResponder("POST", loginURL, func(req *http.Request) (*http.Response, error) {
+					if atomic.AddInt64(&loginCount, 1) == 1 {
+						return httpmock.NewStringResponse(http.StatusInternalServerError, ""), nil
+					}
+
+					return cookieResponder("user")(req)
+				})
+				httpmock.RegisterResponder("GET", url, sessionResponder("user"))
+
+				c := newCrawler()
+				parsedLoginURL, _ := neturl.Parse(loginURL)
+				Expect(c.SetLogin(&Login{URL: parsedLoginURL})).To(Succeed())
+
+				downloaded := downloadURL(c, url)
+				Expect(downloaded.StatusCode).ToNot(Equal(http.StatusOK))
+
+				downloaded = downloadURL(c, url)
+				Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+				Expect(atomic.LoadInt64(&loginCount)).To(Equal(int64(2)))
+			})
+		})
+	})
+
+	Describe("Dedup", func() {
+		It("should set drop tracking params", func() {
+			c := newCrawler()
+			c.SetDropTrackingParams(true)
+
+			Expect(c.GetDropTrackingParams()).To(BeTrue())
+		})
+
+		It("should enqueue normalized url once", func() {
+			url := "https://domain.com/crawler/dedup?a=1&b=2"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c := newCrawler()
+			defer c.Stop()
+			enqueueURL(c, url)
+			enqueueURL(c, "https://DOMAIN.com:443/crawler/dedup?b=2&a=1#foo")
+
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.Input.URL.String()).To(Equal(url))
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64One))
+		})
+
+		It("should dedup without tracking params", func() {
+			url := "https://domain.com/crawler/dedup/tracking"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c := newCrawler()
+			c.SetDropTrackingParams(true)
+			defer c.Stop()
+			enqueueURL(c, url+"?utm_source=foo")
+			enqueueURL(c, url+"?utm_source=bar")
+
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.Input.URL.String()).To(Equal(url + "?utm_source=foo"))
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64One))
+		})
+
+		Context("SeenCapacity", func() {
+			var seenCapacity int
+
+			BeforeEach(func() {
+				seenCapacity = SeenCapacity
+				SeenCapacity = 10
+			})
+
+			AfterEach(func() {
+				SeenCapacity = seenCapacity
+			})
+
+			It("should forget old urls", func() {
+				c := newCrawler()
+				c.SetOnURLShouldDownload(func(_ *neturl.URL) bool { return false })
+				defer c.Stop()
+
+				enqueueURL(c, "https://domain.com/crawler/dedup/forget")
+				for i := 0; i < SeenCapacity; i++ {
+					enqueueURL(c, fmt.Sprintf("https://domain.com/crawler/dedup/forget/%d", i))
+				}
+				enqueueURL(c, "https://domain.com/crawler/dedup/forget")
+
+				Expect(c.GetEnqueuedCount()).To(Equal(uint64(SeenCapacity + 2)))
+			})
+
+			It("should remember frequent urls", func() {
+				c := newCrawler()
+				c.SetOnURLShouldDownload(func(_ *neturl.URL) bool { return false })
+				defer c.Stop()
+
+				for i := 0; i < SeenCapacity; i++ {
+					enqueueURL(c, "https://domain.com/crawler/dedup/frequent")
+					enqueueURL(c, fmt.Sprintf("https://domain.com/crawler/dedup/frequent/%d", i))
+				}
+
+				Expect(c.GetEnqueuedCount()).To(Equal(uint64(SeenCapacity + 1)))
+			})
+		})
+
+		It("should enqueue forced duplicate", func() {
+			url := "https://domain.com/crawler/dedup/force"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c := newCrawler()
+			defer c.Stop()
+			c.Enqueue(QueueItem{URL: parsedURL})
+			c.Enqueue(QueueItem{URL: parsedURL, ForceDownload: true})
+
+			c.Downloaded()
+			c.Downloaded()
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64Two))
+		})
+
+		It("should enqueue again after error", func() {
+			url := "https://domain.com/crawler/dedup/error"
+			httpmock.RegisterResponder("GET", url, httpmock.NewErrorResponder(errors.New("foo")))
+
+			c := newCrawler()
+			defer c.Stop()
+			enqueueURL(c, url)
+			c.Downloaded()
+			time.Sleep(sleepTime)
+			enqueueURL(c, url)
+
+			c.Downloaded()
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64Two))
+		})
+	})
+
+	Describe("Frontier", func() {
+		var frontierPath string
+
+		BeforeEach(func() {
+			dir, _ := os.MkdirTemp("", "_TestCrawlerFrontier_")
+			frontierPath = filepath.Join(dir, "frontier")
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(filepath.Dir(frontierPath))
+		})
+
+		It("should set frontier path", func() {
+			c := newCrawler()
+			err := c.SetFrontierPath(cacher.NewFs(), frontierPath)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.GetFrontierPath()).To(Equal(frontierPath))
+		})
+
+		It("should not set frontier path (no dir)", func() {
+			c := newCrawler()
+			err := c.SetFrontierPath(cacher.NewFs(), filepath.Join(frontierPath, "no", "dir"))
+
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should resume in-progress item", func() {
+			url := "https://domain.com/crawler/frontier/resume"
+			var requestCount int64
+			release := make(chan interface{})
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				if atomic.AddInt64(&requestCount, 1) == 1 {
+					// the first crawler never finishes
+					<-release
+				}
+
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+			defer close(release)
+
+			c1 := newCrawler()
+			c1.SetOnDownloaded(func(_ *Downloaded) {})
+			_ = c1.SetFrontierPath(cacher.NewFs(), frontierPath)
+			enqueueURL(c1, url)
+			defer c1.Stop()
+			time.Sleep(sleepTime)
+
+			c2 := newCrawler()
+			_ = c2.SetFrontierPath(cacher.NewFs(), frontierPath)
+			defer c2.Stop()
+
+			downloaded, _ := c2.Downloaded()
+			Expect(downloaded.Input.URL.String()).To(Equal(url))
+			Expect(c2.GetEnqueuedCount()).To(Equal(uint64One))
+		})
+
+		It("should keep depth", func() {
+			url := "https://domain.com/crawler/frontier/depth"
+			parsedURL, _ := neturl.Parse(url)
+			html := t.NewHTMLMarkup(`<a href="/crawler/frontier/depth/link">Link</a>`)
+			var requestCount int64
+			release := make(chan interface{})
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				if atomic.AddInt64(&requestCount, 1) == 1 {
+					<-release
+				}
+
+				return t.NewHTMLResponder(html)(req)
+			})
+			defer close(release)
+
+			c1 := newCrawler()
+			c1.SetOnDownloaded(func(_ *Downloaded) {})
+			_ = c1.SetFrontierPath(cacher.NewFs(), frontierPath)
+			c1.Enqueue(QueueItem{URL: parsedURL, Depth: 1})
+			defer c1.Stop()
+			time.Sleep(sleepTime)
+
+			c2 := newCrawler()
+			c2.SetAutoDownloadDepth(1)
+			_ = c2.SetFrontierPath(cacher.NewFs(), frontierPath)
+			defer c2.Stop()
+
+			c2.Downloaded()
+			time.Sleep(sleepTime)
+			Expect(c2.GetLinkFoundCount()).To(Equal(uint64One))
+			Expect(c2.GetEnqueuedCount()).To(Equal(uint64One))
+		})
+
+		It("should skip visited url", func() {
+			url := "https://domain.com/crawler/frontier/visited"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c1 := newCrawler()
+			_ = c1.SetFrontierPath(cacher.NewFs(), frontierPath)
+			enqueueURL(c1, url)
+			c1.Downloaded()
+			time.Sleep(sleepTime)
+			c1.Stop()
+
+			c2 := newCrawler()
+			_ = c2.SetFrontierPath(cacher.NewFs(), frontierPath)
+			defer c2.Stop()
+			enqueueURL(c2, url)
+			Expect(c2.GetEnqueuedCount()).To(Equal(uint64Zero))
+
+			parsedURL, _ := neturl.Parse(url)
+			c2.Enqueue(QueueItem{URL: parsedURL, ForceDownload: true})
+			c2.Downloaded()
+			Expect(c2.GetEnqueuedCount()).To(Equal(uint64One))
+		})
+		It("should use fs", func() {
+			fs := t.NewFs()
+			c := newCrawler()
+			err := c.SetFrontierPath(fs, "/frontier")
+			Expect(err).ToNot(HaveOccurred())
+			c.Stop()
+
+			_, readError := t.FsReadFile(fs, "/frontier")
+			Expect(readError).ToNot(HaveOccurred())
+		})
+
+		It("should compact journal", func() {
+			threshold := FrontierCompactThreshold
+			FrontierCompactThreshold = 10
+			defer func() { FrontierCompactThreshold = threshold }()
+
+			fs := t.NewFs()
+			c := newCrawler()
+			c.SetOnURLShouldDownload(func(_ *neturl.URL) bool { return false })
+			_ = c.SetFrontierPath(fs, "/frontier")
+
+			for i := 0; i < FrontierCompactThreshold*2; i++ {
+				enqueueURL(c, fmt.Sprintf("https://domain.com/crawler/frontier/compact/%d", i))
+			}
+			Eventually(c.IsBusy).Should(BeFalse())
+			c.Stop()
+
+			journal, _ := t.FsReadFile(fs, "/frontier")
+			// pushes of done items must have been compacted away
+			Expect(bytes.Count(journal, []byte(`"op":"push"`))).To(BeNumerically("<=", FrontierCompactThreshold))
+		})
+
+		It("should keep only latest visited urls", func() {
+			threshold := FrontierCompactThreshold
+			FrontierCompactThreshold = 10
+			seenCapacity := SeenCapacity
+			SeenCapacity = 10
+			defer func() {
+				FrontierCompactThreshold = threshold
+				SeenCapacity = seenCapacity
+			}()
+
+			fs := t.NewFs()
+			c := newCrawler()
+			c.SetOnDownloaded(func(_ *Downloaded) {})
+			_ = c.SetFrontierPath(fs, "/frontier")
+
+			urlCount := 100
+			for i := 0; i < urlCount; i++ {
+				url := fmt.Sprintf("https://domain.com/crawler/frontier/visited/%d", i)
+				httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+				enqueueURL(c, url)
+			}
+			Eventually(c.IsBusy).Should(BeFalse())
+			c.Stop()
+
+			journal, _ := t.FsReadFile(fs, "/frontier")
+			Expect(bytes.Count(journal, []byte(`"op":"visit"`))).To(BeNumerically("<", urlCount/2))
+		})
+	})
+
+	Describe("HostBudget", func() {
+		It("should not limit by default", func() {
+			c := newCrawler()
+
+			Expect(c.GetHostMaxBytes()).To(Equal(uint64Zero))
+			Expect(c.GetHostMaxPages()).To(Equal(uint64Zero))
+		})
+
+		It("should set max bytes and pages", func() {
+			c := newCrawler()
+			c.SetHostMaxBytes(1024)
+			c.SetHostMaxPages(10)
+
+			Expect(c.GetHostMaxBytes()).To(Equal(uint64(1024)))
+			Expect(c.GetHostMaxPages()).To(Equal(uint64(10)))
+		})
+
+		It("should stop enqueueing after max pages", func() {
+			url := "https://domain.com/crawler/budget/pages"
+			targetURL := "https://domain.com/crawler/budget/pages/target"
+			otherURL := "https://other.domain.com/crawler/budget/pages/other"
+			html := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>", targetURL, otherURL))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+			httpmock.RegisterResponder("GET", targetURL, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", otherURL, t.NewHTMLResponder(t.NewHTMLMarkup("")))
+
+			c := newCrawler()
+			c.SetHostMaxPages(1)
+			enqueueURL(c, url)
+			defer c.Stop()
+
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(url))
+
+			downloaded, _ = c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(otherURL))
+
+			time.Sleep(sleepTime)
+			Expect(c.IsBusy()).To(BeFalse())
+
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64Two))
+			Expect(c.GetBudgetSkippedCount()).To(Equal(uint64One))
+			Expect(c.GetHostsBudgetExhausted()).To(Equal(map[string]string{
+				"domain.com":       BudgetExhaustedPages,
+				"other.domain.com": BudgetExhaustedPages,
+			}))
+		})
+
+		It("should skip queued items after max pages", func() {
+			url1 := "https://domain.com/crawler/budget/pages/queued/1"
+			url2 := "https://domain.com/crawler/budget/pages/queued/2"
+			var requestCount int64
+			for _, url := range []string{url1, url2} {
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					atomic.AddInt64(&requestCount, 1)
+					return t.NewHTMLResponder(t.NewHTMLMarkup(""))(req)
+				})
+			}
+
+			c := newCrawler()
+			_ = c.SetWorkerCount(1)
+			c.SetHostMaxPages(1)
+			enqueueURL(c, url1)
+			enqueueURL(c, url2)
+			defer c.Stop()
+
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(url1))
+
+			Eventually(c.IsBusy).Should(BeFalse())
+			Expect(atomic.LoadInt64(&requestCount)).To(Equal(int64(1)))
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64Two))
+			Expect(c.GetBudgetSkippedCount()).To(Equal(uint64One))
+		})
+
+		It("should not count assets as pages", func() {
+			url := "https://domain.com/crawler/budget/pages/assets"
+			imgURL := "https://domain.com/crawler/budget/pages/assets/img.png"
+			html := t.NewHTMLMarkup(fmt.Sprintf("<img src=\"%s\">", imgURL))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+			httpmock.RegisterResponder("GET", imgURL, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetHostMaxPages(2)
+			enqueueURL(c, url)
+			defer c.Stop()
+
+			c.Downloaded()
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(imgURL))
+
+			time.Sleep(sleepTime)
+			Expect(c.GetHostsBudgetExhausted()).To(BeEmpty())
+		})
+
+		It("should not count on demand downloads", func() {
+			url := "https://domain.com/crawler/budget/pages/on/demand"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(t.NewHTMLMarkup("")))
+
+			c := newCrawler()
+			c.SetHostMaxPages(1)
+			defer c.Stop()
+			c.Download(QueueItem{URL: parsedURL})
+
+			Expect(c.GetHostsBudgetExhausted()).To(BeEmpty())
+		})
+
+		It("should stop enqueueing after max bytes", func() {
+			url := "https://domain.com/crawler/budget/bytes"
+			targetURL := "https://domain.com/crawler/budget/bytes/target"
+			html := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>", targetURL))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+			httpmock.RegisterResponder("GET", targetURL, httpmock.NewStringResponder(200, ""))
+
+			c := newCrawler()
+			c.SetHostMaxBytes(uint64(len(html)))
+			enqueueURL(c, url)
+			defer c.Stop()
+
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.BaseURL.String()).To(Equal(url))
+
+			time.Sleep(sleepTime)
+			Expect(c.IsBusy()).To(BeFalse())
+
+			Expect(c.GetEnqueuedCount()).To(Equal(uint64One))
+			Expect(c.GetBudgetSkippedCount()).To(Equal(uint64One))
+			Expect(c.GetHostsBudgetExhausted()).To(Equal(map[string]string{
+				"domain.com": BudgetExhaustedBytes,
+			}))
+		})
+	})
+
+	Describe("HostRequestsPerSecond", func() {
+		It("should not limit by default", func() {
+			c := newCrawler()
+
+			Expect(c.GetHostRequestsPerSecond()).To(Equal(float64(0)))
+		})
+
+		It("should not accept negative", func() {
+			c := newCrawler()
+			err := c.SetHostRequestsPerSecond(-1)
+
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should limit requests per host", func() {
+			rps := float64(50)
+			interval := time.Duration(float64(time.Second) / rps)
+			for i := 0; i < 3; i++ {
+				httpmock.RegisterResponder("GET", fmt.Sprintf("https://rps.domain.com/%d", i),
+					httpmock.NewStringResponder(http.StatusOK, ""))
+			}
+
+			c := newCrawler()
+			_ = c.SetHostRequestsPerSecond(rps)
+			Expect(c.GetHostRequestsPerSecond()).To(Equal(rps))
+
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				enqueueURL(c, fmt.Sprintf("https://rps.domain.com/%d", i))
+			}
+			defer c.Stop()
+
+			for i := 0; i < 3; i++ {
+				c.Downloaded()
+			}
+			Expect(time.Since(start)).To(BeNumerically(">=", 2*interval))
+		})
+
+		It("should serve other hosts while throttled", func() {
+			urlThrottled1 := "https://rps.throttled.com/1"
+			urlThrottled2 := "https://rps.throttled.com/2"
+			urlOther := "https://rps.other.com/"
+			httpmock.RegisterResponder("GET", urlThrottled1, httpmock.NewStringResponder(http.StatusOK, ""))
+			httpmock.RegisterResponder("GET", urlThrottled2, httpmock.NewStringResponder(http.StatusOK, ""))
+			httpmock.RegisterResponder("GET", urlOther, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c := newCrawler()
+			_ = c.SetHostRequestsPerSecond(0.1)
+			enqueueURL(c, urlThrottled1)
+			enqueueURL(c, urlThrottled2)
+			enqueueURL(c, urlOther)
+			defer c.Stop()
+
+			downloadedURLs := make(map[string]bool)
+			for i := 0; i < 2; i++ {
+				downloaded, _ := c.Downloaded()
+				downloadedURLs[downloaded.Input.URL.String()] = true
+			}
+			Expect(downloadedURLs).To(HaveKey(urlThrottled1))
+			Expect(downloadedURLs).To(HaveKey(urlOther))
+		})
+	})
+
+	Describe("MaxBodySize", func() {
+		It("should set max body size", func() {
+			c := newCrawler()
+			c.SetMaxBodySize(uint64Two)
+
+			Expect(c.GetMaxBodySize()).To(Equal(uint64Two))
+		})
+
+		It("should stream body to OnDownloaded", func() {
+			url := "https://domain.com/crawler/max/body/size/stream"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+			var body []byte
+			c := newCrawler()
+			c.SetOnDownloaded(func(downloaded *Downloaded) {
+				body, _ = io.ReadAll(downloaded.BodyReader)
+			})
+			downloaded := c.Download(QueueItem{URL: parsedURL})
+
+			Expect(downloaded.Body).To(BeEmpty())
+			Expect(string(body)).To(Equal("foo"))
+		})
+
+		It("should stop streaming body", func() {
+			url := "https://domain.com/crawler/max/body/size/stop"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+			var readError error
+			c := newCrawler()
+			c.SetMaxBodySize(uint64Two)
+			c.SetOnDownloaded(func(downloaded *Downloaded) {
+				_, readError = io.ReadAll(downloaded.BodyReader)
+			})
+			c.Download(QueueItem{URL: parsedURL})
+
+			Expect(readError).To(Equal(ErrBodyTooLarge))
+		})
+	})
+
+	Describe("Retries", func() {
+		It("should not retry by default", func() {
+			c := newCrawler()
+
+			Expect(c.GetRetries()).To(Equal(uint64Zero))
+		})
+
+		It("should set retries", func() {
+			c := newCrawler()
+			c.SetRetries(uint64Two)
+			c.SetRetryDelay(time.Millisecond)
+
+			Expect(c.GetRetries()).To(Equal(uint64Two))
+			Expect(c.GetRetryDelay()).To(Equal(time.Millisecond))
+		})
+
+		It("should download with retries", func() {
+			url := "https://domain.com/crawler/retries"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+
+			c := newCrawler()
+			c.SetRetries(uint64Two)
+			c.SetRetryDelay(time.Millisecond)
+			downloaded := c.Download(QueueItem{URL: parsedURL})
+
+			Expect(downloaded.Attempts).To(Equal(uint64(3)))
+		})
+	})
+
 	Describe("RequestHeader", func() {
 		var (
 			requestHeaderKey  string
@@ -142,23 +1097,238 @@ var _ = Describe("Crawler", func() {
 			Expect(err).To(HaveOccurred())
 		})
 
-		It("should not work after Start", func() {
+		It("should work after Start", func() {
 			c := newCrawler()
 			c.Start()
 			defer c.Stop()
 
 			time.Sleep(sleepTime)
 			err := c.SetWorkerCount(1)
-			Expect(err).To(HaveOccurred())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.GetWorkerCount()).To(Equal(uint64One))
 		})
 
-		It("should work", func() {
-			workerCount := uint64One
+		Describe("Resize", func() {
+			var registerBlockingResponder = func(url string, started chan<- string, release <-chan bool) {
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					started <- req.URL.String()
+					<-release
+					return httpmock.NewStringResponse(http.StatusOK, ""), nil
+				})
+			}
+
+			It("should add workers", func() {
+				url1 := "https://domain.com/crawler/workers/add/1"
+				url2 := "https://domain.com/crawler/workers/add/2"
+				started := make(chan string, 2)
+				release := make(chan bool)
+				registerBlockingResponder(url1, started, release)
+				registerBlockingResponder(url2, started, release)
+
+				c := newCrawler()
+				_ = c.SetWorkerCount(1)
+				c.SetOnDownloaded(func(_ *Downloaded) {})
+				defer c.Stop()
+
+				enqueueURL(c, url1)
+				enqueueURL(c, url2)
+				<-started
+				Consistently(started, sleepTime).ShouldNot(Receive())
+
+				Expect(c.SetWorkerCount(2)).To(Succeed())
+				Eventually(started).Should(Receive())
+
+				close(release)
+				Eventually(c.GetDownloadedCount).Should(Equal(uint64Two))
+			})
+
+			It("should remove workers", func() {
+				url1 := "https://domain.com/crawler/workers/remove/1"
+				url2 := "https://domain.com/crawler/workers/remove/2"
+				started := make(chan string, 2)
+				release := make(chan bool)
+				registerBlockingResponder(url1, started, release)
+				registerBlockingResponder(url2, started, release)
+
+				c := newCrawler()
+				_ = c.SetWorkerCount(2)
+				c.SetOnDownloaded(func(_ *Downloaded) {})
+				c.Start()
+				defer c.Stop()
+
+				time.Sleep(sleepTime)
+				Expect(c.SetWorkerCount(1)).To(Succeed())
+
+				enqueueURL(c, url1)
+				enqueueURL(c, url2)
+				<-started
+				Consistently(started, sleepTime).ShouldNot(Receive())
+
+				close(release)
+				Eventually(c.GetDownloadedCount).Should(Equal(uint64Two))
+			})
+		})
+	})
+
+	Describe("Priority", func() {
+		It("should download higher priority first", func() {
+			urlBlocker := "https://domain.com/crawler/priority/blocker"
+			urlLow := "https://domain.com/crawler/priority/low"
+			urlAsset := "https://domain.com/crawler/priority/asset"
+			urlRefresh := "https://domain.com/crawler/priority/refresh"
+			urlDiscovered := "https://domain.com/crawler/priority/discovered"
+			started := make(chan bool)
+			release := make(chan bool)
+			httpmock.RegisterResponder("GET", urlBlocker, func(req *http.Request) (*http.Response, error) {
+				started <- true
+				<-release
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+			for _, url := range []string{urlLow, urlAsset, urlRefresh, urlDiscovered} {
+				httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+			}
 
 			c := newCrawler()
-			err := c.SetWorkerCount(workerCount)
-			Expect(err).ToNot(HaveOccurred())
-			Expect(c.GetWorkerCount()).To(Equal(workerCount))
+			_ = c.SetWorkerCount(1)
+			defer c.Stop()
+
+			enqueueURL(c, urlBlocker)
+			<-started
+
+			for _, item := range []struct {
+				url      string
+				priority int
+			}{
+				{urlLow, PriorityDiscovered - 2},
+				{urlAsset, PriorityAsset},
+				{urlDiscovered, PriorityDiscovered - 1},
+				{urlRefresh, PriorityRefresh},
+			} {
+				parsedURL, _ := neturl.Parse(item.url)
+				c.Enqueue(QueueItem{URL: parsedURL, Priority: item.priority})
+			}
+			close(release)
+
+			urls := make([]string, 0)
+			for i := 0; i < 5; i++ {
+				downloaded, _ := c.Downloaded()
+				urls = append(urls, downloaded.Input.URL.String())
+			}
+			Expect(urls).To(Equal([]string{urlBlocker, urlRefresh, urlAsset, urlDiscovered, urlLow}))
+		})
+
+		It("should download same priority in order", func() {
+			urlBlocker := "https://domain.com/crawler/priority/same/blocker"
+			url1 := "https://domain.com/crawler/priority/same/1"
+			url2 := "https://domain.com/crawler/priority/same/2"
+			url3 := "https://domain.com/crawler/priority/same/3"
+			started := make(chan bool)
+			release := make(chan bool)
+			httpmock.RegisterResponder("GET", urlBlocker, func(req *http.Request) (*http.Response, error) {
+				started <- true
+				<-release
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+			for _, url := range []string{url1, url2, url3} {
+				httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+			}
+
+			c := newCrawler()
+			_ = c.SetWorkerCount(1)
+			defer c.Stop()
+
+			enqueueURL(c, urlBlocker)
+			<-started
+			enqueueURL(c, url1)
+			enqueueURL(c, url2)
+			enqueueURL(c, url3)
+			close(release)
+
+			urls := make([]string, 0)
+			for i := 0; i < 4; i++ {
+				downloaded, _ := c.Downloaded()
+				urls = append(urls, downloaded.Input.URL.String())
+			}
+			Expect(urls).To(Equal([]string{urlBlocker, url1, url2, url3}))
+		})
+	})
+
+	Describe("Pause", func() {
+		It("should not pause by default", func() {
+			c := newCrawler()
+
+			Expect(c.IsPaused()).To(BeFalse())
+		})
+
+		It("should pause and resume", func() {
+			url := "https://domain.com/crawler/pause"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c := newCrawler()
+			c.Pause()
+			Expect(c.IsPaused()).To(BeTrue())
+			defer c.Stop()
+
+			enqueueURL(c, url)
+			time.Sleep(sleepTime)
+			Expect(c.GetDownloadedCount()).To(Equal(uint64Zero))
+			Expect(c.IsBusy()).To(BeTrue())
+
+			c.Resume()
+			Expect(c.IsPaused()).To(BeFalse())
+			downloaded, _ := c.Downloaded()
+			Expect(downloaded.Input.URL.String()).To(Equal(url))
+		})
+
+		It("should download on demand while paused", func() {
+			url := "https://domain.com/crawler/pause/on/demand"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c := newCrawler()
+			c.Pause()
+
+			downloaded := c.Download(QueueItem{URL: parsedURL})
+			Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("should stop while paused", func() {
+			url := "https://domain.com/crawler/pause/stop"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			c := newCrawler()
+			c.Pause()
+			enqueueURL(c, url)
+			Expect(c.IsBusy()).To(BeTrue())
+
+			c.Stop()
+			Expect(c.IsBusy()).To(BeFalse())
+			Expect(c.GetDownloadedCount()).To(Equal(uint64Zero))
+		})
+	})
+
+	Describe("Conditional", func() {
+		It("should send validators", func() {
+			url := "https://domain.com/crawler/conditional"
+			parsedURL, _ := neturl.Parse(url)
+			etag := `"foo"`
+			lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				if req.Header.Get("If-None-Match") == etag &&
+					req.Header.Get("If-Modified-Since") == lastModified {
+					return httpmock.NewStringResponse(http.StatusNotModified, ""), nil
+				}
+
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+			c := newCrawler()
+			downloaded := c.Download(QueueItem{URL: parsedURL, ETag: etag, LastModified: lastModified})
+			Expect(downloaded.StatusCode).To(Equal(http.StatusNotModified))
+
+			downloaded = c.Download(QueueItem{URL: parsedURL})
+			Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+			Expect(c.GetRequestHeaderValues("If-None-Match")).To(BeNil())
 		})
 	})
 
@@ -2,10 +2,13 @@ package crawler
 
 import (
 	"bytes"
+	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/daohoangson/go-sitemirror/cacher"
 	"time"
 )
 
@@ -16,8 +19,33 @@ type Crawler interface {
 	GetClientTimeout() time.Duration
 	SetAutoDownloadDepth(uint64)
 	GetAutoDownloadDepth() uint64
+	SetCookieJarPath(string) error
+	GetCookieJarPath() string
+	GetCookieJar() http.CookieJar
+	SetDropTrackingParams(bool)
+	GetDropTrackingParams() bool
+	SetFrontierPath(cacher.Fs, string) error
+	GetFrontierPath() string
+	SetHostConcurrency(uint64)
+	GetHostConcurrency() uint64
+	SetHostMaxBytes(uint64)
+	GetHostMaxBytes() uint64
+	SetHostMaxPages(uint64)
+	GetHostMaxPages() uint64
+	SetHostRequestsPerSecond(float64) error
+	GetHostRequestsPerSecond() float64
+	SetLogin(*Login) error
+	GetLogin() *Login
+	SetMaxBodySize(uint64)
+	GetMaxBodySize() uint64
 	SetNoCrossHost(bool)
 	GetNoCrossHost() bool
+	SetRespectRobotsTxt(bool)
+	GetRespectRobotsTxt() bool
+	SetRetries(uint64)
+	GetRetries() uint64
+	SetRetryDelay(time.Duration)
+	GetRetryDelay() time.Duration
 	AddRequestHeader(string, string)
 	SetRequestHeader(string, string)
 	GetRequestHeaderValues(string) []string
@@ -26,6 +54,7 @@ type Crawler interface {
 
 	SetURLRewriter(func(*url.URL))
 	SetOnURLShouldQueue(func(*url.URL) bool)
+	SetOnURLShouldProcess(func(*url.URL) bool)
 	SetOnURLShouldDownload(func(*url.URL) bool)
 	SetOnDownload(func(*url.URL))
 	SetOnDownloaded(func(*Downloaded))
@@ -33,6 +62,8 @@ type Crawler interface {
 	GetEnqueuedCount() uint64
 	GetDownloadedCount() uint64
 	GetLinkFoundCount() uint64
+	GetBudgetSkippedCount() uint64
+	GetHostsBudgetExhausted() map[string]string
 	HasStarted() bool
 	HasStopped() bool
 	IsRunning() bool
@@ -40,8 +71,13 @@ type Crawler interface {
 
 	Start()
 	Stop()
+	Pause()
+	Resume()
+	IsPaused() bool
 	Enqueue(QueueItem)
 	Download(QueueItem) *Downloaded
+	GetSitemapURLs(*url.URL) []*url.URL
+	DownloadSitemap(*url.URL) (*Sitemap, error)
 	Downloaded() (*Downloaded, bool)
 	DownloadedNotBlocking() *Downloaded
 }
@@ -51,21 +87,51 @@ type QueueItem struct {
 	URL           *url.URL
 	Depth         uint64
 	ForceDownload bool
+
+	// Priority items are popped first, see PriorityOnDemand etc.
+	Priority int
+
+	// ETag and LastModified are validators of the cached data,
+	// they are used to make a conditional request.
+	ETag         string
+	LastModified string
+}
+
+// Login represents a form to be submitted before crawling authenticated pages
+type Login struct {
+	URL  *url.URL
+	Form url.Values
+
+	// ExpiredPattern matches redirect locations of expired sessions,
+	// defaults to redirects to .URL
+	ExpiredPattern *regexp.Regexp
 }
 
 // Input represents a download request ready to be processed
 type Input struct {
 	Client      *http.Client
 	Header      http.Header
+	MaxBodySize uint64
 	NoCrossHost bool
+	Retries     uint64
+	RetryDelay  time.Duration
 	Rewriter    *func(*url.URL)
 	URL         *url.URL
+
+	// ShouldProcess is called with resolved link urls, returning false leaves the link
+	// untouched: it is neither rewritten nor recorded for download
+	ShouldProcess *func(*url.URL) bool
+
+	// StreamBody makes non-parsed body available via .BodyReader of the result,
+	// the caller must consume it before calling .Close
+	StreamBody bool
 }
 
 // Downloaded represents processed data after downloading
 type Downloaded struct {
 	Input *Input
 
+	Attempts        uint64
 	BaseURL         *url.URL
 	Body            string
 	Error           error
@@ -73,11 +139,55 @@ type Downloaded struct {
 	LinksDiscovered map[string]Link
 	StatusCode      int
 
+	// BodyReader is used instead of .Body for streamed non-parsed body
+	BodyReader io.Reader
+
 	buffer                  *bytes.Buffer
+	bodyCloser              io.Closer
+	bodySize                uint64
+	charset                 string
 	header                  http.Header
 	addedHeaderCrossHostRef bool
 }
 
+const (
+	// PriorityOnDemand priority of items requested by users
+	PriorityOnDemand = 300
+	// PriorityRefresh priority of items to refresh expired cache
+	PriorityRefresh = 200
+	// PriorityAsset priority of asset links
+	PriorityAsset = 100
+	// PriorityDiscovered priority of discovered links, it is lowered by one for each depth level
+	PriorityDiscovered = 0
+)
+
+const (
+	// BudgetExhaustedPages reason when a host has reached its maximum number of pages
+	BudgetExhaustedPages = "max pages"
+	// BudgetExhaustedBytes reason when a host has reached its maximum total bytes
+	BudgetExhaustedBytes = "max bytes"
+)
+
+// RobotsTxt represents robots.txt rules for a single user agent
+type RobotsTxt struct {
+	CrawlDelay time.Duration
+	Sitemaps   []*url.URL
+
+	rules []robotsTxtRule
+}
+
+// Sitemap represents parsed data from a sitemap or a sitemap index
+type Sitemap struct {
+	URLs     []SitemapURL
+	Sitemaps []SitemapURL
+}
+
+// SitemapURL represents an entry from sitemap
+type SitemapURL struct {
+	Loc     *url.URL
+	LastMod *time.Time
+}
+
 // Link represents an extracted link from download result
 type Link struct {
 	Context urlContext
@@ -85,18 +195,50 @@ type Link struct {
 }
 
 const (
+	// CSSImageSet url from image-set("")
+	CSSImageSet urlContext = 1 + iota
+	// CSSImport url from @import ""
+	CSSImport
 	// CSSUri url from url()
-	CSSUri urlContext = 1 + iota
+	CSSUri
 	// HTMLTagA url from <a href=""></a>
 	HTMLTagA
+	// HTMLTagAudio url from <audio src=""></audio>
+	HTMLTagAudio
+	// HTMLTagEmbed url from <embed src="" />
+	HTMLTagEmbed
 	// HTMLTagForm url from <form action="" />
 	HTMLTagForm
-	// HTMLTagImg url from <img src="" />
+	// HTMLTagFrame url from <frame src="" />
+	HTMLTagFrame
+	// HTMLTagIframe url from <iframe src=""></iframe>
+	HTMLTagIframe
+	// HTMLTagImg url from <img src="" srcset="" />
 	HTMLTagImg
+	// HTMLTagLinkAlternate url from <link rel="alternate" href="" />
+	HTMLTagLinkAlternate
+	// HTMLTagLinkCanonical url from <link rel="canonical" href="" />
+	HTMLTagLinkCanonical
+	// HTMLTagLinkIcon url from <link rel="icon" href="" /> or <link rel="apple-touch-icon" href="" />
+	HTMLTagLinkIcon
+	// HTMLTagLinkManifest url from <link rel="manifest" href="" />
+	HTMLTagLinkManifest
+	// HTMLTagLinkPreload url from <link rel="preload" href="" />, prefetch or modulepreload
+	HTMLTagLinkPreload
 	// HTMLTagLinkStylesheet url from <link rel="stylesheet" href="" />
 	HTMLTagLinkStylesheet
+	// HTMLTagMetaRefresh url from <meta http-equiv="refresh" content="0;url=" />
+	HTMLTagMetaRefresh
+	// HTMLTagObject url from <object data=""></object>
+	HTMLTagObject
 	// HTMLTagScript url from <script src="" />
 	HTMLTagScript
+	// HTMLTagSource url from <source src="" srcset="" />
+	HTMLTagSource
+	// HTMLTagTrack url from <track src="" />
+	HTMLTagTrack
+	// HTMLTagVideo url from <video src="" poster=""></video>
+	HTMLTagVideo
 	// HTTP3xxLocation url from HTTP response code 3xx
 	HTTP3xxLocation
 )
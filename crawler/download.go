@@ -1,30 +1,82 @@
 package crawler
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
 	neturl "net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/daohoangson/go-sitemirror/cacher"
 	cssScanner "github.com/gorilla/css/scanner"
 	"golang.org/x/net/html"
 	htmlAtom "golang.org/x/net/html/atom"
+	htmlCharset "golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
 )
 
 var (
-	cssURIRegexp = regexp.MustCompile(`^(url\(['"]?)([^'"]+)(['"]?\))$`)
+	// ErrBodyTooLarge is the error when response body exceeds .MaxBodySize of the input
+	ErrBodyTooLarge = errors.New("body too large")
+
+	cssURIRegexp          = regexp.MustCompile(`^(url\(['"]?)([^'"]+)(['"]?\))$`)
+	htmlMetaRefreshRegexp = regexp.MustCompile(`(?i)^(\s*[\d.]+\s*[;,\s]\s*(?:url\s*=\s*)?['"]?)([^'"\s]+)(['"]?\s*)$`)
+
+	htmlLinkRelContexts = []struct {
+		rels    []string
+		context urlContext
+	}{
+		{[]string{"stylesheet"}, HTMLTagLinkStylesheet},
+		{[]string{"icon", "apple-touch-icon", "apple-touch-icon-precomposed"}, HTMLTagLinkIcon},
+		{[]string{"manifest"}, HTMLTagLinkManifest},
+		{[]string{"preload", "prefetch", "modulepreload"}, HTMLTagLinkPreload},
+		{[]string{"canonical"}, HTMLTagLinkCanonical},
+		{[]string{"alternate"}, HTMLTagLinkAlternate},
+	}
 )
 
 const (
-	htmlAttrAction        = "action"
-	htmlAttrHref          = "href"
-	htmlAttrRel           = "rel"
-	htmlAttrRelStylesheet = "stylesheet"
-	htmlAttrSrc           = "src"
+	// AcceptEncoding the default value of Accept-Encoding request header
+	AcceptEncoding = "gzip, deflate, br"
+	// RetryMaxDelay the maximum delay between two download attempts
+	RetryMaxDelay = time.Minute
+)
+
+const (
+	cssAtImport         = "@import"
+	cssFunctionImageSet = "image-set"
+
+	htmlAttrAction               = "action"
+	htmlAttrCharset              = "charset"
+	htmlAttrContent              = "content"
+	htmlAttrData                 = "data"
+	htmlAttrHref                 = "href"
+	htmlAttrHTTPEquiv            = "http-equiv"
+	htmlAttrHTTPEquivContentType = "content-type"
+	htmlAttrHTTPEquivRefresh     = "refresh"
+	htmlAttrPoster               = "poster"
+	htmlAttrRel                  = "rel"
+	htmlAttrSrc                  = "src"
+	htmlAttrSrcset               = "srcset"
+
+	htmlCharsetPreviewSize = 1024
+	htmlCharsetUTF8        = "utf-8"
+	htmlWhitespace         = " \t\n\f\r"
 )
 
 // noinspection GoUnusedParameter
@@ -86,17 +138,42 @@ func Download(input *Input) *Downloaded {
 			}
 		}
 	}
+	setAcceptEncoding(req)
+
+	var resp *http.Response
+	for {
+		result.Attempts++
+		resp, err = httpClient.Do(req)
+
+		delay, retry := checkRetry(input, result.Attempts, resp, err)
+		if !retry {
+			break
+		}
 
-	resp, err := httpClient.Do(req)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		time.Sleep(delay)
+	}
 	if err != nil {
 		result.Error = err
 		return result
 	}
-	defer func() { _ = resp.Body.Close() }()
+	defer func() {
+		if result.bodyCloser == nil {
+			_ = resp.Body.Close()
+		}
+	}()
 
 	result.StatusCode = resp.StatusCode
 	if result.StatusCode >= 200 && result.StatusCode <= 299 {
-		result.Error = parseBody(resp, result)
+		parseCachingHeaders(resp, result)
+		if result.Error = decodeBody(resp); result.Error == nil {
+			result.Error = parseBody(resp, result)
+		}
+	} else if result.StatusCode == http.StatusNotModified {
+		parseCachingHeaders(resp, result)
 	} else if result.StatusCode >= 300 && result.StatusCode <= 399 {
 		result.Error = parseRedirect(resp, result)
 	}
@@ -104,15 +181,270 @@ func Download(input *Input) *Downloaded {
 	return result
 }
 
-func parseBody(resp *http.Response, result *Downloaded) error {
-	respHeaderCacheControl := resp.Header.Get(cacher.HeaderCacheControl)
-	if len(respHeaderCacheControl) > 0 {
-		result.AddHeader(cacher.HeaderCacheControl, respHeaderCacheControl)
+// setAcceptEncoding negotiates compression ourselves unless the request header already has it.
+// Either way, the response must go through decodeBody because the transport will not decode it.
+func setAcceptEncoding(req *http.Request) {
+	if len(req.Header.Get(cacher.HeaderAcceptEncoding)) == 0 {
+		req.Header.Set(cacher.HeaderAcceptEncoding, AcceptEncoding)
+	}
+}
+
+// decodeBody replaces response body with a decoded reader according to Content-Encoding.
+// The header is removed afterwards so that decoded data will not be mislabeled.
+func decodeBody(resp *http.Response) error {
+	contentEncoding := resp.Header.Get(cacher.HeaderContentEncoding)
+	if len(contentEncoding) == 0 || !hasBody(resp) {
+		return nil
+	}
+
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gr, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				return fmt.Errorf("gzip.NewReader: %w", err)
+			}
+			resp.Body = wrapDecodedBody(gr, resp.Body)
+		case "deflate":
+			resp.Body = wrapDecodedBody(newDeflateReader(resp.Body), resp.Body)
+		case "br":
+			resp.Body = wrapDecodedBody(brotli.NewReader(resp.Body), resp.Body)
+		default:
+			return fmt.Errorf("unsupported Content-Encoding: %s", encoding)
+		}
+	}
+
+	resp.Header.Del(cacher.HeaderContentEncoding)
+	resp.Header.Del(cacher.HeaderContentLength)
+	resp.ContentLength = -1
+
+	return nil
+}
+
+// hasBody returns false if the response has no content to decode,
+// servers may still label those responses with Content-Encoding.
+func hasBody(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode < 200,
+		resp.StatusCode == http.StatusNoContent,
+		resp.StatusCode == http.StatusNotModified,
+		resp.ContentLength == 0:
+		return false
+	}
+
+	br := bufio.NewReader(resp.Body)
+	if _, err := br.Peek(1); err == io.EOF {
+		return false
+	}
+	resp.Body = wrapDecodedBody(br, resp.Body)
+
+	return true
+}
+
+// newDeflateReader returns a reader for deflate content,
+// some servers send raw deflate data without the zlib wrapper.
+func newDeflateReader(r io.Reader) io.ReadCloser {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(2); err == nil &&
+		header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr
+		}
 	}
 
-	respHeaderExpires := resp.Header.Get(cacher.HeaderExpires)
-	if len(respHeaderExpires) > 0 {
-		result.AddHeader(cacher.HeaderExpires, respHeaderExpires)
+	return flate.NewReader(br)
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func wrapDecodedBody(r io.Reader, body io.ReadCloser) io.ReadCloser {
+	closers := []io.Closer{body}
+	if c, ok := r.(io.Closer); ok {
+		closers = []io.Closer{c, body}
+	}
+
+	return &decodedBody{Reader: r, closers: closers}
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if closeError := c.Close(); closeError != nil && err == nil {
+			err = closeError
+		}
+	}
+
+	return err
+}
+
+// checkRetry returns true if another attempt should be made after the returned delay.
+// Timeouts, connection resets and 429, 502, 503, 504 responses are considered transient.
+func checkRetry(input *Input, attempts uint64, resp *http.Response, err error) (time.Duration, bool) {
+	if attempts > input.Retries {
+		return 0, false
+	}
+
+	if err != nil {
+		if !isTransientError(err) {
+			return 0, false
+		}
+	} else {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+		default:
+			return 0, false
+		}
+	}
+
+	delay := GetRetryBackoff(input.RetryDelay, attempts)
+	if resp != nil {
+		if retryAfter, ok := ParseRetryAfter(resp.Header.Get(cacher.HeaderRetryAfter)); ok {
+			delay = retryAfter
+		}
+	}
+
+	if delay > RetryMaxDelay {
+		delay = RetryMaxDelay
+	}
+
+	return delay, true
+}
+
+// isTransientError returns true for request errors that may go away on their own.
+// Permanent errors (invalid url, certificate problems, canceled context, etc.) are not retried.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// GetRetryBackoff returns the jittered exponential delay before the next attempt.
+// The delay doubles after each attempt and is randomized between 50% and 100% of it.
+func GetRetryBackoff(base time.Duration, attempts uint64) time.Duration {
+	if base <= 0 || attempts < 1 {
+		return 0
+	}
+
+	delay := base
+	for i := uint64(1); i < attempts && delay < RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > RetryMaxDelay {
+		delay = RetryMaxDelay
+	}
+
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// ParseRetryAfter returns the delay from Retry-After header value,
+// either in delay-seconds or HTTP-date format.
+func ParseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		delay := time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
+
+		return delay, true
+	}
+
+	return 0, false
+}
+
+func parseCachingHeaders(resp *http.Response, result *Downloaded) {
+	for _, headerKey := range []string{
+		cacher.HeaderCacheControl,
+		cacher.HeaderETag,
+		cacher.HeaderExpires,
+		cacher.HeaderLastModified,
+	} {
+		respHeaderValue := resp.Header.Get(headerKey)
+		if len(respHeaderValue) > 0 {
+			result.AddHeader(headerKey, respHeaderValue)
+		}
+	}
+}
+
+// limitedBody returns ErrBodyTooLarge instead of reading past the limit
+type limitedBody struct {
+	io.ReadCloser
+	remaining uint64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining == 0 {
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+
+		return 0, err
+	}
+
+	if uint64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= uint64(n)
+
+	return n, err
+}
+
+// countingBody keeps track of the number of body bytes read
+type countingBody struct {
+	io.ReadCloser
+	count *uint64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	*b.count += uint64(n)
+
+	return n, err
+}
+
+func parseBody(resp *http.Response, result *Downloaded) error {
+	resp.Body = &countingBody{ReadCloser: resp.Body, count: &result.bodySize}
+
+	if maxBodySize := result.Input.MaxBodySize; maxBodySize > 0 {
+		if resp.ContentLength > 0 && uint64(resp.ContentLength) > maxBodySize {
+			return ErrBodyTooLarge
+		}
+
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: maxBodySize}
 	}
 
 	respHeaderContentType := resp.Header.Get(cacher.HeaderContentType)
@@ -134,13 +466,16 @@ func parseBody(resp *http.Response, result *Downloaded) error {
 }
 
 func parseBodyCSS(resp *http.Response, result *Downloaded) error {
-	body, _ := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
 
 	var buffer bytes.Buffer
 	defer buffer.Reset()
 	result.buffer = &buffer
 
-	err := parseBodyCSSString(string(body), result)
+	err = parseBodyCSSString(string(body), result)
 
 	result.Body = buffer.String()
 	result.buffer = nil
@@ -149,6 +484,12 @@ func parseBodyCSS(resp *http.Response, result *Downloaded) error {
 }
 
 func parseBodyCSSString(css string, result *Downloaded) error {
+	var (
+		importPending bool
+		imageSetDepth int
+		parensDepth   int
+	)
+
 	scanner := cssScanner.New(css)
 	for {
 		token := scanner.Next()
@@ -156,10 +497,46 @@ func parseBodyCSSString(css string, result *Downloaded) error {
 			break
 		}
 
-		if token.Type == cssScanner.TokenURI {
+		context := CSSUri
+		if importPending {
+			context = CSSImport
+		} else if imageSetDepth > 0 && imageSetDepth == parensDepth {
+			// nested functions like type("image/png") are not candidates
+			context = CSSImageSet
+		}
+
+		switch token.Type {
+		case cssScanner.TokenAtKeyword:
+			importPending = strings.EqualFold(token.Value, cssAtImport)
+		case cssScanner.TokenFunction:
+			parensDepth++
+			if imageSetDepth == 0 && isCSSImageSetFunction(token.Value) {
+				imageSetDepth = parensDepth
+			}
+		case cssScanner.TokenChar:
+			switch token.Value {
+			case "(":
+				parensDepth++
+			case ")":
+				if parensDepth == imageSetDepth {
+					imageSetDepth = 0
+				}
+				if parensDepth > 0 {
+					parensDepth--
+				}
+			}
+		}
+
+		if token.Type != cssScanner.TokenS && token.Type != cssScanner.TokenAtKeyword {
+			// @import only applies to the first value after the keyword
+			importPending = false
+		}
+
+		switch token.Type {
+		case cssScanner.TokenURI:
 			if m := cssURIRegexp.FindStringSubmatch(token.Value); m != nil {
 				before, url, after := m[1], m[2], m[3]
-				processedURL, err := result.ProcessURL(CSSUri, url)
+				processedURL, err := result.ProcessURL(context, url)
 				if err == nil && processedURL != url {
 					result.buffer.WriteString(before)
 					result.buffer.WriteString(processedURL)
@@ -167,6 +544,17 @@ func parseBodyCSSString(css string, result *Downloaded) error {
 					continue
 				}
 			}
+		case cssScanner.TokenString:
+			if context != CSSUri && len(token.Value) >= 2 {
+				quote, url := token.Value[:1], token.Value[1:len(token.Value)-1]
+				processedURL, err := result.ProcessURL(context, url)
+				if err == nil && processedURL != url {
+					result.buffer.WriteString(quote)
+					result.buffer.WriteString(processedURL)
+					result.buffer.WriteString(quote)
+					continue
+				}
+			}
 		}
 
 		result.buffer.WriteString(token.Value)
@@ -175,12 +563,24 @@ func parseBodyCSSString(css string, result *Downloaded) error {
 	return nil
 }
 
+func isCSSImageSetFunction(function string) bool {
+	name := strings.ToLower(strings.TrimSuffix(function, "("))
+	return name == cssFunctionImageSet || strings.HasSuffix(name, "-"+cssFunctionImageSet)
+}
+
 func parseBodyHTML(resp *http.Response, result *Downloaded) error {
 	var buffer bytes.Buffer
 	defer buffer.Reset()
 	result.buffer = &buffer
 
-	tokenizer := html.NewTokenizer(resp.Body)
+	body, charset := newHTMLReader(resp.Body, resp.Header.Get(cacher.HeaderContentType))
+	if len(charset) > 0 {
+		// the body is parsed and served in UTF-8, re-declare it accordingly
+		result.charset = charset
+		result.header.Set(cacher.HeaderContentType, getContentTypeUTF8(resp.Header.Get(cacher.HeaderContentType)))
+	}
+
+	tokenizer := html.NewTokenizer(body)
 	for {
 		if parseBodyHTMLToken(tokenizer, result) {
 			break
@@ -190,9 +590,90 @@ func parseBodyHTML(resp *http.Response, result *Downloaded) error {
 	result.Body = buffer.String()
 	result.buffer = nil
 
+	if err := tokenizer.Err(); err != io.EOF {
+		return err
+	}
+
 	return nil
 }
 
+// newHTMLReader returns a reader that converts html content to UTF-8 and the original charset name.
+// The charset is determined from BOM, Content-Type header and <meta> tags,
+// the charset is empty if no conversion is needed or the charset has not been declared.
+func newHTMLReader(r io.Reader, contentType string) (io.Reader, string) {
+	br := bufio.NewReaderSize(r, htmlCharsetPreviewSize)
+	preview, _ := br.Peek(htmlCharsetPreviewSize)
+
+	e, name, certain := htmlCharset.DetermineEncoding(preview, contentType)
+	if name == htmlCharsetUTF8 {
+		return br, ""
+	}
+
+	if !certain && !hasMetaCharset(preview) {
+		// nothing has been declared, a guessed charset may corrupt the content so keep it as is
+		return br, ""
+	}
+
+	return transform.NewReader(br, e.NewDecoder()), name
+}
+
+// hasMetaCharset returns true if the preview declares a known charset with <meta> tags
+func hasMetaCharset(preview []byte) bool {
+	tokenizer := html.NewTokenizer(bytes.NewReader(preview))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return false
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		if token.DataAtom != htmlAtom.Meta {
+			continue
+		}
+
+		label := ""
+		httpEquiv := ""
+		content := ""
+		for _, attr := range token.Attr {
+			switch attr.Key {
+			case htmlAttrCharset:
+				label = attr.Val
+			case htmlAttrContent:
+				content = attr.Val
+			case htmlAttrHTTPEquiv:
+				httpEquiv = strings.ToLower(strings.TrimSpace(attr.Val))
+			}
+		}
+		if len(label) == 0 && httpEquiv == htmlAttrHTTPEquivContentType {
+			if _, params, err := mime.ParseMediaType(content); err == nil {
+				label = params[htmlAttrCharset]
+			}
+		}
+
+		if e, _ := htmlCharset.Lookup(label); e != nil {
+			return true
+		}
+	}
+}
+
+// getContentTypeUTF8 returns the content type with charset parameter replaced by utf-8
+func getContentTypeUTF8(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+		params = nil
+	}
+	if params == nil {
+		params = make(map[string]string)
+	}
+	params[htmlAttrCharset] = htmlCharsetUTF8
+
+	return mime.FormatMediaType(mediaType, params)
+}
+
 func parseBodyHTMLToken(tokenizer *html.Tokenizer, result *Downloaded) bool {
 	tokenType := tokenizer.Next()
 	if tokenType == html.ErrorToken {
@@ -207,16 +688,34 @@ func parseBodyHTMLToken(tokenizer *html.Tokenizer, result *Downloaded) bool {
 		switch token.DataAtom {
 		case htmlAtom.A:
 			done = parseBodyHTMLTagA(&token, result)
+		case htmlAtom.Audio:
+			done = parseBodyHTMLTagMedia(&token, HTMLTagAudio, result)
+		case htmlAtom.Embed:
+			done = parseBodyHTMLTagEmbedded(&token, htmlAttrSrc, HTMLTagEmbed, result)
 		case htmlAtom.Form:
 			done = parseBodyHTMLTagForm(&token, result)
+		case htmlAtom.Frame:
+			done = parseBodyHTMLTagEmbedded(&token, htmlAttrSrc, HTMLTagFrame, result)
+		case htmlAtom.Iframe:
+			done = parseBodyHTMLTagEmbedded(&token, htmlAttrSrc, HTMLTagIframe, result)
 		case htmlAtom.Img:
 			done = parseBodyHTMLTagImg(&token, result)
 		case htmlAtom.Link:
 			done = parseBodyHTMLTagLink(&token, result)
+		case htmlAtom.Meta:
+			done = parseBodyHTMLTagMeta(&token, result)
+		case htmlAtom.Object:
+			done = parseBodyHTMLTagEmbedded(&token, htmlAttrData, HTMLTagObject, result)
 		case htmlAtom.Script:
 			done = parseBodyHTMLTagScript(tokenizer, &token, result)
+		case htmlAtom.Source:
+			done = parseBodyHTMLTagMedia(&token, HTMLTagSource, result)
 		case htmlAtom.Style:
 			done = parseBodyHTMLTagStyle(tokenizer, result)
+		case htmlAtom.Track:
+			done = parseBodyHTMLTagMedia(&token, HTMLTagTrack, result)
+		case htmlAtom.Video:
+			done = parseBodyHTMLTagMedia(&token, HTMLTagVideo, result)
 		}
 
 		if !done {
@@ -228,10 +727,20 @@ func parseBodyHTMLToken(tokenizer *html.Tokenizer, result *Downloaded) bool {
 		switch token.DataAtom {
 		case htmlAtom.Base:
 			done = parseBodyHTMLTagBase(&token, result)
+		case htmlAtom.Embed:
+			done = parseBodyHTMLTagEmbedded(&token, htmlAttrSrc, HTMLTagEmbed, result)
+		case htmlAtom.Frame:
+			done = parseBodyHTMLTagEmbedded(&token, htmlAttrSrc, HTMLTagFrame, result)
 		case htmlAtom.Img:
 			done = parseBodyHTMLTagImg(&token, result)
 		case htmlAtom.Link:
 			done = parseBodyHTMLTagLink(&token, result)
+		case htmlAtom.Meta:
+			done = parseBodyHTMLTagMeta(&token, result)
+		case htmlAtom.Source:
+			done = parseBodyHTMLTagMedia(&token, HTMLTagSource, result)
+		case htmlAtom.Track:
+			done = parseBodyHTMLTagMedia(&token, HTMLTagTrack, result)
 		}
 
 		if !done {
@@ -260,6 +769,20 @@ func parseBodyHTMLTagA(token *html.Token, result *Downloaded) bool {
 	return false
 }
 
+func parseBodyHTMLTagEmbedded(token *html.Token, attrKey string, context urlContext, result *Downloaded) bool {
+	for i, attr := range token.Attr {
+		if attr.Key == attrKey {
+			processedURL, err := result.ProcessURL(context, attr.Val)
+			if err == nil && processedURL != attr.Val {
+				token.Attr[i].Val = processedURL
+				return rewriteTokenAttr(token, result)
+			}
+		}
+	}
+
+	return false
+}
+
 func parseBodyHTMLTagForm(token *html.Token, result *Downloaded) bool {
 	for i, attr := range token.Attr {
 		if attr.Key == htmlAttrAction {
@@ -291,6 +814,15 @@ func parseBodyHTMLTagImg(token *html.Token, result *Downloaded) bool {
 	needRewrite := false
 
 	for i, attr := range token.Attr {
+		if attr.Key == htmlAttrSrcset {
+			processedSrcset := processSrcset(HTMLTagImg, attr.Val, result)
+			if processedSrcset != attr.Val {
+				token.Attr[i].Val = processedSrcset
+				needRewrite = true
+			}
+			continue
+		}
+
 		if attr.Key != htmlAttrSrc && !strings.HasPrefix(attr.Key, "data-") {
 			// process src attribute and any data-* attribute that contains url
 			// some website uses those for lazy loading / high resolution quality / etc.
@@ -338,9 +870,8 @@ func parseBodyHTMLTagLink(token *html.Token, result *Downloaded) bool {
 	}
 
 	if len(linkHref) > 0 {
-		switch linkRel {
-		case htmlAttrRelStylesheet:
-			processedURL, err := result.ProcessURL(HTMLTagLinkStylesheet, linkHref)
+		if context, ok := getHTMLLinkRelContext(linkRel); ok {
+			processedURL, err := result.ProcessURL(context, linkHref)
 			if err == nil && processedURL != linkHref {
 				token.Attr[linkHrefAttrIndex].Val = processedURL
 				return rewriteTokenAttr(token, result)
@@ -351,6 +882,105 @@ func parseBodyHTMLTagLink(token *html.Token, result *Downloaded) bool {
 	return false
 }
 
+// getHTMLLinkRelContext returns url context for the rel attribute value,
+// the value is treated as a space separated set of case insensitive keywords.
+func getHTMLLinkRelContext(rel string) (urlContext, bool) {
+	keywords := strings.Fields(strings.ToLower(rel))
+
+	for _, relContext := range htmlLinkRelContexts {
+		for _, keyword := range keywords {
+			for _, relContextRel := range relContext.rels {
+				if keyword == relContextRel {
+					return relContext.context, true
+				}
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func parseBodyHTMLTagMedia(token *html.Token, context urlContext, result *Downloaded) bool {
+	needRewrite := false
+
+	for i, attr := range token.Attr {
+		var processedURL string
+
+		switch attr.Key {
+		case htmlAttrSrc, htmlAttrPoster:
+			var err error
+			processedURL, err = result.ProcessURL(context, attr.Val)
+			if err != nil {
+				continue
+			}
+		case htmlAttrSrcset:
+			processedURL = processSrcset(context, attr.Val, result)
+		default:
+			continue
+		}
+
+		if processedURL != attr.Val {
+			token.Attr[i].Val = processedURL
+			needRewrite = true
+		}
+	}
+
+	if needRewrite {
+		return rewriteTokenAttr(token, result)
+	}
+
+	return false
+}
+
+func parseBodyHTMLTagMeta(token *html.Token, result *Downloaded) bool {
+	httpEquiv := ""
+	charsetAttrIndex := -1
+	contentAttrIndex := -1
+
+	for i, attr := range token.Attr {
+		switch attr.Key {
+		case htmlAttrCharset:
+			charsetAttrIndex = i
+		case htmlAttrContent:
+			contentAttrIndex = i
+		case htmlAttrHTTPEquiv:
+			httpEquiv = strings.ToLower(strings.TrimSpace(attr.Val))
+		}
+	}
+
+	if len(result.charset) > 0 {
+		// body has been converted, the declared charset must match
+		if charsetAttrIndex > -1 {
+			token.Attr[charsetAttrIndex].Val = htmlCharsetUTF8
+			return rewriteTokenAttr(token, result)
+		}
+
+		if httpEquiv == htmlAttrHTTPEquivContentType && contentAttrIndex > -1 {
+			token.Attr[contentAttrIndex].Val = getContentTypeUTF8(token.Attr[contentAttrIndex].Val)
+			return rewriteTokenAttr(token, result)
+		}
+	}
+
+	if httpEquiv != htmlAttrHTTPEquivRefresh || contentAttrIndex == -1 {
+		return false
+	}
+
+	content := token.Attr[contentAttrIndex].Val
+	m := htmlMetaRefreshRegexp.FindStringSubmatch(content)
+	if m == nil {
+		return false
+	}
+
+	before, url, after := m[1], m[2], m[3]
+	processedURL, err := result.ProcessURL(HTMLTagMetaRefresh, url)
+	if err == nil && processedURL != url {
+		token.Attr[contentAttrIndex].Val = before + processedURL + after
+		return rewriteTokenAttr(token, result)
+	}
+
+	return false
+}
+
 func parseBodyHTMLTagScript(tokenizer *html.Tokenizer, token *html.Token, result *Downloaded) bool {
 	for i, attr := range token.Attr {
 		if attr.Key == htmlAttrSrc {
@@ -374,6 +1004,8 @@ func parseBodyHTMLTagScript(tokenizer *html.Tokenizer, token *html.Token, result
 			return true
 		case html.TextToken:
 			parseBodyJsString(string(raw), result)
+		case html.ErrorToken:
+			return true
 		}
 	}
 }
@@ -391,6 +1023,8 @@ func parseBodyHTMLTagStyle(tokenizer *html.Tokenizer, result *Downloaded) bool {
 			return true
 		case html.TextToken:
 			_ = parseBodyCSSString(string(raw), result)
+		case html.ErrorToken:
+			return true
 		}
 	}
 }
@@ -404,6 +1038,65 @@ func parseBodyJsString(js string, result *Downloaded) {
 	result.buffer.WriteString(js)
 }
 
+// processSrcset returns srcset with all image candidate urls processed.
+// The candidate list is split following the algorithm from the HTML spec:
+// urls may contain commas so they are terminated by whitespace,
+// descriptors are terminated by commas outside of parentheses.
+func processSrcset(context urlContext, srcset string, result *Downloaded) string {
+	var buffer bytes.Buffer
+	remaining := srcset
+
+	for {
+		remaining = strings.TrimLeft(remaining, htmlWhitespace+",")
+		if len(remaining) == 0 {
+			break
+		}
+
+		urlEnd := strings.IndexAny(remaining, htmlWhitespace)
+		if urlEnd == -1 {
+			urlEnd = len(remaining)
+		}
+		url := remaining[:urlEnd]
+		remaining = remaining[urlEnd:]
+
+		descriptor := ""
+		if strings.HasSuffix(url, ",") {
+			url = strings.TrimRight(url, ",")
+		} else {
+			descriptorEnd := 0
+			inParens := false
+			for ; descriptorEnd < len(remaining); descriptorEnd++ {
+				c := remaining[descriptorEnd]
+				if c == '(' {
+					inParens = true
+				} else if c == ')' {
+					inParens = false
+				} else if c == ',' && !inParens {
+					break
+				}
+			}
+
+			descriptor = strings.TrimSpace(remaining[:descriptorEnd])
+			remaining = remaining[descriptorEnd:]
+		}
+
+		if processedURL, err := result.ProcessURL(context, url); err == nil {
+			url = processedURL
+		}
+
+		if buffer.Len() > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(url)
+		if len(descriptor) > 0 {
+			buffer.WriteString(" ")
+			buffer.WriteString(descriptor)
+		}
+	}
+
+	return buffer.String()
+}
+
 func rewriteTokenAttr(token *html.Token, result *Downloaded) bool {
 	result.buffer.WriteString("<")
 	result.buffer.WriteString(token.Data)
@@ -432,6 +1125,13 @@ func rewriteTokenAttr(token *html.Token, result *Downloaded) bool {
 }
 
 func parseBodyRaw(resp *http.Response, result *Downloaded) error {
+	if result.Input.StreamBody {
+		// the response body will be closed via Downloaded.Close
+		result.BodyReader = resp.Body
+		result.bodyCloser = resp.Body
+		return nil
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	result.Body = string(body)
 	return err
@@ -1,12 +1,26 @@
 package crawler_test
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	neturl "net/url"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/jarcoal/httpmock"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
 
 	"github.com/daohoangson/go-sitemirror/cacher"
 	. "github.com/daohoangson/go-sitemirror/crawler"
@@ -267,6 +281,54 @@ var _ = Describe("Download", func() {
 			})
 		})
 
+		Context(cacher.HeaderETag, func() {
+			It("should pick up header value", func() {
+				url := "https://domain.com/download/header/etag"
+				etag := `W/"foo"`
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					resp := httpmock.NewStringResponse(http.StatusOK, "")
+					resp.Header.Add(cacher.HeaderETag, etag)
+					return resp, nil
+				})
+
+				downloaded := downloadWithDefaultClient(url)
+
+				Expect(downloaded.GetHeaderValues(cacher.HeaderETag)).To(Equal([]string{etag}))
+			})
+		})
+
+		Context(cacher.HeaderLastModified, func() {
+			It("should pick up header value", func() {
+				url := "https://domain.com/download/header/last/modified"
+				lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					resp := httpmock.NewStringResponse(http.StatusOK, "")
+					resp.Header.Add(cacher.HeaderLastModified, lastModified)
+					return resp, nil
+				})
+
+				downloaded := downloadWithDefaultClient(url)
+
+				Expect(downloaded.GetHeaderValues(cacher.HeaderLastModified)).To(Equal([]string{lastModified}))
+			})
+
+			It("should pick up header value for 304", func() {
+				url := "https://domain.com/download/header/last/modified/304"
+				cacheControl := "max-age=60"
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					resp := httpmock.NewStringResponse(http.StatusNotModified, "")
+					resp.Header.Add(cacher.HeaderCacheControl, cacheControl)
+					return resp, nil
+				})
+
+				downloaded := downloadWithDefaultClient(url)
+
+				Expect(downloaded.Error).ToNot(HaveOccurred())
+				Expect(downloaded.StatusCode).To(Equal(http.StatusNotModified))
+				Expect(downloaded.GetHeaderValues(cacher.HeaderCacheControl)).To(Equal([]string{cacheControl}))
+			})
+		})
+
 		Context(cacher.HeaderLocation, func() {
 			It("should pick up header value", func() {
 				status := http.StatusMovedPermanently
@@ -337,6 +399,75 @@ var _ = Describe("Download", func() {
 			}
 		})
 
+		It("should pick up css @import string", func() {
+			url := "https://domain.com/download/urls/css/import/string"
+			targetUrl0 := "https://domain.com/download/urls/css/import/0.css"
+			targetUrl1 := "https://domain.com/download/urls/css/import/1.css"
+			cssTemplate := `@import "%s";@IMPORT '%s' screen;body{content:"foo"}`
+			css := fmt.Sprintf(cssTemplate, targetUrl0, targetUrl1)
+			httpmock.RegisterResponder("GET", url, t.NewCSSResponder(css))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(fmt.Sprintf(cssTemplate, "./0.css", "./1.css")))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.Context).To(Equal(CSSImport))
+			}
+		})
+
+		It("should pick up css @import url()", func() {
+			url := "https://domain.com/download/urls/css/import/url"
+			targetUrl := "https://domain.com/download/urls/css/import/target.css"
+			cssTemplate := "@import url(%s);"
+			css := fmt.Sprintf(cssTemplate, targetUrl)
+			httpmock.RegisterResponder("GET", url, t.NewCSSResponder(css))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(fmt.Sprintf(cssTemplate, "./target.css")))
+			Expect(len(downloaded.LinksAssets)).To(Equal(1))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.URL.String()).To(Equal(targetUrl))
+				Expect(link.Context).To(Equal(CSSImport))
+			}
+		})
+
+		It("should pick up css image-set() values", func() {
+			url := "https://domain.com/download/urls/css/image-set"
+			targetUrl0 := "https://domain.com/download/urls/css/image-set/0.png"
+			targetUrl1 := "https://domain.com/download/urls/css/image-set/1.png"
+			targetUrl2 := "https://domain.com/download/urls/css/image-set/2.png"
+			cssTemplate := `div{background-image:-webkit-image-set("%s" 1x,url(%s) 2x,"%s" type("image/png"));content:"foo"}`
+			css := fmt.Sprintf(cssTemplate, targetUrl0, targetUrl1, targetUrl2)
+			httpmock.RegisterResponder("GET", url, t.NewCSSResponder(css))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(fmt.Sprintf(cssTemplate,
+				"./image-set/0.png", "./image-set/1.png", "./image-set/2.png")))
+			Expect(len(downloaded.LinksAssets)).To(Equal(3))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.Context).To(Equal(CSSImageSet))
+			}
+		})
+
+		It("should pick up internal css @import string", func() {
+			url := "https://domain.com/download/urls/internal/css/import"
+			targetUrl := "https://domain.com/download/urls/internal/css/target.css"
+			htmlTemplate := `<style>@import "%s";</style>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./target.css"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(1))
+		})
+
 		It("should pick up a href", func() {
 			url := "https://domain.com/download/urls/a"
 			targetUrl := "https://domain.com/download/urls/target"
@@ -525,6 +656,193 @@ var _ = Describe("Download", func() {
 			}
 		})
 
+		It("should pick up img srcset", func() {
+			url := "https://domain.com/download/urls/img/srcset"
+			targetUrl0 := "https://domain.com/download/urls/img/srcset/0"
+			targetUrl1 := "https://domain.com/download/urls/img/srcset/w_100,h_100/1"
+			htmlTemplate := `<img src="%s" srcset="%s 1x, %s 2x" />`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate,
+				"./srcset/0", "./srcset/0", "./srcset/w_100,h_100/1"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.Context).To(Equal(HTMLTagImg))
+			}
+			Expect(downloaded.LinksAssets).To(HaveKey(targetUrl0))
+			Expect(downloaded.LinksAssets).To(HaveKey(targetUrl1))
+		})
+
+		It("should pick up img srcset, without descriptors", func() {
+			url := "https://domain.com/download/urls/img/srcset/no/descriptor"
+			targetUrl0 := "https://domain.com/download/urls/img/srcset/no/0"
+			targetUrl1 := "https://domain.com/download/urls/img/srcset/no/1"
+			html := t.NewHTMLMarkup(fmt.Sprintf(`<img srcset="  %s, %s,, ">`, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(`<img srcset="./0, ./1">`)))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+		})
+
+		It("should pick up img srcset, with parentheses in descriptors", func() {
+			url := "https://domain.com/download/urls/img/srcset/parens"
+			targetUrl0 := "https://domain.com/download/urls/img/srcset/parens/0"
+			targetUrl1 := "https://domain.com/download/urls/img/srcset/parens/1"
+			htmlTemplate := `<img srcset="%s 100w (foo, bar), %s 200w">`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./parens/0", "./parens/1"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+		})
+
+		It("should pick up picture source srcset", func() {
+			url := "https://domain.com/download/urls/picture"
+			targetUrl0 := "https://domain.com/download/urls/picture/0.webp"
+			targetUrl1 := "https://domain.com/download/urls/picture/1.jpg"
+			htmlTemplate := `<picture><source srcset="%s" type="image/webp" /><img src="%s" /></picture>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./picture/0.webp", "./picture/1.jpg"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+			Expect(downloaded.LinksAssets[targetUrl0].Context).To(Equal(HTMLTagSource))
+			Expect(downloaded.LinksAssets[targetUrl1].Context).To(Equal(HTMLTagImg))
+		})
+
+		It("should pick up video src and poster", func() {
+			url := "https://domain.com/download/urls/video"
+			targetUrl0 := "https://domain.com/download/urls/video/0.mp4"
+			targetUrl1 := "https://domain.com/download/urls/video/1.jpg"
+			htmlTemplate := `<video src="%s" poster="%s" controls=""></video>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./video/0.mp4", "./video/1.jpg"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.Context).To(Equal(HTMLTagVideo))
+			}
+		})
+
+		It("should pick up video source and track src", func() {
+			url := "https://domain.com/download/urls/video/source"
+			targetUrl0 := "https://domain.com/download/urls/video/0.webm"
+			targetUrl1 := "https://domain.com/download/urls/video/1.vtt"
+			htmlTemplate := `<video><source src="%s" type="video/webm" /><track src="%s" kind="subtitles" /></video>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./0.webm", "./1.vtt"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+			Expect(downloaded.LinksAssets[targetUrl0].Context).To(Equal(HTMLTagSource))
+			Expect(downloaded.LinksAssets[targetUrl1].Context).To(Equal(HTMLTagTrack))
+		})
+
+		It("should pick up audio src, using start tags", func() {
+			url := "https://domain.com/download/urls/audio"
+			targetUrl0 := "https://domain.com/download/urls/audio/0.mp3"
+			targetUrl1 := "https://domain.com/download/urls/audio/1.ogg"
+			htmlTemplate := `<audio src="%s"><source src="%s"></audio>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./audio/0.mp3", "./audio/1.ogg"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(2))
+			Expect(downloaded.LinksAssets[targetUrl0].Context).To(Equal(HTMLTagAudio))
+			Expect(downloaded.LinksAssets[targetUrl1].Context).To(Equal(HTMLTagSource))
+		})
+
+		It("should pick up iframe src", func() {
+			url := "https://domain.com/download/urls/iframe"
+			targetUrl := "https://domain.com/download/urls/iframe/target"
+			htmlTemplate := `<iframe src="%s" width="100"></iframe>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./iframe/target"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(0))
+			Expect(len(downloaded.LinksDiscovered)).To(Equal(1))
+
+			for _, link := range downloaded.LinksDiscovered {
+				Expect(link.URL.String()).To(Equal(targetUrl))
+				Expect(link.Context).To(Equal(HTMLTagIframe))
+			}
+		})
+
+		It("should pick up frame src", func() {
+			url := "https://domain.com/download/urls/frame"
+			targetUrl := "https://domain.com/download/urls/frame/target"
+			htmlTemplate := `<frameset><frame src="%s" /></frameset>`
+			html := fmt.Sprintf("<html><head></head>"+htmlTemplate+"</html>", targetUrl)
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(fmt.Sprintf("<html><head></head>"+htmlTemplate+"</html>", "./frame/target")))
+			Expect(len(downloaded.LinksAssets)).To(Equal(1))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.URL.String()).To(Equal(targetUrl))
+				Expect(link.Context).To(Equal(HTMLTagFrame))
+			}
+		})
+
+		It("should pick up embed src", func() {
+			url := "https://domain.com/download/urls/embed"
+			targetUrl := "https://domain.com/download/urls/embed/target.swf"
+			htmlTemplate := `<embed src="%s" type="application/x-shockwave-flash" />`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./embed/target.swf"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(1))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.URL.String()).To(Equal(targetUrl))
+				Expect(link.Context).To(Equal(HTMLTagEmbed))
+			}
+		})
+
+		It("should pick up object data", func() {
+			url := "https://domain.com/download/urls/object"
+			targetUrl := "https://domain.com/download/urls/object/target.pdf"
+			htmlTemplate := `<object data="%s" type="application/pdf"></object>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./object/target.pdf"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(1))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.URL.String()).To(Equal(targetUrl))
+				Expect(link.Context).To(Equal(HTMLTagObject))
+			}
+		})
+
 		It("should pick up link[rel=stylesheet] href", func() {
 			url := "https://domain.com/download/urls/link/stylesheet"
 			targetUrl := "https://domain.com/download/urls/link/target"
@@ -543,6 +861,128 @@ var _ = Describe("Download", func() {
 			}
 		})
 
+		It("should pick up link[rel] with multiple keywords", func() {
+			url := "https://domain.com/download/urls/link/rel/multiple"
+			targetUrl := "https://domain.com/download/urls/link/rel/target.css"
+			htmlTemplate := `<link rel="Preload  stylesheet" href="%s" />`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./target.css"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(1))
+
+			for _, link := range downloaded.LinksAssets {
+				Expect(link.URL.String()).To(Equal(targetUrl))
+				Expect(link.Context).To(Equal(HTMLTagLinkStylesheet))
+			}
+		})
+
+		It("should pick up link[rel] assets", func() {
+			url := "https://domain.com/download/urls/link/rel/assets"
+			targetUrl0 := "https://domain.com/download/urls/link/rel/0.ico"
+			targetUrl1 := "https://domain.com/download/urls/link/rel/1.png"
+			targetUrl2 := "https://domain.com/download/urls/link/rel/2.json"
+			targetUrl3 := "https://domain.com/download/urls/link/rel/3.js"
+			targetUrl4 := "https://domain.com/download/urls/link/rel/4.woff2"
+			targetUrl5 := "https://domain.com/download/urls/link/rel/5.js"
+			htmlTemplate := `<link rel="shortcut icon" href="%s" />` +
+				`<link rel="apple-touch-icon" href="%s" />` +
+				`<link rel="manifest" href="%s" />` +
+				`<link rel="modulepreload" href="%s" />` +
+				`<link rel="preload" href="%s" as="font" />` +
+				`<link rel="prefetch" href="%s" />`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl1, targetUrl2,
+				targetUrl3, targetUrl4, targetUrl5))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./0.ico", "./1.png",
+				"./2.json", "./3.js", "./4.woff2", "./5.js"))))
+			Expect(len(downloaded.LinksDiscovered)).To(Equal(0))
+			Expect(len(downloaded.LinksAssets)).To(Equal(6))
+			Expect(downloaded.LinksAssets[targetUrl0].Context).To(Equal(HTMLTagLinkIcon))
+			Expect(downloaded.LinksAssets[targetUrl1].Context).To(Equal(HTMLTagLinkIcon))
+			Expect(downloaded.LinksAssets[targetUrl2].Context).To(Equal(HTMLTagLinkManifest))
+			Expect(downloaded.LinksAssets[targetUrl3].Context).To(Equal(HTMLTagLinkPreload))
+			Expect(downloaded.LinksAssets[targetUrl4].Context).To(Equal(HTMLTagLinkPreload))
+			Expect(downloaded.LinksAssets[targetUrl5].Context).To(Equal(HTMLTagLinkPreload))
+		})
+
+		It("should pick up link[rel] documents", func() {
+			url := "https://domain.com/download/urls/link/rel/documents"
+			targetUrl0 := "https://domain.com/download/urls/link/rel/canonical"
+			targetUrl1 := "https://domain.com/download/urls/link/rel/alternate"
+			htmlTemplate := `<link rel="canonical" href="%s" /><link rel="alternate" hreflang="vi" href="%s" />`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl0, targetUrl1))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./canonical", "./alternate"))))
+			Expect(len(downloaded.LinksAssets)).To(Equal(0))
+			Expect(len(downloaded.LinksDiscovered)).To(Equal(2))
+			Expect(downloaded.LinksDiscovered[targetUrl0].Context).To(Equal(HTMLTagLinkCanonical))
+			Expect(downloaded.LinksDiscovered[targetUrl1].Context).To(Equal(HTMLTagLinkAlternate))
+		})
+
+		It("should not pick up link[rel] unknown", func() {
+			url := "https://domain.com/download/urls/link/rel/unknown"
+			html := t.NewHTMLMarkup(`<link rel="author" href="https://domain.com/author" />`)
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(html))
+			Expect(len(downloaded.LinksAssets)).To(Equal(0))
+			Expect(len(downloaded.LinksDiscovered)).To(Equal(0))
+		})
+
+		It("should pick up meta refresh url", func() {
+			url := "https://domain.com/download/urls/meta/refresh"
+			targetUrl := "https://domain.com/download/urls/meta/target"
+			htmlTemplate := `<meta http-equiv="Refresh" content="0; URL='%s'" />`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(
+				`<meta http-equiv="Refresh" content="0; URL=&#39;%s&#39;" />`, "./target"))))
+			Expect(len(downloaded.LinksDiscovered)).To(Equal(1))
+
+			for _, link := range downloaded.LinksDiscovered {
+				Expect(link.URL.String()).To(Equal(targetUrl))
+				Expect(link.Context).To(Equal(HTMLTagMetaRefresh))
+			}
+		})
+
+		It("should pick up meta refresh url, using start tag", func() {
+			url := "https://domain.com/download/urls/meta/refresh/start"
+			targetUrl := "https://domain.com/download/urls/meta/target"
+			htmlTemplate := `<meta http-equiv="refresh" content="5;url=%s">`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "../target"))))
+			Expect(len(downloaded.LinksDiscovered)).To(Equal(1))
+		})
+
+		It("should not pick up meta refresh without url", func() {
+			url := "https://domain.com/download/urls/meta/refresh/no/url"
+			html := t.NewHTMLMarkup(`<meta http-equiv="refresh" content="10" /><meta name="refresh" content="0;url=/foo" />`)
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(html))
+			Expect(len(downloaded.LinksDiscovered)).To(Equal(0))
+		})
+
 		It("should pick up inline css url() value", func() {
 			url := "https://domain.com/download/urls/inline/css/url"
 			targetUrl := "https://domain.com/download/urls/inline/css/target"
@@ -724,4 +1164,545 @@ var _ = Describe("Download", func() {
 			Expect(downloaded.StatusCode).To(Equal(statusCode))
 		})
 	})
+
+	Describe("Retries", func() {
+		downloadWithRetries := func(url string, retries uint64) *Downloaded {
+			parsedURL, err := neturl.Parse(url)
+			Expect(err).ToNot(HaveOccurred())
+
+			return Download(&Input{
+				Client:     http.DefaultClient,
+				Retries:    retries,
+				RetryDelay: time.Millisecond,
+				URL:        parsedURL,
+			})
+		}
+
+		newFlakyResponder := func(failures int, statusCode int) httpmock.Responder {
+			count := 0
+			return func(req *http.Request) (*http.Response, error) {
+				count++
+				if count <= failures {
+					return httpmock.NewStringResponse(statusCode, ""), nil
+				}
+
+				return httpmock.NewStringResponse(http.StatusOK, "foo/bar"), nil
+			}
+		}
+
+		It("should not retry by default", func() {
+			url := "https://domain.com/download/retries/default"
+			httpmock.RegisterResponder("GET", url, newFlakyResponder(1, http.StatusServiceUnavailable))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(1)))
+			Expect(downloaded.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		})
+
+		It("should retry until success", func() {
+			url := "https://domain.com/download/retries/success"
+			httpmock.RegisterResponder("GET", url, newFlakyResponder(2, http.StatusBadGateway))
+
+			downloaded := downloadWithRetries(url, 3)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(3)))
+			Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+			Expect(downloaded.Body).To(Equal("foo/bar"))
+		})
+
+		It("should give up after retries", func() {
+			url := "https://domain.com/download/retries/give/up"
+			httpmock.RegisterResponder("GET", url, newFlakyResponder(10, http.StatusGatewayTimeout))
+
+			downloaded := downloadWithRetries(url, 2)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(3)))
+			Expect(downloaded.StatusCode).To(Equal(http.StatusGatewayTimeout))
+		})
+
+		It("should not retry non transient status code", func() {
+			url := "https://domain.com/download/retries/not/found"
+			httpmock.RegisterResponder("GET", url, newFlakyResponder(1, http.StatusNotFound))
+
+			downloaded := downloadWithRetries(url, 2)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(1)))
+			Expect(downloaded.StatusCode).To(Equal(http.StatusNotFound))
+		})
+
+		newErrorResponder := func(err error) httpmock.Responder {
+			return func(req *http.Request) (*http.Response, error) {
+				return nil, err
+			}
+		}
+
+		It("should retry connection reset", func() {
+			url := "https://domain.com/download/retries/connection/reset"
+			httpmock.RegisterResponder("GET", url, newErrorResponder(&net.OpError{Op: "read", Err: syscall.ECONNRESET}))
+
+			downloaded := downloadWithRetries(url, 1)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(2)))
+			Expect(downloaded.Error).To(HaveOccurred())
+		})
+
+		It("should retry timeout", func() {
+			url := "https://domain.com/download/retries/timeout"
+			httpmock.RegisterResponder("GET", url, newErrorResponder(context.DeadlineExceeded))
+
+			downloaded := downloadWithRetries(url, 1)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(2)))
+			Expect(downloaded.Error).To(HaveOccurred())
+		})
+
+		It("should not retry permanent request error", func() {
+			url := "https://domain.com/download/retries/request/error"
+			httpmock.RegisterResponder("GET", url, newErrorResponder(x509.UnknownAuthorityError{}))
+
+			downloaded := downloadWithRetries(url, 1)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(1)))
+			Expect(downloaded.Error).To(HaveOccurred())
+		})
+
+		It("should not retry canceled request", func() {
+			url := "https://domain.com/download/retries/canceled"
+			httpmock.RegisterResponder("GET", url, newErrorResponder(context.Canceled))
+
+			downloaded := downloadWithRetries(url, 1)
+
+			Expect(downloaded.Attempts).To(Equal(uint64(1)))
+			Expect(downloaded.Error).To(HaveOccurred())
+		})
+
+		It("should honor Retry-After", func() {
+			url := "https://domain.com/download/retries/after"
+			count := 0
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				count++
+				if count == 1 {
+					resp := httpmock.NewStringResponse(http.StatusTooManyRequests, "")
+					resp.Header.Set("Retry-After", "0")
+					return resp, nil
+				}
+
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+			parsedURL, _ := neturl.Parse(url)
+
+			start := time.Now()
+			downloaded := Download(&Input{
+				Client:     http.DefaultClient,
+				Retries:    1,
+				RetryDelay: time.Hour,
+				URL:        parsedURL,
+			})
+
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(downloaded.Attempts).To(Equal(uint64(2)))
+			Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		Describe("GetRetryBackoff", func() {
+			It("should return zero without base", func() {
+				Expect(GetRetryBackoff(0, 1)).To(Equal(time.Duration(0)))
+			})
+
+			It("should double after each attempt", func() {
+				base := 100 * time.Millisecond
+
+				for attempts := uint64(1); attempts <= 3; attempts++ {
+					delay := base * time.Duration(1<<(attempts-1))
+					backoff := GetRetryBackoff(base, attempts)
+					Expect(backoff).To(BeNumerically(">=", delay/2))
+					Expect(backoff).To(BeNumerically("<=", delay))
+				}
+			})
+
+			It("should not exceed max delay", func() {
+				Expect(GetRetryBackoff(time.Second, 100)).To(BeNumerically("<=", RetryMaxDelay))
+			})
+		})
+
+		Describe("ParseRetryAfter", func() {
+			It("should parse seconds", func() {
+				delay, ok := ParseRetryAfter("120")
+
+				Expect(ok).To(BeTrue())
+				Expect(delay).To(Equal(2 * time.Minute))
+			})
+
+			It("should parse http date", func() {
+				delay, ok := ParseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+
+				Expect(ok).To(BeTrue())
+				Expect(delay).To(BeNumerically(">", 59*time.Minute))
+			})
+
+			It("should parse http date in the past", func() {
+				delay, ok := ParseRetryAfter("Mon, 02 Jan 2006 15:04:05 GMT")
+
+				Expect(ok).To(BeTrue())
+				Expect(delay).To(Equal(time.Duration(0)))
+			})
+
+			It("should not parse invalid value", func() {
+				_, ok := ParseRetryAfter("x")
+
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("ContentEncoding", func() {
+		encode := func(encoding string, data string) []byte {
+			var buffer bytes.Buffer
+			var w io.WriteCloser
+
+			switch encoding {
+			case "gzip":
+				w = gzip.NewWriter(&buffer)
+			case "deflate":
+				w = zlib.NewWriter(&buffer)
+			case "deflate-raw":
+				w, _ = flate.NewWriter(&buffer, flate.DefaultCompression)
+			case "br":
+				w = brotli.NewWriter(&buffer)
+			}
+
+			_, _ = w.Write([]byte(data))
+			_ = w.Close()
+
+			return buffer.Bytes()
+		}
+
+		newEncodedResponder := func(contentEncoding string, body []byte) httpmock.Responder {
+			return func(req *http.Request) (*http.Response, error) {
+				resp := httpmock.NewBytesResponse(http.StatusOK, body)
+				resp.Header.Set(cacher.HeaderContentType, "text/html")
+				resp.Header.Set(cacher.HeaderContentEncoding, contentEncoding)
+				return resp, nil
+			}
+		}
+
+		It("should send Accept-Encoding", func() {
+			url := "https://domain.com/download/content/encoding/accept"
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				return httpmock.NewStringResponse(http.StatusOK, req.Header.Get(cacher.HeaderAcceptEncoding)), nil
+			})
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(AcceptEncoding))
+		})
+
+		It("should keep Accept-Encoding from input", func() {
+			url := "https://domain.com/download/content/encoding/accept/input"
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				return httpmock.NewStringResponse(http.StatusOK, req.Header.Get(cacher.HeaderAcceptEncoding)), nil
+			})
+			parsedURL, _ := neturl.Parse(url)
+			header := make(http.Header)
+			header.Set(cacher.HeaderAcceptEncoding, "identity")
+
+			downloaded := Download(&Input{
+				Client: http.DefaultClient,
+				Header: header,
+				URL:    parsedURL,
+			})
+
+			Expect(downloaded.Body).To(Equal("identity"))
+		})
+
+		for _, encoding := range []string{"gzip", "deflate", "deflate-raw", "br"} {
+			encoding := encoding
+
+			It(fmt.Sprintf("should decode %s", encoding), func() {
+				url := "https://domain.com/download/content/encoding/" + encoding
+				targetUrl := "https://domain.com/download/content/encoding/target"
+				htmlTemplate := `<a href="%s">Link</a>`
+				html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, targetUrl))
+				contentEncoding := encoding
+				if contentEncoding == "deflate-raw" {
+					contentEncoding = "deflate"
+				}
+				httpmock.RegisterResponder("GET", url, newEncodedResponder(contentEncoding, encode(encoding, html)))
+
+				downloaded := downloadWithDefaultClient(url)
+
+				Expect(downloaded.Error).ToNot(HaveOccurred())
+				Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./target"))))
+				Expect(len(downloaded.LinksDiscovered)).To(Equal(1))
+				Expect(downloaded.GetHeaderValues(cacher.HeaderContentEncoding)).To(BeNil())
+			})
+		}
+
+		It("should decode multiple encodings", func() {
+			url := "https://domain.com/download/content/encoding/multiple"
+			html := t.NewHTMLMarkup("foo")
+			body := encode("br", string(encode("gzip", html)))
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("gzip, br", body))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(html))
+		})
+
+		It("should not decode empty body", func() {
+			url := "https://domain.com/download/content/encoding/empty"
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("gzip", []byte{}))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Error).ToNot(HaveOccurred())
+			Expect(downloaded.Body).To(Equal(""))
+		})
+
+		for _, statusCode := range []int{http.StatusNoContent, http.StatusNotModified, http.StatusMovedPermanently} {
+			statusCode := statusCode
+
+			It(fmt.Sprintf("should not decode %d", statusCode), func() {
+				url := fmt.Sprintf("https://domain.com/download/content/encoding/status/%d", statusCode)
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					resp := httpmock.NewStringResponse(statusCode, "")
+					resp.Header.Set(cacher.HeaderContentEncoding, "gzip")
+					resp.Header.Set(cacher.HeaderLocation, "/target")
+					return resp, nil
+				})
+
+				downloaded := downloadWithDefaultClient(url)
+
+				Expect(downloaded.Error).ToNot(HaveOccurred())
+				Expect(downloaded.StatusCode).To(Equal(statusCode))
+			})
+		}
+
+		It("should relay gzip error", func() {
+			url := "https://domain.com/download/content/encoding/gzip/error"
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("gzip", []byte("foo")))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Error).To(HaveOccurred())
+		})
+
+		It("should not decode unsupported encoding", func() {
+			url := "https://domain.com/download/content/encoding/unsupported"
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("compress", []byte("foo")))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Error).To(HaveOccurred())
+		})
+	})
+
+	Describe("Charset", func() {
+		newEncodedResponder := func(contentType string, e encoding.Encoding, html string) httpmock.Responder {
+			return func(req *http.Request) (*http.Response, error) {
+				body, err := e.NewEncoder().String(html)
+				Expect(err).ToNot(HaveOccurred())
+
+				resp := httpmock.NewStringResponse(http.StatusOK, body)
+				resp.Header.Set(cacher.HeaderContentType, contentType)
+				return resp, nil
+			}
+		}
+
+		It("should convert from Content-Type charset", func() {
+			url := "https://domain.com/download/charset/header"
+			htmlTemplate := `<a href="%s">日本語</a>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "https://domain.com/download/charset/日本"))
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("text/html; charset=Shift_JIS", japanese.ShiftJIS, html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Error).ToNot(HaveOccurred())
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "./%E6%97%A5%E6%9C%AC"))))
+			Expect(downloaded.GetHeaderValues(cacher.HeaderContentType)).To(Equal([]string{"text/html; charset=utf-8"}))
+		})
+
+		It("should convert from meta charset", func() {
+			url := "https://domain.com/download/charset/meta"
+			htmlTemplate := `<meta charset="%s"><a href="%s">Tiêu đê</a>`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "windows-1258", "./đư"))
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("text/html", charmap.Windows1258, html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "utf-8", "./%C4%91%C6%B0"))))
+			Expect(downloaded.GetHeaderValues(cacher.HeaderContentType)).To(Equal([]string{"text/html; charset=utf-8"}))
+		})
+
+		It("should convert from meta http-equiv", func() {
+			url := "https://domain.com/download/charset/http-equiv"
+			htmlTemplate := `<meta http-equiv="Content-Type" content="%s" />日本語`
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "text/html; charset=shift_jis"))
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("text/html", japanese.ShiftJIS, html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "text/html; charset=utf-8"))))
+		})
+
+		It("should keep utf-8", func() {
+			url := "https://domain.com/download/charset/utf-8"
+			html := t.NewHTMLMarkup(`<meta charset="utf-8">Tiếng Việt`)
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("text/html; charset=UTF-8", encoding.Nop, html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(html))
+			Expect(downloaded.GetHeaderValues(cacher.HeaderContentType)).To(Equal([]string{"text/html; charset=UTF-8"}))
+		})
+
+		It("should keep ascii without charset", func() {
+			url := "https://domain.com/download/charset/ascii"
+			html := t.NewHTMLMarkup("foo")
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("text/html", encoding.Nop, html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(html))
+			Expect(downloaded.GetHeaderValues(cacher.HeaderContentType)).To(Equal([]string{"text/html"}))
+		})
+
+		It("should keep non-ascii without charset", func() {
+			url := "https://domain.com/download/charset/undeclared"
+			html := t.NewHTMLMarkup("Café")
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("text/html", charmap.Windows1252, html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			encoded, _ := charmap.Windows1252.NewEncoder().String(html)
+			Expect(downloaded.Body).To(Equal(encoded))
+			Expect(downloaded.GetHeaderValues(cacher.HeaderContentType)).To(Equal([]string{"text/html"}))
+		})
+
+		It("should convert non-ascii after preview", func() {
+			url := "https://domain.com/download/charset/after/preview"
+			htmlTemplate := `<meta charset="%s"><p>%s</p><p>Café</p>`
+			padding := strings.Repeat("a", 2048)
+			html := t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "windows-1252", padding))
+			httpmock.RegisterResponder("GET", url, newEncodedResponder("text/html", charmap.Windows1252, html))
+
+			downloaded := downloadWithDefaultClient(url)
+
+			Expect(downloaded.Body).To(Equal(t.NewHTMLMarkup(fmt.Sprintf(htmlTemplate, "utf-8", padding))))
+			Expect(downloaded.GetHeaderValues(cacher.HeaderContentType)).To(Equal([]string{"text/html; charset=utf-8"}))
+		})
+	})
+
+	Describe("MaxBodySize", func() {
+		download := func(url string, maxBodySize uint64, streamBody bool) *Downloaded {
+			parsedURL, _ := neturl.Parse(url)
+
+			return Download(&Input{
+				Client:      http.DefaultClient,
+				MaxBodySize: maxBodySize,
+				StreamBody:  streamBody,
+				URL:         parsedURL,
+			})
+		}
+
+		It("should not limit by default", func() {
+			url := "https://domain.com/download/max/body/size/default"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+			downloaded := download(url, 0, false)
+
+			Expect(downloaded.Error).ToNot(HaveOccurred())
+			Expect(downloaded.Body).To(Equal("foo"))
+		})
+
+		It("should accept body within limit", func() {
+			url := "https://domain.com/download/max/body/size/within"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+			downloaded := download(url, 3, false)
+
+			Expect(downloaded.Error).ToNot(HaveOccurred())
+			Expect(downloaded.Body).To(Equal("foo"))
+		})
+
+		It("should reject Content-Length", func() {
+			url := "https://domain.com/download/max/body/size/content/length"
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				resp := httpmock.NewStringResponse(http.StatusOK, "foo")
+				resp.ContentLength = 3
+				return resp, nil
+			})
+
+			downloaded := download(url, 2, true)
+
+			Expect(downloaded.Error).To(Equal(ErrBodyTooLarge))
+			Expect(downloaded.BodyReader).To(BeNil())
+		})
+
+		It("should reject html body", func() {
+			url := "https://domain.com/download/max/body/size/html"
+			httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(t.NewHTMLMarkup("foo")))
+
+			downloaded := download(url, 10, false)
+
+			Expect(downloaded.Error).To(Equal(ErrBodyTooLarge))
+		})
+
+		It("should reject css body", func() {
+			url := "https://domain.com/download/max/body/size/css"
+			httpmock.RegisterResponder("GET", url, t.NewCSSResponder("body{background:none}"))
+
+			downloaded := download(url, 10, false)
+
+			Expect(downloaded.Error).To(Equal(ErrBodyTooLarge))
+		})
+
+		It("should reject raw body", func() {
+			url := "https://domain.com/download/max/body/size/raw"
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+			downloaded := download(url, 2, false)
+
+			Expect(downloaded.Error).To(Equal(ErrBodyTooLarge))
+		})
+
+		Describe("StreamBody", func() {
+			It("should stream raw body", func() {
+				url := "https://domain.com/download/stream/body/raw"
+				httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+				downloaded := download(url, 0, true)
+				defer func() { _ = downloaded.Close() }()
+
+				Expect(downloaded.Body).To(BeEmpty())
+				body, err := io.ReadAll(downloaded.BodyReader)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("foo"))
+			})
+
+			It("should not stream html body", func() {
+				url := "https://domain.com/download/stream/body/html"
+				html := t.NewHTMLMarkup("foo")
+				httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(html))
+
+				downloaded := download(url, 0, true)
+
+				Expect(downloaded.BodyReader).To(BeNil())
+				Expect(downloaded.Body).To(Equal(html))
+			})
+
+			It("should stop streaming raw body", func() {
+				url := "https://domain.com/download/stream/body/raw/limit"
+				httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+				downloaded := download(url, 2, true)
+				defer func() { _ = downloaded.Close() }()
+
+				body, err := io.ReadAll(downloaded.BodyReader)
+				Expect(err).To(Equal(ErrBodyTooLarge))
+				Expect(string(body)).To(Equal("fo"))
+			})
+		})
+	})
 })
@@ -25,6 +25,18 @@ func (d *Downloaded) AddHeader(key string, value string) {
 	d.header.Add(key, value)
 }
 
+// Close releases the streamed body, if any
+func (d *Downloaded) Close() error {
+	if d.bodyCloser == nil {
+		return nil
+	}
+
+	err := d.bodyCloser.Close()
+	d.bodyCloser = nil
+
+	return err
+}
+
 // GetHeaderKeys returns all header keys
 func (d *Downloaded) GetHeaderKeys() []string {
 	if d.header == nil {
@@ -73,6 +85,11 @@ func (d *Downloaded) ProcessURL(context urlContext, url string) (string, error)
 		return url, err
 	}
 
+	if d.Input.ShouldProcess != nil &&
+		!(*d.Input.ShouldProcess)(d.BaseURL.ResolveReference(parsedURL)) {
+		return url, nil
+	}
+
 	if d.Input.Rewriter != nil {
 		(*d.Input.Rewriter)(parsedURL)
 	}
@@ -97,6 +114,14 @@ func (d *Downloaded) ProcessURL(context urlContext, url string) (string, error)
 			d.LinksDiscovered[mapKey] = link
 		case HTMLTagForm:
 			d.LinksDiscovered[mapKey] = link
+		case HTMLTagIframe:
+			d.LinksDiscovered[mapKey] = link
+		case HTMLTagLinkAlternate:
+			d.LinksDiscovered[mapKey] = link
+		case HTMLTagLinkCanonical:
+			d.LinksDiscovered[mapKey] = link
+		case HTMLTagMetaRefresh:
+			d.LinksDiscovered[mapKey] = link
 		case HTTP3xxLocation:
 			d.LinksDiscovered[mapKey] = link
 		default:
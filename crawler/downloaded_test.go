@@ -108,6 +108,21 @@ var _ = Describe("Downloaded", func() {
 			Expect(processedURL).To(Equal("." + urlPath))
 		})
 
+		It("should keep url intact if it should not be processed", func() {
+			url := "https://ads.domain.com/ProcessURL/should/not/process.js"
+			parsedURL, _ := neturl.Parse("https://domain.com")
+			shouldProcess := func(u *neturl.URL) bool {
+				return u.Host != "ads.domain.com"
+			}
+			downloaded.Input = &Input{URL: parsedURL, ShouldProcess: &shouldProcess}
+
+			processedURL, err := downloaded.ProcessURL(HTMLTagScript, url)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(processedURL).To(Equal(url))
+			Expect(downloaded.GetAssetURLs()).To(BeEmpty())
+		})
+
 		It("should keep non-http url intact", func() {
 			url := "ftp://domain.com/ProcessURL/non/http"
 			processedURL, _ := downloaded.ProcessURL(HTMLTagA, url)
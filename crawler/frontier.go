@@ -0,0 +1,297 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/daohoangson/go-sitemirror/cacher"
+)
+
+// FrontierCompactThreshold the minimum number of done and visit records before the frontier journal is compacted,
+// it is raised to the number of live records so that compaction cost stays proportional to the journal growth.
+// Changes only apply to frontiers opened afterwards.
+var FrontierCompactThreshold = 1000
+
+const (
+	frontierOpPush  = "push"
+	frontierOpDone  = "done"
+	frontierOpVisit = "visit"
+)
+
+// frontier keeps a journal of queued and visited urls on disk,
+// pending items can be resumed after a restart.
+type frontier struct {
+	mutex sync.Mutex
+
+	fs        cacher.Fs
+	path      string
+	file      cacher.File
+	visited   *seenSet
+	pending   map[string]*frontierPending
+	seq       int
+	records   int
+	threshold int
+}
+
+type frontierRecord struct {
+	Op           string `json:"op"`
+	URL          string `json:"url"`
+	Depth        uint64 `json:"depth,omitempty"`
+	Force        bool   `json:"force,omitempty"`
+	Priority     int    `json:"priority,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+type frontierPending struct {
+	record frontierRecord
+	count  int
+	seq    int
+}
+
+// openFrontier replays the journal at the specified path and returns pending items.
+// The journal is compacted to keep only visited urls, pending items are expected to be pushed again.
+// Like the in memory seen set, only the latest SeenCapacity visited urls are kept.
+func openFrontier(fs cacher.Fs, path string) (*frontier, []QueueItem, error) {
+	f := &frontier{
+		fs:        fs,
+		path:      path,
+		visited:   newSeenSet(SeenCapacity),
+		pending:   make(map[string]*frontierPending),
+		threshold: FrontierCompactThreshold,
+	}
+
+	pending, err := f.replay()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = f.compact(); err != nil {
+		return nil, nil, err
+	}
+
+	items := make([]QueueItem, 0, len(pending))
+	for _, p := range pending {
+		url, parseError := neturl.Parse(p.record.URL)
+		if parseError != nil {
+			continue
+		}
+
+		items = append(items, QueueItem{
+			URL:           url,
+			Depth:         p.record.Depth,
+			ForceDownload: p.record.Force,
+			Priority:      p.record.Priority,
+			ETag:          p.record.ETag,
+			LastModified:  p.record.LastModified,
+		})
+	}
+
+	return f, items, nil
+}
+
+func (f *frontier) replay() ([]*frontierPending, error) {
+	file, err := f.fs.OpenFile(f.path, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("fs.OpenFile: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	r := bufio.NewReader(file)
+	for {
+		line, readError := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var record frontierRecord
+			if json.Unmarshal(line, &record) == nil {
+				f.apply(record)
+			}
+		}
+
+		if readError == io.EOF {
+			break
+		}
+		if readError != nil {
+			return nil, fmt.Errorf("r.ReadBytes: %w", readError)
+		}
+	}
+
+	pending := f.sortedPending()
+	f.pending = make(map[string]*frontierPending)
+
+	return pending, nil
+}
+
+// apply updates visited urls and pending items with the record, f.mutex must be locked
+func (f *frontier) apply(record frontierRecord) {
+	switch record.Op {
+	case frontierOpPush:
+		p, ok := f.pending[record.URL]
+		if !ok {
+			f.seq++
+			p = &frontierPending{seq: f.seq}
+			f.pending[record.URL] = p
+		}
+		p.record = record
+		p.count++
+	case frontierOpDone:
+		if p, ok := f.pending[record.URL]; ok {
+			p.count--
+			if p.count < 1 {
+				delete(f.pending, record.URL)
+			}
+		}
+	case frontierOpVisit:
+		f.visited.add(record.URL)
+	}
+}
+
+func (f *frontier) sortedPending() []*frontierPending {
+	pending := make([]*frontierPending, 0, len(f.pending))
+	for _, p := range f.pending {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].seq < pending[j].seq })
+
+	return pending
+}
+
+// compact rewrites the journal with visited urls and pending items only, f.mutex must be locked
+func (f *frontier) compact() error {
+	tmpPath := f.path + ".tmp"
+	tmp, err := f.fs.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("fs.OpenFile(tmp): %w", err)
+	}
+	if err = tmp.Truncate(0); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("tmp.Truncate: %w", err)
+	}
+
+	bw := bufio.NewWriter(tmp)
+	for _, url := range f.visited.keys() {
+		if err = writeFrontierRecord(bw, frontierRecord{Op: frontierOpVisit, URL: url}); err != nil {
+			break
+		}
+	}
+	for _, p := range f.sortedPending() {
+		for i := 0; i < p.count && err == nil; i++ {
+			err = writeFrontierRecord(bw, p.record)
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeError := tmp.Close(); err == nil {
+		err = closeError
+	}
+	if err != nil {
+		_ = f.fs.RemoveAll(tmpPath)
+		return fmt.Errorf("write(tmp): %w", err)
+	}
+
+	if err = f.fs.Rename(tmpPath, f.path); err != nil {
+		_ = f.fs.RemoveAll(tmpPath)
+		return fmt.Errorf("fs.Rename: %w", err)
+	}
+
+	if f.file != nil {
+		_ = f.file.Close()
+	}
+	f.records = 0
+	f.file, err = f.fs.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		f.file = nil
+		return fmt.Errorf("fs.OpenFile: %w", err)
+	}
+
+	return nil
+}
+
+func (f *frontier) push(item QueueItem) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.write(frontierRecord{
+		Op:           frontierOpPush,
+		URL:          item.URL.String(),
+		Depth:        item.Depth,
+		Force:        item.ForceDownload,
+		Priority:     item.Priority,
+		ETag:         item.ETag,
+		LastModified: item.LastModified,
+	})
+}
+
+// done marks a pushed item as processed, visitedKey will be skipped by future non-forced pushes if not empty.
+// The journal is compacted once there are enough done and visit records.
+func (f *frontier) done(item QueueItem, visitedKey string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(visitedKey) > 0 {
+		if err := f.write(frontierRecord{Op: frontierOpVisit, URL: visitedKey}); err != nil {
+			return err
+		}
+		f.records++
+	}
+
+	if err := f.write(frontierRecord{Op: frontierOpDone, URL: item.URL.String()}); err != nil {
+		return err
+	}
+	f.records++
+
+	if f.file == nil || f.records < f.threshold || f.records < f.visited.len()+len(f.pending) {
+		return nil
+	}
+
+	return f.compact()
+}
+
+func (f *frontier) isVisited(key string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.visited.has(key)
+}
+
+func (f *frontier) close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+// write appends the record to the journal and applies it, f.mutex must be locked
+func (f *frontier) write(record frontierRecord) error {
+	if f.file == nil {
+		// closed after crawler stop, unrecorded items will be resumed next time
+		return nil
+	}
+
+	f.apply(record)
+
+	return writeFrontierRecord(f.file, record)
+}
+
+func writeFrontierRecord(w io.Writer, record frontierRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
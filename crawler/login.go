@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/daohoangson/go-sitemirror/cacher"
+)
+
+// String returns the login url with form keys only, values are redacted to keep secrets out of logs
+func (l *Login) String() string {
+	if l == nil {
+		return "<nil>"
+	}
+
+	keys := make([]string, 0, len(l.Form))
+	for key := range l.Form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return fmt.Sprintf("%s %v", l.URL, keys)
+}
+
+// ensureLogin submits the login form if it has not been submitted yet,
+// it returns the login generation to be used with relogin.
+func (c *crawler) ensureLogin() uint64 {
+	c.loginMutex.Lock()
+	defer c.loginMutex.Unlock()
+
+	c.mutex.Lock()
+	login := c.login
+	c.mutex.Unlock()
+
+	if login == nil {
+		return 0
+	}
+
+	if c.loginGeneration == 0 && c.doLogin(login) {
+		c.loginGeneration++
+	}
+
+	return c.loginGeneration
+}
+
+// relogin submits the login form again unless another worker has done it since generation
+func (c *crawler) relogin(generation uint64) {
+	c.loginMutex.Lock()
+	defer c.loginMutex.Unlock()
+
+	c.mutex.Lock()
+	login := c.login
+	c.mutex.Unlock()
+
+	if login == nil || c.loginGeneration != generation {
+		return
+	}
+
+	if c.doLogin(login) {
+		c.loginGeneration++
+	}
+}
+
+// doLogin returns true if the login form has been submitted successfully
+func (c *crawler) doLogin(login *Login) bool {
+	loggerContext := c.logger.WithField("url", login.URL)
+
+	req, err := http.NewRequest("POST", login.URL.String(), strings.NewReader(login.Form.Encode()))
+	if err != nil {
+		loggerContext.WithError(err).Error("Cannot login")
+		return false
+	}
+
+	c.mutex.Lock()
+	client := c.client
+	for headerKey, headerValues := range c.requestHeader {
+		for _, headerValue := range headerValues {
+			req.Header.Add(headerKey, headerValue)
+		}
+	}
+	c.mutex.Unlock()
+	req.Header.Set(cacher.HeaderContentType, "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		loggerContext.WithError(err).Error("Cannot login")
+		return false
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		loggerContext.WithField("statusCode", resp.StatusCode).Error("Cannot login")
+		return false
+	}
+
+	loggerContext.WithFields(logrus.Fields{
+		"statusCode": resp.StatusCode,
+		"generation": c.loginGeneration + 1,
+	}).Info("Logged in")
+
+	return true
+}
+
+// checkLoginExpired returns true if the download has been redirected to the login form
+func (c *crawler) checkLoginExpired(downloaded *Downloaded) bool {
+	if downloaded == nil || downloaded.StatusCode < 300 || downloaded.StatusCode > 399 {
+		return false
+	}
+
+	c.mutex.Lock()
+	login := c.login
+	c.mutex.Unlock()
+
+	if login == nil {
+		return false
+	}
+
+	for _, link := range downloaded.LinksDiscovered {
+		if link.Context != HTTP3xxLocation {
+			continue
+		}
+
+		location := downloaded.BaseURL.ResolveReference(link.URL)
+		if login.ExpiredPattern != nil {
+			return login.ExpiredPattern.MatchString(location.String())
+		}
+
+		return location.Host == login.URL.Host && location.Path == login.URL.Path
+	}
+
+	return false
+}
@@ -0,0 +1,290 @@
+package crawler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// queue holds items until a worker is ready to process them.
+// Items are popped by priority then in FIFO order, skipping hosts that are currently throttled
+// so that workers can keep serving other hosts in the meantime.
+type queue struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	closed   bool
+	paused   bool
+	retiring int
+	hosts    map[string]*queueHost
+	seq      uint64
+	length   int
+
+	maxInFlight       uint64
+	interval          time.Duration
+	respectCrawlDelay bool
+
+	timer  *time.Timer
+	wakeAt time.Time
+}
+
+type queueHost struct {
+	items queueEntries
+
+	inFlight        uint64
+	lastStart       time.Time
+	crawlDelay      time.Duration
+	crawlDelayKnown bool
+}
+
+type queueEntry struct {
+	item QueueItem
+	seq  uint64
+}
+
+// queueEntries is a heap of entries with the highest priority then the lowest seq first
+type queueEntries []queueEntry
+
+func newQueue() *queue {
+	q := &queue{hosts: make(map[string]*queueHost)}
+	q.cond = sync.NewCond(&q.mutex)
+
+	return q
+}
+
+func (q *queue) setMaxInFlight(maxInFlight uint64) {
+	q.mutex.Lock()
+	q.maxInFlight = maxInFlight
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+func (q *queue) setInterval(interval time.Duration) {
+	q.mutex.Lock()
+	q.interval = interval
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+func (q *queue) setRespectCrawlDelay(value bool) {
+	q.mutex.Lock()
+	q.respectCrawlDelay = value
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+// setPaused stops or resumes popping items, items can still be pushed while paused
+func (q *queue) setPaused(value bool) {
+	q.mutex.Lock()
+	q.paused = value
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+func (q *queue) isPaused() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.paused
+}
+
+// retire makes the specified number of pop calls return false so that workers can exit
+func (q *queue) retire(count int) {
+	q.mutex.Lock()
+	q.retiring += count
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+// setCrawlDelay records the crawl delay of the specified host,
+// until then only one request at a time is allowed for the host.
+func (q *queue) setCrawlDelay(host string, crawlDelay time.Duration) {
+	q.mutex.Lock()
+	h := q.getHost(host)
+	h.crawlDelay = crawlDelay
+	h.crawlDelayKnown = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+func (q *queue) push(item QueueItem) {
+	q.mutex.Lock()
+	q.seq++
+	h := q.getHost(item.URL.Host)
+	heap.Push(&h.items, queueEntry{item: item, seq: q.seq})
+	q.length++
+	q.cond.Signal()
+	q.mutex.Unlock()
+}
+
+// pop blocks until an item of a host that is not throttled is available.
+// It returns false after the queue has been closed or if the worker should retire.
+func (q *queue) pop() (QueueItem, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for {
+		if q.closed {
+			return QueueItem{}, false
+		}
+
+		if q.retiring > 0 {
+			q.retiring--
+			return QueueItem{}, false
+		}
+
+		if q.paused {
+			q.cond.Wait()
+			continue
+		}
+
+		now := time.Now()
+		var (
+			next     *queueHost
+			nextTime time.Time
+		)
+
+		for _, h := range q.hosts {
+			if len(h.items) == 0 {
+				continue
+			}
+
+			if !q.checkInFlight(h) {
+				continue
+			}
+
+			if allowedAt := h.lastStart.Add(q.getInterval(h)); allowedAt.After(now) {
+				if nextTime.IsZero() || allowedAt.Before(nextTime) {
+					nextTime = allowedAt
+				}
+				continue
+			}
+
+			if next == nil || h.items[0].before(next.items[0]) {
+				next = h
+			}
+		}
+
+		if next != nil {
+			item := heap.Pop(&next.items).(queueEntry).item
+			next.inFlight++
+			next.lastStart = now
+			q.length--
+
+			return item, true
+		}
+
+		if !nextTime.IsZero() {
+			q.wakeUpAt(nextTime)
+		}
+		q.cond.Wait()
+	}
+}
+
+// done marks a popped item of the specified host as processed
+func (q *queue) done(host string) {
+	q.mutex.Lock()
+	h := q.getHost(host)
+	if h.inFlight > 0 {
+		h.inFlight--
+	}
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+// close wakes up all waiting workers and returns the number of dropped items
+func (q *queue) close() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+	q.cond.Broadcast()
+
+	return q.length
+}
+
+func (q *queue) getHost(host string) *queueHost {
+	h, ok := q.hosts[host]
+	if !ok {
+		h = &queueHost{}
+		q.hosts[host] = h
+	}
+
+	return h
+}
+
+func (q *queue) checkInFlight(h *queueHost) bool {
+	if q.respectCrawlDelay && !h.crawlDelayKnown && h.inFlight > 0 {
+		return false
+	}
+
+	if q.maxInFlight > 0 && h.inFlight >= q.maxInFlight {
+		return false
+	}
+
+	return true
+}
+
+func (q *queue) getInterval(h *queueHost) time.Duration {
+	if q.respectCrawlDelay && h.crawlDelay > q.interval {
+		return h.crawlDelay
+	}
+
+	return q.interval
+}
+
+func (q *queue) wakeUpAt(t time.Time) {
+	if !q.wakeAt.IsZero() && !q.wakeAt.After(t) {
+		// an earlier wake up has been scheduled
+		return
+	}
+
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+
+	q.wakeAt = t
+	q.timer = time.AfterFunc(time.Until(t), func() {
+		q.mutex.Lock()
+		q.wakeAt = time.Time{}
+		q.cond.Broadcast()
+		q.mutex.Unlock()
+	})
+}
+
+func (e queueEntry) before(other queueEntry) bool {
+	if e.item.Priority != other.item.Priority {
+		return e.item.Priority > other.item.Priority
+	}
+
+	return e.seq < other.seq
+}
+
+func (entries queueEntries) Len() int {
+	return len(entries)
+}
+
+func (entries queueEntries) Less(i, j int) bool {
+	return entries[i].before(entries[j])
+}
+
+func (entries queueEntries) Swap(i, j int) {
+	entries[i], entries[j] = entries[j], entries[i]
+}
+
+func (entries *queueEntries) Push(x interface{}) {
+	*entries = append(*entries, x.(queueEntry))
+}
+
+func (entries *queueEntries) Pop() interface{} {
+	old := *entries
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = queueEntry{}
+	*entries = old[:n-1]
+
+	return entry
+}
@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// RobotsTxtPath the well known path of robots.txt
+	RobotsTxtPath = "/robots.txt"
+	// RobotsTxtMaxSize the maximum number of bytes to be parsed from robots.txt
+	RobotsTxtMaxSize = 500 * 1024
+	// RobotsTxtTTL validity of fetched robots.txt before it is fetched again
+	RobotsTxtTTL = 24 * time.Hour
+)
+
+// RobotsTxtErrorTTL validity of failed robots.txt fetches before it is fetched again
+var RobotsTxtErrorTTL = time.Minute
+
+type robotsTxtRule struct {
+	allow   bool
+	pattern string
+	regexp  *regexp.Regexp
+}
+
+type robotsTxtEntry struct {
+	once      sync.Once
+	expires   time.Time
+	robotsTxt *RobotsTxt
+}
+
+// ParseRobotsTxt returns rules that apply to the specified user agent.
+// Groups matching the user agent product token (exactly, case-insensitive) take precedence over the `*` group.
+// Sitemap lines are not tied to any group and always included.
+func ParseRobotsTxt(r io.Reader, userAgent string) *RobotsTxt {
+	var (
+		token         = GetUserAgentToken(userAgent)
+		specific      = &RobotsTxt{}
+		wildcard      = &RobotsTxt{}
+		foundSpecific = false
+		targets       []*RobotsTxt
+		readingAgents = false
+		sitemaps      []*neturl.URL
+	)
+
+	scanner := bufio.NewScanner(io.LimitReader(r, RobotsTxtMaxSize))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i > -1 {
+			line = line[:i]
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			if !readingAgents {
+				// a new group starts
+				targets = nil
+				readingAgents = true
+			}
+
+			agent := strings.ToLower(value)
+			if agent == "*" {
+				targets = append(targets, wildcard)
+			} else if len(token) > 0 && agent == token {
+				targets = append(targets, specific)
+				foundSpecific = true
+			}
+		case "allow", "disallow":
+			readingAgents = false
+			for _, target := range targets {
+				target.addRule(key == "allow", value)
+			}
+		case "crawl-delay":
+			readingAgents = false
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				for _, target := range targets {
+					target.CrawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			if sitemap, err := neturl.Parse(value); err == nil && sitemap.IsAbs() {
+				sitemaps = append(sitemaps, sitemap)
+			}
+		}
+	}
+
+	result := wildcard
+	if foundSpecific {
+		result = specific
+	}
+	result.Sitemaps = sitemaps
+
+	return result
+}
+
+// GetUserAgentToken returns the product token of the specified user agent in lower case
+func GetUserAgentToken(userAgent string) string {
+	token := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(token, "/ "); i > -1 {
+		token = token[:i]
+	}
+
+	return strings.ToLower(token)
+}
+
+// IsAllowed returns true if the specified url can be crawled.
+// The longest matching rule wins, allow rule wins in case of a tie.
+func (r *RobotsTxt) IsAllowed(url *neturl.URL) bool {
+	if r == nil || url == nil {
+		return true
+	}
+
+	path := url.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	if len(url.RawQuery) > 0 {
+		path = path + "?" + url.RawQuery
+	}
+
+	allowed := true
+	matchedLength := -1
+	for _, rule := range r.rules {
+		if len(rule.pattern) < matchedLength {
+			continue
+		}
+
+		if !rule.regexp.MatchString(path) {
+			continue
+		}
+
+		if len(rule.pattern) > matchedLength || rule.allow {
+			allowed = rule.allow
+			matchedLength = len(rule.pattern)
+		}
+	}
+
+	return allowed
+}
+
+func (r *RobotsTxt) addRule(allow bool, pattern string) {
+	if len(pattern) == 0 {
+		// empty disallow means everything is allowed
+		return
+	}
+
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\*`, `.*`, -1)
+	if strings.HasSuffix(expr, `\$`) {
+		expr = strings.TrimSuffix(expr, `\$`) + `$`
+	}
+
+	compiled, err := regexp.Compile("^" + expr)
+	if err != nil {
+		return
+	}
+
+	r.rules = append(r.rules, robotsTxtRule{
+		allow:   allow,
+		pattern: pattern,
+		regexp:  compiled,
+	})
+}
+
+func (c *crawler) checkRobotsTxtAllowed(url *neturl.URL) bool {
+	if !c.respectRobotsTxt.IsSet() {
+		return true
+	}
+
+	return c.getRobotsTxt(url).IsAllowed(url)
+}
+
+func (c *crawler) getCrawlDelay(url *neturl.URL) time.Duration {
+	if !c.respectRobotsTxt.IsSet() {
+		return 0
+	}
+
+	robotsTxt := c.getRobotsTxt(url)
+	if robotsTxt == nil {
+		return 0
+	}
+
+	return robotsTxt.CrawlDelay
+}
+
+func (c *crawler) getRobotsTxt(url *neturl.URL) *RobotsTxt {
+	origin := fmt.Sprintf("%s://%s", url.Scheme, url.Host)
+	now := time.Now()
+
+	c.mutex.Lock()
+	entry, ok := c.robotsTxts[origin]
+	if !ok || entry.expires.Before(now) {
+		entry = &robotsTxtEntry{expires: now.Add(RobotsTxtTTL)}
+		c.robotsTxts[origin] = entry
+	}
+	c.mutex.Unlock()
+
+	entry.once.Do(func() {
+		robotsTxt, ttl := c.fetchRobotsTxt(origin)
+		entry.robotsTxt = robotsTxt
+
+		c.mutex.Lock()
+		entry.expires = time.Now().Add(ttl)
+		c.mutex.Unlock()
+	})
+
+	return entry.robotsTxt
+}
+
+// fetchRobotsTxt returns the robots.txt of the origin and how long it should be kept.
+// Server errors disallow all as required by RFC 9309, failures are only kept for a short time.
+func (c *crawler) fetchRobotsTxt(origin string) (*RobotsTxt, time.Duration) {
+	c.mutex.Lock()
+	client := c.client
+	userAgent := c.requestHeader.Get("User-Agent")
+	c.mutex.Unlock()
+
+	loggerContext := c.logger.WithField("origin", origin)
+
+	req, err := http.NewRequest("GET", origin+RobotsTxtPath, nil)
+	if err != nil {
+		loggerContext.WithError(err).Error("Cannot create robots.txt request")
+		return nil, RobotsTxtTTL
+	}
+	req.Header.Set("User-Agent", userAgent)
+	setAcceptEncoding(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		loggerContext.WithError(err).Debug("Cannot fetch robots.txt -> allow all")
+		return nil, RobotsTxtErrorTTL
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		loggerContext.WithField("statusCode", resp.StatusCode).Info("Server error for robots.txt -> disallow all")
+		disallowAll := &RobotsTxt{}
+		disallowAll.addRule(false, "/")
+		return disallowAll, RobotsTxtErrorTTL
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		loggerContext.WithField("statusCode", resp.StatusCode).Debug("No robots.txt -> allow all")
+		return nil, RobotsTxtTTL
+	}
+
+	if err = decodeBody(resp); err != nil {
+		loggerContext.WithError(err).Debug("Cannot decode robots.txt -> allow all")
+		return nil, RobotsTxtErrorTTL
+	}
+
+	robotsTxt := ParseRobotsTxt(resp.Body, userAgent)
+	loggerContext.WithFields(logrus.Fields{
+		"rules":      len(robotsTxt.rules),
+		"crawlDelay": robotsTxt.CrawlDelay,
+	}).Info("Fetched robots.txt")
+
+	return robotsTxt, RobotsTxtTTL
+}
@@ -0,0 +1,218 @@
+package crawler_test
+
+import (
+	neturl "net/url"
+	"strings"
+	"time"
+
+	. "github.com/daohoangson/go-sitemirror/crawler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Robots", func() {
+	const userAgent = "go-sitemirror/unknown (Googlebot wannabe)"
+
+	parse := func(lines ...string) *RobotsTxt {
+		return ParseRobotsTxt(strings.NewReader(strings.Join(lines, "\n")), userAgent)
+	}
+
+	expectAllowed := func(r *RobotsTxt, url string, allowed bool) {
+		parsedURL, err := neturl.Parse(url)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, r.IsAllowed(parsedURL)).To(Equal(allowed))
+	}
+
+	Describe("GetUserAgentToken", func() {
+		It("should return product token", func() {
+			Expect(GetUserAgentToken(userAgent)).To(Equal("go-sitemirror"))
+		})
+
+		It("should lower case", func() {
+			Expect(GetUserAgentToken("Googlebot")).To(Equal("googlebot"))
+		})
+	})
+
+	Describe("ParseRobotsTxt", func() {
+		It("should allow all on empty content", func() {
+			r := parse()
+
+			expectAllowed(r, "https://domain.com/", true)
+			Expect(r.CrawlDelay).To(Equal(time.Duration(0)))
+		})
+
+		It("should allow all on nil", func() {
+			var r *RobotsTxt
+
+			expectAllowed(r, "https://domain.com/", true)
+		})
+
+		It("should disallow with wildcard group", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow: /private",
+			)
+
+			expectAllowed(r, "https://domain.com/", true)
+			expectAllowed(r, "https://domain.com/private", false)
+			expectAllowed(r, "https://domain.com/private/page", false)
+		})
+
+		It("should ignore empty disallow", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow:",
+			)
+
+			expectAllowed(r, "https://domain.com/page", true)
+		})
+
+		It("should ignore comments", func() {
+			r := parse(
+				"# comment",
+				"User-agent: * # everyone",
+				"Disallow: /private # secret",
+			)
+
+			expectAllowed(r, "https://domain.com/private", false)
+		})
+
+		It("should prefer specific group", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow: /",
+				"",
+				"User-agent: go-sitemirror",
+				"Disallow: /private",
+			)
+
+			expectAllowed(r, "https://domain.com/page", true)
+			expectAllowed(r, "https://domain.com/private", false)
+		})
+
+		It("should ignore other groups", func() {
+			r := parse(
+				"User-agent: Googlebot",
+				"Disallow: /",
+			)
+
+			expectAllowed(r, "https://domain.com/page", true)
+		})
+
+		It("should match agent case-insensitive", func() {
+			r := parse(
+				"User-agent: GO-SITEMIRROR",
+				"Disallow: /private",
+			)
+
+			expectAllowed(r, "https://domain.com/private", false)
+		})
+
+		It("should not match agent prefix", func() {
+			r := parse(
+				"User-agent: go",
+				"Disallow: /",
+				"",
+				"User-agent: go-sitemirror-news",
+				"Disallow: /",
+			)
+
+			expectAllowed(r, "https://domain.com/page", true)
+		})
+
+		It("should support group with multiple agents", func() {
+			r := parse(
+				"User-agent: Googlebot",
+				"User-agent: go-sitemirror",
+				"Disallow: /private",
+			)
+
+			expectAllowed(r, "https://domain.com/private", false)
+		})
+
+		It("should use the longest match", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow: /folder",
+				"Allow: /folder/page",
+			)
+
+			expectAllowed(r, "https://domain.com/folder/other", false)
+			expectAllowed(r, "https://domain.com/folder/page", true)
+		})
+
+		It("should prefer allow on tie", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow: /page",
+				"Allow: /page",
+			)
+
+			expectAllowed(r, "https://domain.com/page", true)
+		})
+
+		It("should support wildcard", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow: /*.php",
+			)
+
+			expectAllowed(r, "https://domain.com/index.html", true)
+			expectAllowed(r, "https://domain.com/index.php", false)
+			expectAllowed(r, "https://domain.com/folder/index.php?a=b", false)
+		})
+
+		It("should support end anchor", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow: /*.php$",
+			)
+
+			expectAllowed(r, "https://domain.com/index.php", false)
+			expectAllowed(r, "https://domain.com/index.php?a=b", true)
+		})
+
+		It("should match query", func() {
+			r := parse(
+				"User-agent: *",
+				"Disallow: /search?",
+			)
+
+			expectAllowed(r, "https://domain.com/search", true)
+			expectAllowed(r, "https://domain.com/search?q=foo", false)
+		})
+
+		It("should parse crawl delay", func() {
+			r := parse(
+				"User-agent: *",
+				"Crawl-delay: 1.5",
+			)
+
+			Expect(r.CrawlDelay).To(Equal(1500 * time.Millisecond))
+		})
+
+		It("should parse sitemaps", func() {
+			r := parse(
+				"Sitemap: https://domain.com/sitemap.xml",
+				"User-agent: Googlebot",
+				"Disallow: /",
+				"Sitemap: https://domain.com/news.xml",
+				"Sitemap: /relative.xml",
+			)
+
+			Expect(len(r.Sitemaps)).To(Equal(2))
+			Expect(r.Sitemaps[0].String()).To(Equal("https://domain.com/sitemap.xml"))
+			Expect(r.Sitemaps[1].String()).To(Equal("https://domain.com/news.xml"))
+		})
+
+		It("should ignore invalid crawl delay", func() {
+			r := parse(
+				"User-agent: *",
+				"Crawl-delay: x",
+			)
+
+			Expect(r.CrawlDelay).To(Equal(time.Duration(0)))
+		})
+	})
+})
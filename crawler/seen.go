@@ -0,0 +1,69 @@
+package crawler
+
+// SeenCapacity the number of urls to remember for deduplication,
+// older urls are forgotten in batches once the limit has been reached.
+// Changes only apply to crawlers created afterwards.
+var SeenCapacity = 100000
+
+// seenSet keeps two generations of urls to stay within its capacity,
+// the previous generation is dropped when the current one is full.
+type seenSet struct {
+	capacity int
+	current  map[string]bool
+	previous map[string]bool
+}
+
+func newSeenSet(capacity int) *seenSet {
+	return &seenSet{
+		capacity: capacity,
+		current:  make(map[string]bool),
+		previous: make(map[string]bool),
+	}
+}
+
+func (s *seenSet) has(key string) bool {
+	if s.current[key] {
+		return true
+	}
+
+	if s.previous[key] {
+		// move it to the current generation to keep frequently linked urls
+		s.add(key)
+		return true
+	}
+
+	return false
+}
+
+func (s *seenSet) add(key string) {
+	s.current[key] = true
+
+	if len(s.current) >= s.capacity/2 {
+		s.previous = s.current
+		s.current = make(map[string]bool)
+	}
+}
+
+func (s *seenSet) remove(key string) {
+	delete(s.current, key)
+	delete(s.previous, key)
+}
+
+func (s *seenSet) len() int {
+	return len(s.current) + len(s.previous)
+}
+
+// keys returns urls of the previous generation first so that adding them in order restores both generations
+func (s *seenSet) keys() []string {
+	keys := make([]string, 0, s.len())
+	for key := range s.previous {
+		if !s.current[key] {
+			keys = append(keys, key)
+		}
+	}
+	for key := range s.current {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
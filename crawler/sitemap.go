@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// SitemapPath the default path of sitemap if none is declared in robots.txt
+	SitemapPath = "/sitemap.xml"
+	// SitemapMaxSize the maximum number of bytes to be parsed from a sitemap (uncompressed)
+	SitemapMaxSize = 50 * 1024 * 1024
+)
+
+var (
+	sitemapGzipMagic      = []byte{0x1f, 0x8b}
+	sitemapLastModLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02",
+		"2006-01",
+		"2006",
+	}
+)
+
+type sitemapXML struct {
+	URLs     []sitemapXMLEntry `xml:"url"`
+	Sitemaps []sitemapXMLEntry `xml:"sitemap"`
+}
+
+type sitemapXMLEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// ParseSitemap returns urls from a sitemap or sitemap index, gzipped content is supported.
+// Entries without an absolute loc are skipped.
+func ParseSitemap(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(sitemapGzipMagic)); string(magic) == string(sitemapGzipMagic) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gr.Close() }()
+
+		br = bufio.NewReader(gr)
+	}
+
+	var parsed sitemapXML
+	err := xml.NewDecoder(io.LimitReader(br, SitemapMaxSize)).Decode(&parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	sitemap := &Sitemap{
+		URLs:     parseSitemapEntries(parsed.URLs),
+		Sitemaps: parseSitemapEntries(parsed.Sitemaps),
+	}
+
+	return sitemap, nil
+}
+
+func parseSitemapEntries(entries []sitemapXMLEntry) []SitemapURL {
+	urls := make([]SitemapURL, 0, len(entries))
+
+	for _, entry := range entries {
+		loc, err := neturl.Parse(strings.TrimSpace(entry.Loc))
+		if err != nil || !loc.IsAbs() {
+			continue
+		}
+
+		url := SitemapURL{Loc: loc}
+		lastMod := strings.TrimSpace(entry.LastMod)
+		for _, layout := range sitemapLastModLayouts {
+			if t, err := time.Parse(layout, lastMod); err == nil {
+				url.LastMod = &t
+				break
+			}
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls
+}
+
+func (c *crawler) GetSitemapURLs(root *neturl.URL) []*neturl.URL {
+	robotsTxt := c.getRobotsTxt(root)
+	if robotsTxt != nil && len(robotsTxt.Sitemaps) > 0 {
+		return robotsTxt.Sitemaps
+	}
+
+	url, _ := neturl.Parse(fmt.Sprintf("%s://%s%s", root.Scheme, root.Host, SitemapPath))
+	return []*neturl.URL{url}
+}
+
+func (c *crawler) DownloadSitemap(url *neturl.URL) (*Sitemap, error) {
+	c.mutex.Lock()
+	client := c.client
+	requestHeader := c.requestHeader
+	c.mutex.Unlock()
+
+	req, err := http.NewRequest("GET", url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for headerKey, headerValues := range requestHeader {
+		for _, headerValue := range headerValues {
+			req.Header.Add(headerKey, headerValue)
+		}
+	}
+	setAcceptEncoding(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if err = decodeBody(resp); err != nil {
+		return nil, err
+	}
+
+	sitemap, err := ParseSitemap(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"url":      url,
+		"urls":     len(sitemap.URLs),
+		"sitemaps": len(sitemap.Sitemaps),
+	}).Info("Downloaded sitemap")
+
+	return sitemap, nil
+}
@@ -0,0 +1,174 @@
+package crawler_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/daohoangson/go-sitemirror/cacher"
+	. "github.com/daohoangson/go-sitemirror/crawler"
+	t "github.com/daohoangson/go-sitemirror/testing"
+	"github.com/jarcoal/httpmock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sitemap", func() {
+	const urlset = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://domain.com/sitemap/page/1</loc><lastmod>2017-09-01</lastmod></url>
+	<url><loc> https://domain.com/sitemap/page/2 </loc></url>
+	<url><loc>relative/page</loc></url>
+</urlset>`
+	const sitemapindex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://domain.com/sitemap-1.xml</loc><lastmod>2017-09-01T10:20:30+07:00</lastmod></sitemap>
+</sitemapindex>`
+
+	gzipBytes := func(data string) []byte {
+		var buffer bytes.Buffer
+		w := gzip.NewWriter(&buffer)
+		_, _ = w.Write([]byte(data))
+		_ = w.Close()
+
+		return buffer.Bytes()
+	}
+
+	Describe("ParseSitemap", func() {
+		It("should parse urlset", func() {
+			sitemap, err := ParseSitemap(strings.NewReader(urlset))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(len(sitemap.URLs)).To(Equal(2))
+			Expect(len(sitemap.Sitemaps)).To(Equal(0))
+
+			Expect(sitemap.URLs[0].Loc.String()).To(Equal("https://domain.com/sitemap/page/1"))
+			Expect(*sitemap.URLs[0].LastMod).To(Equal(time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC)))
+
+			Expect(sitemap.URLs[1].Loc.String()).To(Equal("https://domain.com/sitemap/page/2"))
+			Expect(sitemap.URLs[1].LastMod).To(BeNil())
+		})
+
+		It("should parse sitemap index", func() {
+			sitemap, err := ParseSitemap(strings.NewReader(sitemapindex))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(len(sitemap.URLs)).To(Equal(0))
+			Expect(len(sitemap.Sitemaps)).To(Equal(1))
+
+			Expect(sitemap.Sitemaps[0].Loc.String()).To(Equal("https://domain.com/sitemap-1.xml"))
+			Expect(sitemap.Sitemaps[0].LastMod.Unix()).To(Equal(int64(1504236030)))
+		})
+
+		It("should parse gzipped", func() {
+			sitemap, err := ParseSitemap(bytes.NewReader(gzipBytes(urlset)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(sitemap.URLs)).To(Equal(2))
+		})
+
+		It("should relay xml error", func() {
+			_, err := ParseSitemap(strings.NewReader("<urlset>"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Crawler", func() {
+		var newCrawler = func() Crawler {
+			return New(http.DefaultClient, t.Logger())
+		}
+
+		BeforeEach(func() {
+			httpmock.Activate()
+		})
+
+		AfterEach(func() {
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should get sitemap urls from robots.txt", func() {
+			root, _ := neturl.Parse("https://sitemap.robots.com/")
+			sitemap := "https://sitemap.robots.com/sitemap_index.xml"
+			httpmock.RegisterResponder("GET", "https://sitemap.robots.com/robots.txt",
+				httpmock.NewStringResponder(200, "Sitemap: "+sitemap+"\nUser-agent: *\nDisallow:\n"))
+
+			c := newCrawler()
+			urls := c.GetSitemapURLs(root)
+			Expect(len(urls)).To(Equal(1))
+			Expect(urls[0].String()).To(Equal(sitemap))
+		})
+
+		It("should get default sitemap url", func() {
+			root, _ := neturl.Parse("https://sitemap.default.com/some/path")
+
+			c := newCrawler()
+			urls := c.GetSitemapURLs(root)
+			Expect(len(urls)).To(Equal(1))
+			Expect(urls[0].String()).To(Equal("https://sitemap.default.com/sitemap.xml"))
+		})
+
+		It("should download sitemap", func() {
+			url := "https://domain.com/sitemap.xml"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(200, urlset))
+
+			c := newCrawler()
+			sitemap, err := c.DownloadSitemap(parsedURL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(sitemap.URLs)).To(Equal(2))
+		})
+
+		It("should download gzipped sitemap", func() {
+			url := "https://domain.com/sitemap.xml.gz"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+				resp := httpmock.NewBytesResponse(200, gzipBytes(urlset))
+				resp.Header.Set(cacher.HeaderContentEncoding, "gzip")
+				return resp, nil
+			})
+
+			c := newCrawler()
+			c.SetRequestHeader(cacher.HeaderAcceptEncoding, "gzip")
+			sitemap, err := c.DownloadSitemap(parsedURL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(sitemap.URLs)).To(Equal(2))
+		})
+
+		It("should get sitemap urls from gzipped robots.txt", func() {
+			root, _ := neturl.Parse("https://sitemap.robots.gzip.com/")
+			sitemap := "https://sitemap.robots.gzip.com/sitemap_index.xml"
+			httpmock.RegisterResponder("GET", "https://sitemap.robots.gzip.com/robots.txt",
+				func(req *http.Request) (*http.Response, error) {
+					resp := httpmock.NewBytesResponse(200, gzipBytes("Sitemap: "+sitemap+"\n"))
+					resp.Header.Set(cacher.HeaderContentEncoding, "gzip")
+					return resp, nil
+				})
+
+			c := newCrawler()
+			urls := c.GetSitemapURLs(root)
+			Expect(len(urls)).To(Equal(1))
+			Expect(urls[0].String()).To(Equal(sitemap))
+		})
+
+		It("should not download sitemap (404)", func() {
+			url := "https://domain.com/sitemap.xml"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusNotFound, ""))
+
+			c := newCrawler()
+			_, err := c.DownloadSitemap(parsedURL)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should not download sitemap (request error)", func() {
+			parsedURL, _ := neturl.Parse("https://sitemap.request.error.com/sitemap.xml")
+
+			c := newCrawler()
+			_, err := c.DownloadSitemap(parsedURL)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
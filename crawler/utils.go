@@ -4,6 +4,7 @@ import (
 	"fmt"
 	neturl "net/url"
 	"path"
+	"sort"
 	"strings"
 )
 
@@ -43,6 +44,99 @@ func ReduceURL(base *neturl.URL, url *neturl.URL) string {
 	return reduced.String()
 }
 
+// TrackingQueryParams query params to be dropped by NormalizeURL if requested,
+// a name ending with * matches as prefix.
+var TrackingQueryParams = []string{
+	"_ga",
+	"dclid",
+	"fbclid",
+	"gclid",
+	"mc_cid",
+	"mc_eid",
+	"msclkid",
+	"utm_*",
+	"yclid",
+}
+
+// NormalizeURL returns a copy of the url in its canonical form:
+// lowercase scheme and host, no default port, no fragment, sorted query params.
+// Tracking query params are removed if dropTrackingParams is true.
+func NormalizeURL(url *neturl.URL, dropTrackingParams bool) *neturl.URL {
+	normalized := *url
+	normalized.Fragment = ""
+	normalized.RawFragment = ""
+	normalized.Scheme = strings.ToLower(normalized.Scheme)
+	normalized.Host = strings.ToLower(normalized.Host)
+
+	if port := normalized.Port(); len(port) > 0 {
+		if (normalized.Scheme == "http" && port == "80") ||
+			(normalized.Scheme == "https" && port == "443") {
+			normalized.Host = strings.TrimSuffix(normalized.Host, ":"+port)
+		}
+	}
+
+	normalized.ForceQuery = false
+	if len(normalized.RawQuery) > 0 {
+		normalized.RawQuery = normalizeQuery(normalized.RawQuery, dropTrackingParams)
+	}
+
+	return &normalized
+}
+
+// normalizeQuery sorts query pairs by name without re-encoding them
+func normalizeQuery(rawQuery string, dropTrackingParams bool) string {
+	type pair struct {
+		name string
+		raw  string
+	}
+
+	pairs := make([]pair, 0)
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if len(raw) == 0 {
+			continue
+		}
+
+		name := raw
+		if i := strings.Index(raw, "="); i > -1 {
+			name = raw[:i]
+		}
+		if unescaped, err := neturl.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if dropTrackingParams && isTrackingQueryParam(name) {
+			continue
+		}
+
+		pairs = append(pairs, pair{name, raw})
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].name < pairs[j].name })
+
+	raws := make([]string, len(pairs))
+	for i, p := range pairs {
+		raws[i] = p.raw
+	}
+
+	return strings.Join(raws, "&")
+}
+
+func isTrackingQueryParam(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, param := range TrackingQueryParams {
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+
+	return false
+}
+
 // LongestCommonPrefix returns the common path elements between two paths
 func LongestCommonPrefix(path1 string, path2 string) string {
 	const sep = "/"
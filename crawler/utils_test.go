@@ -256,6 +256,62 @@ var _ = Describe("Utils", func() {
 		})
 	})
 
+	Describe("NormalizeURL", func() {
+		normalize := func(url string, dropTrackingParams bool) string {
+			parsedURL, err := neturl.Parse(url)
+			Expect(err).ToNot(HaveOccurred())
+
+			return NormalizeURL(parsedURL, dropTrackingParams).String()
+		}
+
+		It("should lowercase scheme and host", func() {
+			Expect(normalize("HTTPS://Domain.COM/Path", false)).To(Equal("https://domain.com/Path"))
+		})
+
+		It("should strip default http port", func() {
+			Expect(normalize("http://domain.com:80/", false)).To(Equal("http://domain.com/"))
+		})
+
+		It("should strip default https port", func() {
+			Expect(normalize("https://domain.com:443/", false)).To(Equal("https://domain.com/"))
+		})
+
+		It("should keep non-default port", func() {
+			Expect(normalize("https://domain.com:80/", false)).To(Equal("https://domain.com:80/"))
+		})
+
+		It("should drop fragment", func() {
+			Expect(normalize("https://domain.com/#foo", false)).To(Equal("https://domain.com/"))
+		})
+
+		It("should sort query params", func() {
+			Expect(normalize("https://domain.com/?b=2&a=1&b=1", false)).To(Equal("https://domain.com/?a=1&b=2&b=1"))
+		})
+
+		It("should keep query encoding", func() {
+			Expect(normalize("https://domain.com/?q=a%20b&flag", false)).To(Equal("https://domain.com/?flag&q=a%20b"))
+		})
+
+		It("should keep tracking params", func() {
+			Expect(normalize("https://domain.com/?utm_source=foo", false)).To(Equal("https://domain.com/?utm_source=foo"))
+		})
+
+		It("should drop tracking params", func() {
+			Expect(normalize("https://domain.com/?utm_source=foo&a=1&fbclid=bar&UTM_MEDIUM=baz", true)).To(Equal("https://domain.com/?a=1"))
+		})
+
+		It("should drop empty query", func() {
+			Expect(normalize("https://domain.com/?utm_source=foo", true)).To(Equal("https://domain.com/"))
+		})
+
+		It("should not modify input", func() {
+			parsedURL, _ := neturl.Parse("https://Domain.com/?b=2&a=1")
+			_ = NormalizeURL(parsedURL, false)
+
+			Expect(parsedURL.String()).To(Equal("https://Domain.com/?b=2&a=1"))
+		})
+	})
+
 	Describe("LongestCommonPrefix", func() {
 		Context("has slash prefix", func() {
 			It("should handle no common prefix", func() {
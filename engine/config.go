@@ -1,17 +1,25 @@
 package engine
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	neturl "net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/daohoangson/go-sitemirror/cacher"
+	"github.com/daohoangson/go-sitemirror/crawler"
 	"github.com/namsral/flag"
 )
 
@@ -20,13 +28,29 @@ type Config struct {
 	LoggerLevel configLoggerLevel
 
 	HostRewrites        configStringMap
+	HostsBlacklist      configStringSlice
 	HostsWhitelist      configStringSlice
+	URLRules            configURLRules
+	StaleIfError        configStringSlice
 	BumpTTL             time.Duration
+	MaxStale            time.Duration
+	MissWait            time.Duration
 	AutoEnqueueInterval time.Duration
+	SeedSitemaps        bool
+	Offline             bool
+	OfflineStatusCode   int64
+	OfflinePage         string
 	HttpTimeout         time.Duration
 
+	HttpProxy              string
+	HttpCACerts            configStringSlice
+	HttpClientCerts        configStringSlice
+	HttpClientKeys         configStringSlice
+	HttpInsecureSkipVerify bool
+
 	Cacher  configCacher
 	Crawler configCrawler
+	OneShot configOneShot
 
 	Port        int64
 	MirrorURLs  configURLSlice
@@ -39,20 +63,48 @@ type configCacher struct {
 }
 
 type configCrawler struct {
-	AutoDownloadDepth configUint64
-	NoCrossHost       bool
-	RequestHeader     configHTTPHeader
-	WorkerCount       configUint64
+	AutoDownloadDepth     configUint64
+	CookieJar             string
+	DropTrackingParams    bool
+	HostConcurrency       configUint64
+	HostMaxBytes          configUint64
+	HostMaxPages          configUint64
+	HostRequestsPerSecond float64
+	MaxBodySize           configUint64
+	NoCrossHost           bool
+	IgnoreRobotsTxt       bool
+	LoginURL              string
+	LoginForm             configFormValues
+	LoginFormFile         string
+	LoginExpired          string
+	RequestHeader         configHTTPHeader
+	Resume                bool
+	Retries               configUint64
+	RetryDelay            time.Duration
+	WorkerCount           configUint64
+}
+
+type configOneShot struct {
+	Enabled         bool
+	MaxErrors       int64
+	MaxClientErrors int64
 }
 
+type configFormValues neturl.Values
 type configHTTPHeader http.Header
 type configLoggerLevel logrus.Level
 type configIntSlice []int
 type configStringMap map[string]string
 type configStringSlice []string
 type configUint64 uint64
+type configURLRules []URLRule
 type configURLSlice []*neturl.URL
 
+type configURLRulesFlag struct {
+	rules   *configURLRules
+	include bool
+}
+
 const (
 	// ConfigEnvVarPrefix the environment variable prefix
 	ConfigEnvVarPrefix = "SITEMIRROR"
@@ -60,18 +112,56 @@ const (
 	ConfigDefaultLoggerLevel = logrus.InfoLevel
 	// ConfigDefaultBumpTTL default value for .BumpTTL
 	ConfigDefaultBumpTTL = time.Minute
+	// ConfigDefaultMaxStale default value for .MaxStale
+	ConfigDefaultMaxStale = time.Duration(0)
+	// ConfigDefaultMissWait default value for .MissWait
+	ConfigDefaultMissWait = time.Duration(0)
 	// ConfigDefaultAutoEnqueueInterval default value for .AutoEnqueueInterval
 	ConfigDefaultAutoEnqueueInterval = time.Duration(0)
+	// ConfigDefaultSeedSitemaps default value for .SeedSitemaps
+	ConfigDefaultSeedSitemaps = false
+	// ConfigDefaultOffline default value for .Offline
+	ConfigDefaultOffline = false
+	// ConfigDefaultOfflineStatusCode default value for .OfflineStatusCode
+	ConfigDefaultOfflineStatusCode = int64(404)
 	// ConfigDefaultHttpTimeout default value for .HttpTimeout
 	ConfigDefaultHttpTimeout = 10 * time.Second
+	// ConfigDefaultHttpInsecureSkipVerify default value for .HttpInsecureSkipVerify
+	ConfigDefaultHttpInsecureSkipVerify = false
 	// ConfigDefaultCacherDefaultTTL default value for .Cacher.DefaultTTL
 	ConfigDefaultCacherDefaultTTL = 10 * time.Minute
 	// ConfigDefaultCrawlerAutoDownloadDepth default value for .Crawler.AutoDownloadDepth
 	ConfigDefaultCrawlerAutoDownloadDepth = uint64(1)
+	// ConfigDefaultCrawlerDropTrackingParams default value for .Crawler.DropTrackingParams
+	ConfigDefaultCrawlerDropTrackingParams = false
+	// ConfigDefaultCrawlerHostConcurrency default value for .Crawler.HostConcurrency
+	ConfigDefaultCrawlerHostConcurrency = uint64(0)
+	// ConfigDefaultCrawlerHostMaxBytes default value for .Crawler.HostMaxBytes
+	ConfigDefaultCrawlerHostMaxBytes = uint64(0)
+	// ConfigDefaultCrawlerHostMaxPages default value for .Crawler.HostMaxPages
+	ConfigDefaultCrawlerHostMaxPages = uint64(0)
+	// ConfigDefaultCrawlerHostRequestsPerSecond default value for .Crawler.HostRequestsPerSecond
+	ConfigDefaultCrawlerHostRequestsPerSecond = float64(0)
+	// ConfigDefaultCrawlerMaxBodySize default value for .Crawler.MaxBodySize
+	ConfigDefaultCrawlerMaxBodySize = uint64(0)
 	// ConfigDefaultCrawlerNoCrossHost default value for .Crawler.NoCrossHost
 	ConfigDefaultCrawlerNoCrossHost = false
+	// ConfigDefaultCrawlerIgnoreRobotsTxt default value for .Crawler.IgnoreRobotsTxt
+	ConfigDefaultCrawlerIgnoreRobotsTxt = false
+	// ConfigDefaultCrawlerResume default value for .Crawler.Resume
+	ConfigDefaultCrawlerResume = false
+	// ConfigDefaultCrawlerRetries default value for .Crawler.Retries
+	ConfigDefaultCrawlerRetries = uint64(2)
+	// ConfigDefaultCrawlerRetryDelay default value for .Crawler.RetryDelay
+	ConfigDefaultCrawlerRetryDelay = time.Second
 	// ConfigDefaultCrawlerWorkerCount default value for .Crawler.WorkerCount
 	ConfigDefaultCrawlerWorkerCount = uint64(4)
+	// ConfigDefaultOneShotEnabled default value for .OneShot.Enabled
+	ConfigDefaultOneShotEnabled = false
+	// ConfigDefaultOneShotMaxErrors default value for .OneShot.MaxErrors
+	ConfigDefaultOneShotMaxErrors = int64(-1)
+	// ConfigDefaultOneShotMaxClientErrors default value for .OneShot.MaxClientErrors
+	ConfigDefaultOneShotMaxClientErrors = int64(-1)
 	// ConfigDefaultPort default value for .Port
 	ConfigDefaultPort = int64(-1)
 )
@@ -86,23 +176,73 @@ func ParseConfig(arg0 string, otherArgs []string, output io.Writer) (*Config, er
 	config.LoggerLevel = configLoggerLevel(ConfigDefaultLoggerLevel)
 	fs.Var(&config.LoggerLevel, "log", "Logging output level")
 
-	fs.Var(&config.HostRewrites, "rewrite", "Link rewrites, must be 'source.domain.com=https://domain.com/some/path'")
-	fs.Var(&config.HostsWhitelist, "whitelist", "Restricted list of crawl-able hosts")
+	fs.Var(&config.HostRewrites, "rewrite", "Link rewrites, must be 'source.domain.com=https://domain.com/some/path', "+
+		"source can be '*.domain.com', '.domain.com' or 're:' regex")
+	fs.Var(&config.HostsBlacklist, "blacklist", "Hosts to never crawl nor rewrite links to, can be '*.domain.com', '.domain.com' or 're:' regex")
+	fs.Var(&config.HostsWhitelist, "whitelist", "Restricted list of crawl-able hosts, can be '*.domain.com', '.domain.com' or 're:' regex")
+	fs.Var(&configURLRulesFlag{&config.URLRules, true}, "include", "URL pattern to include, glob or 're:' regex, rules are matched in order")
+	fs.Var(&configURLRulesFlag{&config.URLRules, false}, "exclude", "URL pattern to exclude, glob or 're:' regex, rules are matched in order")
+	fs.Var(&config.StaleIfError, "stale-if-error", "Status code or class like '404' or '4xx' that never replaces a cached 2xx response, "+
+		"network errors and 5xx never replace any cache")
 	fs.DurationVar(&config.BumpTTL, "cache-bump", ConfigDefaultBumpTTL, "Validity of cache bump")
+	fs.DurationVar(&config.MaxStale, "max-stale", ConfigDefaultMaxStale, "Maximum staleness of expired cache before user requests block on refresh, default=no limit")
+	fs.DurationVar(&config.MissWait, "miss-wait", ConfigDefaultMissWait, "Maximum wait for urls not in cache before a retry page is served, default=wait for download")
 	fs.DurationVar(&config.AutoEnqueueInterval, "auto-refresh", ConfigDefaultAutoEnqueueInterval, "Interval for url auto refreshes, default=no refresh")
+	//noinspection GoBoolExpressions
+	fs.BoolVar(&config.SeedSitemaps, "sitemap", ConfigDefaultSeedSitemaps, "Enqueue urls from sitemaps declared in robots.txt or /sitemap.xml")
+	//noinspection GoBoolExpressions
+	fs.BoolVar(&config.Offline, "offline", ConfigDefaultOffline, "Serve cached data only and never contact the origin, stale cache is served as is")
+	fs.Int64Var(&config.OfflineStatusCode, "offline-status", ConfigDefaultOfflineStatusCode, "Status code for urls not in cache in offline mode, must be 404 or 504")
+	fs.StringVar(&config.OfflinePage, "offline-page", "", "Path to the page for urls not in cache in offline mode")
 	fs.DurationVar(&config.HttpTimeout, "http-timeout", ConfigDefaultHttpTimeout, "HTTP request timeout")
+	fs.StringVar(&config.HttpProxy, "http-proxy", "", "Proxy URL for HTTP requests, must be 'http://', 'https://' or 'socks5://'")
+	fs.Var(&config.HttpCACerts, "http-ca-cert", "Path to extra CA certificates in PEM format")
+	fs.Var(&config.HttpClientCerts, "http-client-cert", "Path to client certificate in PEM format, each should have a matching -http-client-key")
+	fs.Var(&config.HttpClientKeys, "http-client-key", "Path to client private key in PEM format")
+	//noinspection GoBoolExpressions
+	fs.BoolVar(&config.HttpInsecureSkipVerify, "http-insecure-skip-verify", ConfigDefaultHttpInsecureSkipVerify, "Skip TLS certificate verification, for testing only")
 
 	fs.StringVar(&config.Cacher.Path, "cache-path", "", "HTTP Cache path (default working directory)")
 	fs.DurationVar(&config.Cacher.DefaultTTL, "cache-ttl", ConfigDefaultCacherDefaultTTL, "Validity of cached data")
 
 	config.Crawler.AutoDownloadDepth = configUint64(ConfigDefaultCrawlerAutoDownloadDepth)
 	fs.Var(&config.Crawler.AutoDownloadDepth, "auto-download-depth", "Maximum link depth for auto downloads, default=1")
+	fs.StringVar(&config.Crawler.CookieJar, "cookie-jar", "", "Path to save cookies between runs, default=no cookies unless logging in")
+	//noinspection GoBoolExpressions
+	fs.BoolVar(&config.Crawler.DropTrackingParams, "drop-tracking-params", ConfigDefaultCrawlerDropTrackingParams, "Ignore tracking query params like utm_* when deduplicating crawled urls")
+	config.Crawler.HostConcurrency = configUint64(ConfigDefaultCrawlerHostConcurrency)
+	fs.Var(&config.Crawler.HostConcurrency, "host-concurrency", "Maximum number of concurrent requests per host, default=no limit")
+	config.Crawler.HostMaxBytes = configUint64(ConfigDefaultCrawlerHostMaxBytes)
+	fs.Var(&config.Crawler.HostMaxBytes, "host-max-bytes", "Maximum total bytes to download per host before links to it are no longer enqueued, default=no limit")
+	config.Crawler.HostMaxPages = configUint64(ConfigDefaultCrawlerHostMaxPages)
+	fs.Var(&config.Crawler.HostMaxPages, "host-max-pages", "Maximum number of html pages to download per host before links to it are no longer enqueued, default=no limit")
+	fs.Float64Var(&config.Crawler.HostRequestsPerSecond, "host-rps", ConfigDefaultCrawlerHostRequestsPerSecond, "Maximum number of requests per second per host, default=no limit")
+	config.Crawler.MaxBodySize = configUint64(ConfigDefaultCrawlerMaxBodySize)
+	fs.Var(&config.Crawler.MaxBodySize, "max-body-size", "Maximum response body size in bytes, default=no limit")
 	//noinspection GoBoolExpressions
 	fs.BoolVar(&config.Crawler.NoCrossHost, "no-cross-host", ConfigDefaultCrawlerNoCrossHost, "Disable cross-host links")
+	//noinspection GoBoolExpressions
+	fs.BoolVar(&config.Crawler.IgnoreRobotsTxt, "ignore-robots-txt", ConfigDefaultCrawlerIgnoreRobotsTxt, "Ignore robots.txt rules and Crawl-delay, for origins you own")
+	fs.StringVar(&config.Crawler.LoginURL, "login-url", "", "Login form URL to POST to before crawling")
+	fs.Var(&config.Crawler.LoginForm, "login-form", "Login form field, must be 'key=value'")
+	fs.StringVar(&config.Crawler.LoginFormFile, "login-form-file", "", "Path to login form fields, one 'key=value' per line, to keep secrets out of the command line")
+	fs.StringVar(&config.Crawler.LoginExpired, "login-expired", "", "Regex of redirect locations for expired sessions, default=redirect to login url")
 	fs.Var(&config.Crawler.RequestHeader, "header", "Custom request header, must be 'key=value'")
+	//noinspection GoBoolExpressions
+	fs.BoolVar(&config.Crawler.Resume, "resume", ConfigDefaultCrawlerResume, "Persist crawl queue under the cache path and resume it on startup")
+	config.Crawler.Retries = configUint64(ConfigDefaultCrawlerRetries)
+	fs.Var(&config.Crawler.Retries, "retries", "Number of retries for transient download errors")
+	fs.DurationVar(&config.Crawler.RetryDelay, "retry-delay", ConfigDefaultCrawlerRetryDelay, "Initial delay between retries, doubled after each attempt")
 	config.Crawler.WorkerCount = configUint64(ConfigDefaultCrawlerWorkerCount)
 	fs.Var(&config.Crawler.WorkerCount, "workers", "Number of download workers")
 
+	//noinspection GoBoolExpressions
+	fs.BoolVar(&config.OneShot.Enabled, "one-shot", ConfigDefaultOneShotEnabled, "Exit after mirror urls have been crawled, with a summary")
+	fs.Int64Var(&config.OneShot.MaxErrors, "one-shot-max-errors", ConfigDefaultOneShotMaxErrors,
+		"Maximum number of network, 5xx and cache errors before exiting with non-zero code, default=no limit")
+	fs.Int64Var(&config.OneShot.MaxClientErrors, "one-shot-max-4xx", ConfigDefaultOneShotMaxClientErrors,
+		"Maximum number of 4xx responses before exiting with non-zero code, default=no limit")
+
 	fs.Int64Var(&config.Port, "port", ConfigDefaultPort, "Port to mirror all sites")
 	fs.Var(&config.MirrorURLs, "mirror", "URL to mirror, multiple urls are supported")
 	fs.Var(&config.MirrorPorts, "mirror-port", "Port to mirror a single site, each port number should immediately follow its URL. "+
@@ -119,6 +259,14 @@ func FromConfig(fs cacher.Fs, config *Config) Engine {
 		Timeout: config.HttpTimeout,
 	}
 
+	transport, transportError := buildHTTPTransport(config)
+	if transportError != nil {
+		panic(transportError)
+	}
+	if transport != nil {
+		httpClient.Transport = transport
+	}
+
 	logger := logrus.New()
 	logger.Level = logrus.Level(config.LoggerLevel)
 
@@ -127,20 +275,81 @@ func FromConfig(fs cacher.Fs, config *Config) Engine {
 	{
 		if config.HostRewrites != nil {
 			hostRewrites := map[string]string(config.HostRewrites)
-			for from, to := range hostRewrites {
-				e.AddHostRewrite(from, to)
+			froms := make([]string, 0, len(hostRewrites))
+			for from := range hostRewrites {
+				froms = append(froms, from)
+			}
+			// sort for deterministic order of overlapping patterns
+			sort.Strings(froms)
+
+			for _, from := range froms {
+				addHostRewriteError := e.AddHostRewrite(from, hostRewrites[from])
+				if addHostRewriteError != nil {
+					panic(addHostRewriteError)
+				}
+			}
+		}
+
+		if config.HostsBlacklist != nil {
+			hostsBlacklist := []string(config.HostsBlacklist)
+			for _, host := range hostsBlacklist {
+				addHostBlacklistedError := e.AddHostBlacklisted(host)
+				if addHostBlacklistedError != nil {
+					panic(addHostBlacklistedError)
+				}
 			}
 		}
 
 		if config.HostsWhitelist != nil {
 			hostsWhitelist := []string(config.HostsWhitelist)
 			for _, host := range hostsWhitelist {
-				e.AddHostWhitelisted(host)
+				addHostWhitelistedError := e.AddHostWhitelisted(host)
+				if addHostWhitelistedError != nil {
+					panic(addHostWhitelistedError)
+				}
+			}
+		}
+
+		if config.URLRules != nil {
+			urlRules := []URLRule(config.URLRules)
+			for _, rule := range urlRules {
+				addURLRuleError := e.AddURLRule(rule.Include, rule.Pattern)
+				if addURLRuleError != nil {
+					panic(addURLRuleError)
+				}
+			}
+		}
+
+		if config.StaleIfError != nil {
+			staleIfError := []string(config.StaleIfError)
+			for _, status := range staleIfError {
+				addStaleIfErrorError := e.AddStaleIfError(status)
+				if addStaleIfErrorError != nil {
+					panic(addStaleIfErrorError)
+				}
 			}
 		}
 
 		e.SetBumpTTL(config.BumpTTL)
+		e.SetMissWait(config.MissWait)
+		e.GetServer().SetMaxStale(config.MaxStale)
 		e.SetAutoEnqueueInterval(config.AutoEnqueueInterval)
+		e.SetSeedSitemaps(config.SeedSitemaps)
+		e.SetOffline(config.Offline)
+
+		offlineBody := []byte(ResponseBodyOffline)
+		if len(config.OfflinePage) > 0 {
+			var readError error
+			offlineBody, readError = os.ReadFile(config.OfflinePage)
+			if readError != nil {
+				panic(readError)
+			}
+		}
+
+		setOfflinePageError := e.SetOfflinePage(int(config.OfflineStatusCode), offlineBody)
+		if setOfflinePageError != nil {
+			panic(setOfflinePageError)
+		}
 	}
 
 	{
@@ -154,7 +363,13 @@ func FromConfig(fs cacher.Fs, config *Config) Engine {
 	{
 		crawler := e.GetCrawler()
 		crawler.SetAutoDownloadDepth(uint64(config.Crawler.AutoDownloadDepth))
+		crawler.SetDropTrackingParams(config.Crawler.DropTrackingParams)
+		crawler.SetHostConcurrency(uint64(config.Crawler.HostConcurrency))
+		crawler.SetHostMaxBytes(uint64(config.Crawler.HostMaxBytes))
+		crawler.SetHostMaxPages(uint64(config.Crawler.HostMaxPages))
+		crawler.SetMaxBodySize(uint64(config.Crawler.MaxBodySize))
 		crawler.SetNoCrossHost(config.Crawler.NoCrossHost)
+		crawler.SetRespectRobotsTxt(!config.Crawler.IgnoreRobotsTxt)
 
 		if config.Crawler.RequestHeader != nil {
 			requestHeader := http.Header(config.Crawler.RequestHeader)
@@ -165,10 +380,50 @@ func FromConfig(fs cacher.Fs, config *Config) Engine {
 			}
 		}
 
+		if len(config.Crawler.CookieJar) > 0 {
+			setCookieJarPathError := crawler.SetCookieJarPath(config.Crawler.CookieJar)
+			if setCookieJarPathError != nil {
+				panic(setCookieJarPathError)
+			}
+		}
+
+		if len(config.Crawler.LoginURL) > 0 {
+			login, buildLoginError := buildCrawlerLogin(config)
+			if buildLoginError != nil {
+				panic(buildLoginError)
+			}
+
+			setLoginError := crawler.SetLogin(login)
+			if setLoginError != nil {
+				panic(setLoginError)
+			}
+		}
+
+		crawler.SetRetries(uint64(config.Crawler.Retries))
+		crawler.SetRetryDelay(config.Crawler.RetryDelay)
+
+		setHostRequestsPerSecondError := crawler.SetHostRequestsPerSecond(config.Crawler.HostRequestsPerSecond)
+		if setHostRequestsPerSecondError != nil {
+			panic(setHostRequestsPerSecondError)
+		}
+
 		setWorkerCountError := crawler.SetWorkerCount(uint64(config.Crawler.WorkerCount))
 		if setWorkerCountError != nil {
 			panic(setWorkerCountError)
 		}
+
+		if config.Crawler.Resume && !config.Offline {
+			cachePath := e.GetCacher().GetPath()
+			mkdirError := fs.MkdirAll(cachePath, os.ModePerm)
+			if mkdirError != nil {
+				panic(mkdirError)
+			}
+
+			setFrontierPathError := crawler.SetFrontierPath(fs, path.Join(cachePath, FrontierFileName))
+			if setFrontierPathError != nil {
+				panic(setFrontierPathError)
+			}
+		}
 	}
 
 	{
@@ -199,6 +454,150 @@ func FromConfig(fs cacher.Fs, config *Config) Engine {
 	return e
 }
 
+// buildHTTPTransport returns nil if no transport option has been configured,
+// the default transport should be used in that case.
+func buildHTTPTransport(config *Config) (*http.Transport, error) {
+	if len(config.HttpProxy) == 0 &&
+		len(config.HttpCACerts) == 0 &&
+		len(config.HttpClientCerts) == 0 &&
+		len(config.HttpClientKeys) == 0 &&
+		!config.HttpInsecureSkipVerify {
+		return nil, nil
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: config.HttpInsecureSkipVerify,
+		},
+	}
+
+	if len(config.HttpProxy) > 0 {
+		proxyURL, err := neturl.Parse(config.HttpProxy)
+		if err != nil {
+			return nil, fmt.Errorf("neturl.Parse: %w", err)
+		}
+
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+			transport.Proxy = http.ProxyURL(proxyURL)
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+		}
+	}
+
+	if len(config.HttpCACerts) > 0 {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+
+		for _, caCertPath := range config.HttpCACerts {
+			pem, readError := os.ReadFile(caCertPath)
+			if readError != nil {
+				return nil, fmt.Errorf("os.ReadFile: %w", readError)
+			}
+
+			if !rootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", caCertPath)
+			}
+		}
+
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+
+	if len(config.HttpClientCerts) != len(config.HttpClientKeys) {
+		return nil, errors.New("each client certificate must have a matching key")
+	}
+
+	for i, clientCertPath := range config.HttpClientCerts {
+		cert, err := tls.LoadX509KeyPair(clientCertPath, config.HttpClientKeys[i])
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair: %w", err)
+		}
+
+		transport.TLSClientConfig.Certificates = append(transport.TLSClientConfig.Certificates, cert)
+	}
+
+	return transport, nil
+}
+
+func buildCrawlerLogin(config *Config) (*crawler.Login, error) {
+	loginURL, err := neturl.Parse(config.Crawler.LoginURL)
+	if err != nil {
+		return nil, fmt.Errorf("neturl.Parse: %w", err)
+	}
+
+	form := make(configFormValues)
+	for key, values := range config.Crawler.LoginForm {
+		form[key] = append(form[key], values...)
+	}
+	if len(config.Crawler.LoginFormFile) > 0 {
+		data, readError := os.ReadFile(config.Crawler.LoginFormFile)
+		if readError != nil {
+			return nil, fmt.Errorf("os.ReadFile: %w", readError)
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if len(strings.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			if err = form.Set(line); err != nil {
+				return nil, fmt.Errorf("%s: %w", config.Crawler.LoginFormFile, err)
+			}
+		}
+	}
+
+	login := &crawler.Login{
+		URL:  loginURL,
+		Form: neturl.Values(form),
+	}
+
+	if len(config.Crawler.LoginExpired) > 0 {
+		login.ExpiredPattern, err = regexp.Compile(config.Crawler.LoginExpired)
+		if err != nil {
+			return nil, fmt.Errorf("regexp.Compile: %w", err)
+		}
+	}
+
+	return login, nil
+}
+
+func (f *configFormValues) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *configFormValues) Set(value string) error {
+	var (
+		sep  = "="
+		help = errors.New("must be 'key=value'")
+	)
+
+	parts := strings.Split(value, sep)
+	if len(parts) < 2 {
+		return help
+	}
+	key, value := parts[0], strings.Join(parts[1:], sep)
+
+	if *f == nil {
+		*f = make(configFormValues)
+	}
+
+	neturl.Values(*f).Add(key, value)
+	return nil
+}
+
 func (f *configHTTPHeader) String() string {
 	return fmt.Sprint(*f)
 }
@@ -314,6 +713,29 @@ func (f *configUint64) Set(value string) error {
 	return nil
 }
 
+func (f *configURLRulesFlag) String() string {
+	patterns := make([]string, 0)
+	if f.rules != nil {
+		for _, rule := range *f.rules {
+			if rule.Include == f.include {
+				patterns = append(patterns, rule.Pattern)
+			}
+		}
+	}
+
+	return fmt.Sprint(patterns)
+}
+
+func (f *configURLRulesFlag) Set(value string) error {
+	rule, err := newURLRule(f.include, value)
+	if err != nil {
+		return err
+	}
+
+	*f.rules = append(*f.rules, *rule)
+	return nil
+}
+
 func (f *configURLSlice) String() string {
 	return fmt.Sprint(*f)
 }
@@ -2,15 +2,22 @@ package engine_test
 
 import (
 	"bytes"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/jarcoal/httpmock"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/daohoangson/go-sitemirror/cacher"
+	"github.com/daohoangson/go-sitemirror/crawler"
 	. "github.com/daohoangson/go-sitemirror/engine"
 	t "github.com/daohoangson/go-sitemirror/testing"
 
@@ -111,18 +118,99 @@ var _ = Describe("Config", func() {
 			})
 		})
 
+		It("should parse StaleIfError", func() {
+			c := parseConfigWithDefaultArg0("-stale-if-error", "4xx", "-stale-if-error", "503")
+
+			Expect([]string(c.StaleIfError)).To(Equal([]string{"4xx", "503"}))
+		})
+
+		Describe("URLRules", func() {
+			It("should parse in order", func() {
+				c := parseConfigWithDefaultArg0(
+					"-exclude", "/docs/private/**",
+					"-include", "/docs/**",
+					"-exclude", "re:logout",
+				)
+
+				Expect(len(c.URLRules)).To(Equal(3))
+				Expect(c.URLRules[0].Include).To(BeFalse())
+				Expect(c.URLRules[0].Pattern).To(Equal("/docs/private/**"))
+				Expect(c.URLRules[1].Include).To(BeTrue())
+				Expect(c.URLRules[1].Pattern).To(Equal("/docs/**"))
+				Expect(c.URLRules[2].Include).To(BeFalse())
+				Expect(c.URLRules[2].Pattern).To(Equal("re:logout"))
+			})
+
+			It("should handle invalid regex", func() {
+				c := parseConfigWithDefaultArg0("-include", "re:(")
+
+				Expect(c.URLRules).To(BeNil())
+			})
+		})
+
 		It("should parse BumpTTL", func() {
 			c := parseConfigWithDefaultArg0("-cache-bump", "10ms")
 
 			Expect(c.BumpTTL).To(Equal(10 * time.Millisecond))
 		})
 
+		It("should parse MaxStale", func() {
+			c := parseConfigWithDefaultArg0("-max-stale", "1h")
+
+			Expect(c.MaxStale).To(Equal(time.Hour))
+		})
+
+		It("should parse MissWait", func() {
+			c := parseConfigWithDefaultArg0("-miss-wait", "2s")
+
+			Expect(c.MissWait).To(Equal(2 * time.Second))
+		})
+
 		It("should parse AutoEnqueueInterval", func() {
 			c := parseConfigWithDefaultArg0("-auto-refresh", "1m")
 
 			Expect(c.AutoEnqueueInterval).To(Equal(time.Minute))
 		})
 
+		It("should parse SeedSitemaps", func() {
+			c := parseConfigWithDefaultArg0("-sitemap")
+
+			Expect(c.SeedSitemaps).To(BeTrue())
+		})
+
+		It("should parse Offline", func() {
+			c := parseConfigWithDefaultArg0("-offline", "-offline-status", "504", "-offline-page", "offline.html")
+
+			Expect(c.Offline).To(BeTrue())
+			Expect(c.OfflineStatusCode).To(Equal(int64(504)))
+			Expect(c.OfflinePage).To(Equal("offline.html"))
+		})
+
+		It("should parse HttpProxy", func() {
+			c := parseConfigWithDefaultArg0("-http-proxy", "socks5://localhost:1080")
+
+			Expect(c.HttpProxy).To(Equal("socks5://localhost:1080"))
+		})
+
+		It("should parse HttpCACerts", func() {
+			c := parseConfigWithDefaultArg0("-http-ca-cert", "a.pem", "-http-ca-cert", "b.pem")
+
+			Expect([]string(c.HttpCACerts)).To(Equal([]string{"a.pem", "b.pem"}))
+		})
+
+		It("should parse HttpClientCerts", func() {
+			c := parseConfigWithDefaultArg0("-http-client-cert", "cert.pem", "-http-client-key", "key.pem")
+
+			Expect([]string(c.HttpClientCerts)).To(Equal([]string{"cert.pem"}))
+			Expect([]string(c.HttpClientKeys)).To(Equal([]string{"key.pem"}))
+		})
+
+		It("should parse HttpInsecureSkipVerify", func() {
+			c := parseConfigWithDefaultArg0("-http-insecure-skip-verify")
+
+			Expect(c.HttpInsecureSkipVerify).To(BeTrue())
+		})
+
 		It("should parse HttpTimeout", func() {
 			c := parseConfigWithDefaultArg0("-http-timeout", "1m")
 
@@ -159,12 +247,84 @@ var _ = Describe("Config", func() {
 				})
 			})
 
+			Describe("HostConcurrency", func() {
+				It("should parse", func() {
+					c := parseConfigWithDefaultArg0("-host-concurrency", "2")
+
+					Expect(c.Crawler.HostConcurrency).To(BeNumerically("==", 2))
+				})
+
+				It("should handle uint conversion error", func() {
+					c := parseConfigWithDefaultArg0("-host-concurrency", "x")
+
+					Expect(c.Crawler.HostConcurrency).To(BeNumerically("==", ConfigDefaultCrawlerHostConcurrency))
+				})
+			})
+
+			It("should parse LoginForm", func() {
+				c := parseConfigWithDefaultArg0(
+					"-login-form", "username=foo",
+					"-login-form", "password=a=b",
+				)
+
+				Expect(c.Crawler.LoginForm["username"]).To(Equal([]string{"foo"}))
+				Expect(c.Crawler.LoginForm["password"]).To(Equal([]string{"a=b"}))
+			})
+
+			It("should parse LoginFormFile", func() {
+				c := parseConfigWithDefaultArg0("-login-form-file", "login.txt")
+
+				Expect(c.Crawler.LoginFormFile).To(Equal("login.txt"))
+			})
+
+			It("should handle LoginForm in wrong format", func() {
+				c := parseConfigWithDefaultArg0("-login-form", "nop")
+
+				Expect(c.Crawler.LoginForm).To(BeNil())
+			})
+
+			It("should parse HostMaxBytes", func() {
+				c := parseConfigWithDefaultArg0("-host-max-bytes", "1048576")
+
+				Expect(c.Crawler.HostMaxBytes).To(BeNumerically("==", 1048576))
+			})
+
+			It("should parse HostMaxPages", func() {
+				c := parseConfigWithDefaultArg0("-host-max-pages", "100")
+
+				Expect(c.Crawler.HostMaxPages).To(BeNumerically("==", 100))
+			})
+
+			It("should parse DropTrackingParams", func() {
+				c := parseConfigWithDefaultArg0("-drop-tracking-params")
+
+				Expect(c.Crawler.DropTrackingParams).To(BeTrue())
+			})
+
+			It("should parse HostRequestsPerSecond", func() {
+				c := parseConfigWithDefaultArg0("-host-rps", "0.5")
+
+				Expect(c.Crawler.HostRequestsPerSecond).To(Equal(0.5))
+			})
+
+			It("should parse MaxBodySize", func() {
+				c := parseConfigWithDefaultArg0("-max-body-size", "1024")
+
+				Expect(c.Crawler.MaxBodySize).To(BeNumerically("==", 1024))
+			})
+
 			It("should parse NoCrossHost", func() {
 				c := parseConfigWithDefaultArg0("-no-cross-host")
 
 				Expect(c.Crawler.NoCrossHost).To(BeTrue())
 			})
 
+			It("should parse IgnoreRobotsTxt", func() {
+				c := parseConfigWithDefaultArg0("-ignore-robots-txt")
+
+				Expect(c.Crawler.IgnoreRobotsTxt).To(BeTrue())
+			})
+
 			Describe("RequestHeader", func() {
 				It("should parse", func() {
 					c := parseConfigWithDefaultArg0("-header", "key=value")
@@ -191,6 +351,24 @@ var _ = Describe("Config", func() {
 				})
 			})
 
+			It("should parse Resume", func() {
+				c := parseConfigWithDefaultArg0("-resume")
+
+				Expect(c.Crawler.Resume).To(BeTrue())
+			})
+
+			It("should parse Retries", func() {
+				c := parseConfigWithDefaultArg0("-retries", "5")
+
+				Expect(c.Crawler.Retries).To(BeNumerically("==", 5))
+			})
+
+			It("should parse RetryDelay", func() {
+				c := parseConfigWithDefaultArg0("-retry-delay", "2s")
+
+				Expect(c.Crawler.RetryDelay).To(Equal(2 * time.Second))
+			})
+
 			Describe("WorkerCount", func() {
 				It("should parse", func() {
 					c := parseConfigWithDefaultArg0("-workers", "1")
@@ -206,6 +384,24 @@ var _ = Describe("Config", func() {
 			})
 		})
 
+		Describe("OneShot", func() {
+			It("should be disabled by default", func() {
+				c := parseConfigWithDefaultArg0()
+
+				Expect(c.OneShot.Enabled).To(BeFalse())
+				Expect(c.OneShot.MaxErrors).To(Equal(ConfigDefaultOneShotMaxErrors))
+				Expect(c.OneShot.MaxClientErrors).To(Equal(ConfigDefaultOneShotMaxClientErrors))
+			})
+
+			It("should parse", func() {
+				c := parseConfigWithDefaultArg0("-one-shot", "-one-shot-max-errors", "0", "-one-shot-max-4xx", "10")
+
+				Expect(c.OneShot.Enabled).To(BeTrue())
+				Expect(c.OneShot.MaxErrors).To(Equal(int64(0)))
+				Expect(c.OneShot.MaxClientErrors).To(Equal(int64(10)))
+			})
+		})
+
 		It("should parse Port", func() {
 			c := parseConfigWithDefaultArg0("-port", "80")
 
@@ -292,6 +488,23 @@ var _ = Describe("Config", func() {
 			Expect(e.GetHostRewrites()).To(Equal(hostRewrites))
 		})
 
+		It("should add host blacklisted", func() {
+			hostsBlacklist := []string{"*.ads.com"}
+			e := fromConfigWithDefaultArg0("-blacklist", hostsBlacklist[0])
+
+			Expect(e.GetHostsBlacklist()).To(Equal(hostsBlacklist))
+		})
+
+		It("should add stale-if-error status", func() {
+			e := fromConfigWithDefaultArg0("-stale-if-error", "404", "-stale-if-error", "403")
+
+			Expect(e.GetStaleIfError()).To(Equal([]string{"404", "403"}))
+		})
+
+		It("should panic on unsupported stale-if-error status", func() {
+			Expect(func() { fromConfigWithDefaultArg0("-stale-if-error", "2xx") }).To(Panic())
+		})
+
 		It("should add host whitelisted", func() {
 			hostsWhitelist := []string{"domain.com"}
 			e := fromConfigWithDefaultArg0("-whitelist", hostsWhitelist[0])
@@ -299,6 +512,17 @@ var _ = Describe("Config", func() {
 			Expect(e.GetHostsWhitelist()).To(Equal(hostsWhitelist))
 		})
 
+		It("should add url rules", func() {
+			e := fromConfigWithDefaultArg0("-include", "/docs/**", "-exclude", "/logout")
+
+			rules := e.GetURLRules()
+			Expect(len(rules)).To(Equal(2))
+			Expect(rules[0].Include).To(BeTrue())
+			Expect(rules[0].Pattern).To(Equal("/docs/**"))
+			Expect(rules[1].Include).To(BeFalse())
+			Expect(rules[1].Pattern).To(Equal("/logout"))
+		})
+
 		It("should set bump ttl", func() {
 			ttl := time.Hour
 			e := fromConfigWithDefaultArg0("-cache-bump", fmt.Sprintf("%s", ttl))
@@ -313,6 +537,56 @@ var _ = Describe("Config", func() {
 			Expect(e.GetAutoEnqueueInterval()).To(Equal(interval))
 		})
 
+		It("should set max stale", func() {
+			e := fromConfigWithDefaultArg0("-max-stale", "1h")
+
+			Expect(e.GetServer().GetMaxStale()).To(Equal(time.Hour))
+		})
+
+		It("should set miss wait", func() {
+			e := fromConfigWithDefaultArg0("-miss-wait", "2s")
+
+			Expect(e.GetMissWait()).To(Equal(2 * time.Second))
+		})
+
+		It("should set seed sitemaps", func() {
+			e := fromConfigWithDefaultArg0("-sitemap")
+
+			Expect(e.GetSeedSitemaps()).To(BeTrue())
+		})
+
+		Describe("Offline", func() {
+			It("should set offline", func() {
+				e := fromConfigWithDefaultArg0("-offline")
+
+				Expect(e.GetOffline()).To(BeTrue())
+				statusCode, body := e.GetOfflinePage()
+				Expect(statusCode).To(Equal(http.StatusNotFound))
+				Expect(string(body)).To(Equal(ResponseBodyOffline))
+			})
+
+			It("should set offline page", func() {
+				dir, _ := os.MkdirTemp("", "_TestConfigOfflinePage_")
+				defer func() { _ = os.RemoveAll(dir) }()
+				pagePath := filepath.Join(dir, "offline.html")
+				_ = os.WriteFile(pagePath, []byte("<h1>Offline</h1>"), 0600)
+
+				e := fromConfigWithDefaultArg0("-offline", "-offline-status", "504", "-offline-page", pagePath)
+
+				statusCode, body := e.GetOfflinePage()
+				Expect(statusCode).To(Equal(http.StatusGatewayTimeout))
+				Expect(string(body)).To(Equal("<h1>Offline</h1>"))
+			})
+
+			It("should panic on unsupported status code", func() {
+				Expect(func() { fromConfigWithDefaultArg0("-offline-status", "500") }).To(Panic())
+			})
+
+			It("should panic on missing page", func() {
+				Expect(func() { fromConfigWithDefaultArg0("-offline-page", "/no/such/offline.html") }).To(Panic())
+			})
+		})
+
 		Describe("HttpTimeout", func() {
 			It("should set default", func() {
 				e := fromConfigWithDefaultArg0()
@@ -328,6 +602,97 @@ var _ = Describe("Config", func() {
 			})
 		})
 
+		Describe("HttpTransport", func() {
+			var downloadURL = func(e Engine, url string) *crawler.Downloaded {
+				parsedURL, _ := neturl.Parse(url)
+
+				return e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL, ForceDownload: true})
+			}
+
+			It("should not verify self-signed certificate by default", func() {
+				server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				defer server.Close()
+
+				e := fromConfigWithDefaultArg0()
+				downloaded := downloadURL(e, server.URL)
+
+				Expect(downloaded.Error).To(HaveOccurred())
+			})
+
+			It("should skip verify", func() {
+				server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				defer server.Close()
+
+				e := fromConfigWithDefaultArg0("-http-insecure-skip-verify")
+				downloaded := downloadURL(e, server.URL)
+
+				Expect(downloaded.Error).ToNot(HaveOccurred())
+				Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+			})
+
+			It("should trust extra CA certificate", func() {
+				server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				defer server.Close()
+
+				dir, _ := os.MkdirTemp("", "_TestConfigCACert_")
+				defer func() { _ = os.RemoveAll(dir) }()
+				caCertPath := filepath.Join(dir, "ca.pem")
+				caCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+				_ = os.WriteFile(caCertPath, caCertPEM, 0600)
+
+				e := fromConfigWithDefaultArg0("-http-ca-cert", caCertPath)
+				downloaded := downloadURL(e, server.URL)
+
+				Expect(downloaded.Error).ToNot(HaveOccurred())
+				Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+			})
+
+			It("should use proxy", func() {
+				server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				defer server.Close()
+
+				var connectHost string
+				proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != http.MethodConnect {
+						w.WriteHeader(http.StatusMethodNotAllowed)
+						return
+					}
+					connectHost = r.Host
+
+					upstream, err := net.Dial("tcp", server.Listener.Addr().String())
+					if err != nil {
+						w.WriteHeader(http.StatusBadGateway)
+						return
+					}
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+					go func() { _, _ = io.Copy(upstream, conn) }()
+					go func() { _, _ = io.Copy(conn, upstream) }()
+				}))
+				defer proxy.Close()
+
+				e := fromConfigWithDefaultArg0("-http-proxy", proxy.URL, "-http-insecure-skip-verify")
+				downloaded := downloadURL(e, "https://domain.invalid/config/proxy")
+
+				Expect(downloaded.Error).ToNot(HaveOccurred())
+				Expect(downloaded.StatusCode).To(Equal(http.StatusOK))
+				Expect(connectHost).To(Equal("domain.invalid:443"))
+			})
+
+			It("should panic for unsupported proxy scheme", func() {
+				Expect(func() { fromConfigWithDefaultArg0("-http-proxy", "ftp://proxy") }).To(Panic())
+			})
+
+			It("should panic for missing CA certificate", func() {
+				Expect(func() { fromConfigWithDefaultArg0("-http-ca-cert", "/no/such/ca.pem") }).To(Panic())
+			})
+
+			It("should panic for client certificate without key", func() {
+				Expect(func() { fromConfigWithDefaultArg0("-http-client-cert", "cert.pem") }).To(Panic())
+			})
+		})
+
 		Describe("Cacher", func() {
 			It("should set path", func() {
 				path := "cacher/path"
@@ -354,18 +719,129 @@ var _ = Describe("Config", func() {
 				Expect(e.GetCrawler().GetAutoDownloadDepth()).To(Equal(depth))
 			})
 
+			It("should set drop tracking params", func() {
+				e := fromConfigWithDefaultArg0("-drop-tracking-params")
+
+				Expect(e.GetCrawler().GetDropTrackingParams()).To(BeTrue())
+			})
+
+			It("should set host concurrency", func() {
+				concurrency := uint64Ten
+				e := fromConfigWithDefaultArg0("-host-concurrency", fmt.Sprintf("%d", concurrency))
+
+				Expect(e.GetCrawler().GetHostConcurrency()).To(Equal(concurrency))
+			})
+
+			It("should set login", func() {
+				e := fromConfigWithDefaultArg0(
+					"-login-url", "https://domain.com/login",
+					"-login-form", "username=foo",
+					"-login-expired", "/login",
+				)
+
+				login := e.GetCrawler().GetLogin()
+				Expect(login).ToNot(BeNil())
+				Expect(login.URL.String()).To(Equal("https://domain.com/login"))
+				Expect(login.Form.Get("username")).To(Equal("foo"))
+				Expect(login.ExpiredPattern.String()).To(Equal("/login"))
+				Expect(e.GetCrawler().GetCookieJar()).ToNot(BeNil())
+			})
+
+			It("should set login form from file", func() {
+				dir, _ := os.MkdirTemp("", "_TestConfigLoginFormFile_")
+				defer func() { _ = os.RemoveAll(dir) }()
+				formPath := filepath.Join(dir, "login.txt")
+				_ = os.WriteFile(formPath, []byte("password=a=b\r\n\nremember=1\n"), 0600)
+
+				e := fromConfigWithDefaultArg0(
+					"-login-url", "https://domain.com/login",
+					"-login-form", "username=foo",
+					"-login-form-file", formPath,
+				)
+
+				login := e.GetCrawler().GetLogin()
+				Expect(login.Form.Get("username")).To(Equal("foo"))
+				Expect(login.Form.Get("password")).To(Equal("a=b"))
+				Expect(login.Form.Get("remember")).To(Equal("1"))
+			})
+
+			It("should not set login form from invalid file", func() {
+				Expect(func() {
+					fromConfigWithDefaultArg0("-login-url", "https://domain.com/login", "-login-form-file", "/no/such/login.txt")
+				}).To(Panic())
+			})
+
+			It("should set host budget", func() {
+				e := fromConfigWithDefaultArg0("-host-max-bytes", "1024", "-host-max-pages", "10")
+
+				Expect(e.GetCrawler().GetHostMaxBytes()).To(Equal(uint64(1024)))
+				Expect(e.GetCrawler().GetHostMaxPages()).To(Equal(uint64Ten))
+			})
+
+			It("should set host requests per second", func() {
+				e := fromConfigWithDefaultArg0("-host-rps", "2.5")
+
+				Expect(e.GetCrawler().GetHostRequestsPerSecond()).To(Equal(2.5))
+			})
+
+			It("should set max body size", func() {
+				e := fromConfigWithDefaultArg0("-max-body-size", "1024")
+
+				Expect(e.GetCrawler().GetMaxBodySize()).To(Equal(uint64(1024)))
+			})
+
 			It("should set no cross host", func() {
 				e := fromConfigWithDefaultArg0("-no-cross-host")
 
 				Expect(e.GetCrawler().GetNoCrossHost()).To(BeTrue())
 			})
 
+			It("should respect robots.txt by default", func() {
+				e := fromConfigWithDefaultArg0()
+
+				Expect(e.GetCrawler().GetRespectRobotsTxt()).To(BeTrue())
+			})
+
+			It("should ignore robots.txt", func() {
+				e := fromConfigWithDefaultArg0("-ignore-robots-txt")
+
+				Expect(e.GetCrawler().GetRespectRobotsTxt()).To(BeFalse())
+			})
+
 			It("should add request header", func() {
 				e := fromConfigWithDefaultArg0("-header", "key=value")
 
 				Expect(e.GetCrawler().GetRequestHeaderValues("key")).To(Equal([]string{"value"}))
 			})
 
+			It("should set cookie jar path", func() {
+				dir, _ := os.MkdirTemp("", "_TestConfigCookieJar_")
+				defer func() { _ = os.RemoveAll(dir) }()
+				cookieJarPath := filepath.Join(dir, "cookies")
+
+				e := fromConfigWithDefaultArg0("-cookie-jar", cookieJarPath)
+
+				Expect(e.GetCrawler().GetCookieJarPath()).To(Equal(cookieJarPath))
+				Expect(e.GetCrawler().GetCookieJar()).ToNot(BeNil())
+			})
+
+			It("should set frontier path", func() {
+				cachePath, _ := os.MkdirTemp("", "_TestConfigResume_")
+				defer func() { _ = os.RemoveAll(cachePath) }()
+
+				e := fromConfigWithDefaultArg0("-cache-path", cachePath, "-resume")
+				defer e.Stop()
+
+				Expect(e.GetCrawler().GetFrontierPath()).To(Equal(filepath.Join(cachePath, FrontierFileName)))
+			})
+
+			It("should set retries", func() {
+				e := fromConfigWithDefaultArg0("-retries", "5", "-retry-delay", "2s")
+
+				Expect(e.GetCrawler().GetRetries()).To(Equal(uint64(5)))
+				Expect(e.GetCrawler().GetRetryDelay()).To(Equal(2 * time.Second))
+			})
+
 			It("should set worker count", func() {
 				workers := uint64Ten
 				e := fromConfigWithDefaultArg0("-workers", fmt.Sprintf("%d", workers))
@@ -19,20 +19,54 @@ type Engine interface {
 	GetCrawler() crawler.Crawler
 	GetServer() web.Server
 
-	AddHostRewrite(string, string)
+	AddHostRewrite(string, string) error
 	GetHostRewrites() map[string]string
-	AddHostWhitelisted(string)
+	AddHostBlacklisted(string) error
+	GetHostsBlacklist() []string
+	AddHostWhitelisted(string) error
 	GetHostsWhitelist() []string
+	AddURLRule(bool, string) error
+	GetURLRules() []URLRule
+	AddStaleIfError(string) error
+	GetStaleIfError() []string
 	SetBumpTTL(time.Duration)
 	GetBumpTTL() time.Duration
+	SetMissWait(time.Duration)
+	GetMissWait() time.Duration
 	SetAutoEnqueueInterval(time.Duration)
 	GetAutoEnqueueInterval() time.Duration
+	SetSeedSitemaps(bool)
+	GetSeedSitemaps() bool
+	SetOffline(bool)
+	GetOffline() bool
+	SetOfflinePage(int, []byte) error
+	GetOfflinePage() (int, []byte)
 
 	Mirror(*url.URL, int) error
+	GetStats() Stats
+	Wait()
 	Stop()
 }
 
+const (
+	// RegexpPatternPrefix the prefix of host and url patterns in regular expression syntax
+	RegexpPatternPrefix = "re:"
+	// FrontierFileName the crawler frontier file name within the cache path
+	FrontierFileName = ".frontier"
+)
+
+const (
+	// maxSitemapsPerRoot limits the number of sitemap files to be processed for a single mirror root
+	maxSitemapsPerRoot = 1000
+)
+
 var (
 	// ResponseBodyMethodNotAllowed the text to respond when user request method is not allowed
 	ResponseBodyMethodNotAllowed = "Sorry, your request is not supported and cannot be processed."
+	// ResponseBodyURLExcluded the text to respond when user request url is excluded by url rules
+	ResponseBodyURLExcluded = "Sorry, this page is not available in the mirror."
+	// ResponseBodyMissRetry the text to respond when user request url is still being downloaded after the miss wait
+	ResponseBodyMissRetry = "Sorry, this page is being mirrored, please retry shortly."
+	// ResponseBodyOffline the text to respond when user request url is not cached in offline mode
+	ResponseBodyOffline = "Sorry, this page is not available offline."
 )
@@ -1,10 +1,15 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	neturl "net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -22,19 +27,44 @@ type engine struct {
 	crawler crawler.Crawler
 	server  web.Server
 
-	hostRewrites        map[string]engineHostRewrite
-	hostsWhitelist      []string
+	hostRewrites        []*engineHostRewrite
+	hostsBlacklist      []*hostPattern
+	hostsWhitelist      []*hostPattern
+	urlRules            []*URLRule
+	staleIfError        []*statusPattern
 	bumpTTL             time.Duration
+	missWait            time.Duration
 	autoEnqueueInterval time.Duration
+	seedSitemaps        bool
+	offline             bool
+	offlineStatusCode   int
+	offlineBody         []byte
 
 	autoEnqueueOnce     sync.Once
 	autoEnqueueUrls     []*neturl.URL
 	autoEnqueueMutex    sync.Mutex
+	autoEnqueueStop     chan time.Time
+	autoEnqueueStopOnce sync.Once
+	autoEnqueueWg       sync.WaitGroup
+	onDemand            map[string]*engineOnDemand
+	onDemandMutex       sync.Mutex
 	stopped             *abool.AtomicBool
 	downloadedSomething chan interface{}
+	seedingCount        int64
+	stats               engineStats
 }
 
-type engineHostRewrite func(*neturl.URL) string
+// engineOnDemand is an on demand download in flight, shared by all requests of the same url
+type engineOnDemand struct {
+	done       chan interface{}
+	downloaded *crawler.Downloaded
+}
+
+type engineHostRewrite struct {
+	pattern *hostPattern
+	to      string
+	rewrite func(*neturl.URL)
+}
 
 // New returns a new Engine instance
 func New(fs cacher.Fs, httpClient *http.Client, logger *logrus.Logger) Engine {
@@ -54,7 +84,11 @@ func (e *engine) init(fs cacher.Fs, httpClient *http.Client, logger *logrus.Logg
 	e.server = web.NewServer(e.cacher, logger)
 
 	e.bumpTTL = time.Minute
+	e.offlineStatusCode = http.StatusNotFound
+	e.offlineBody = []byte(ResponseBodyOffline)
 
+	e.autoEnqueueStop = make(chan time.Time, 1)
+	e.onDemand = make(map[string]*engineOnDemand)
 	e.stopped = abool.New()
 	e.downloadedSomething = make(chan interface{})
 
@@ -63,18 +97,42 @@ func (e *engine) init(fs cacher.Fs, httpClient *http.Client, logger *logrus.Logg
 	})
 
 	e.crawler.SetOnURLShouldQueue(func(u *neturl.URL) bool {
+		if e.GetOffline() {
+			return false
+		}
+
+		if e.checkHostBlacklisted(u.Host) {
+			e.logger.WithField("host", u.Host).Debug("Host is blacklisted")
+			return false
+		}
+
 		if !e.checkHostWhitelisted(u.Host) {
 			e.logger.WithFields(logrus.Fields{
 				"host": u.Host,
-				"list": e.hostsWhitelist,
+				"list": e.GetHostsWhitelist(),
 			}).Debug("Host is not whitelisted")
 			return false
 		}
 
+		if !e.checkURLAllowed(u) {
+			e.logger.WithField("url", u).Debug("Url is excluded by rules")
+			return false
+		}
+
 		return true
 	})
 
+	e.crawler.SetOnURLShouldProcess(func(u *neturl.URL) bool {
+		// keep links to blacklisted hosts as is
+		return !e.checkHostBlacklisted(u.Host)
+	})
+
 	e.crawler.SetOnURLShouldDownload(func(u *neturl.URL) bool {
+		if e.GetOffline() {
+			e.logger.WithField("url", u).Debug("Engine is offline")
+			return false
+		}
+
 		if e.cacher.CheckCacheExists(u) {
 			e.logger.WithField("url", u).Debug("Cache exists for url")
 			return false
@@ -84,18 +142,40 @@ func (e *engine) init(fs cacher.Fs, httpClient *http.Client, logger *logrus.Logg
 	})
 
 	e.crawler.SetOnDownloaded(func(downloaded *crawler.Downloaded) {
-		if (downloaded.StatusCode == 0 || downloaded.StatusCode >= 500) &&
-			e.cacher.CheckCacheExists(downloaded.Input.URL) {
+		e.stats.recordDownloaded(downloaded)
+
+		if downloaded.StatusCode == http.StatusNotModified {
+			e.bumpNotModified(downloaded)
+			e.notifyDownloadedSomething()
+			return
+		}
+
+		if e.checkKeepStale(downloaded) {
+			// retries have been exhausted at this point, keep the existing cache
 			e.logger.WithFields(logrus.Fields{
 				"url":        downloaded.Input.URL,
 				"statusCode": downloaded.StatusCode,
+				"attempts":   downloaded.Attempts,
 			}).Debug("Skipped writing cache")
+
+			staleError := e.cacher.SetStale(downloaded.Input.URL, true)
+			if staleError != nil {
+				e.logger.WithFields(logrus.Fields{
+					"url":        downloaded.Input.URL,
+					"staleError": staleError,
+				}).Error("Failed to mark cache as stale")
+			}
 			return
 		}
 
 		input := BuildCacherInputFromCrawlerDownloaded(downloaded)
 		cacheError := e.cacher.Write(input)
+		if errors.Is(cacheError, crawler.ErrBodyTooLarge) {
+			// the limit is only hit while streaming without content length, store an error entry like buffered bodies
+			cacheError = e.cacher.Write(&cacher.Input{StatusCode: http.StatusBadGateway, URL: input.URL})
+		}
 		if cacheError != nil {
+			e.stats.recordCacheError()
 			e.logger.WithFields(logrus.Fields{
 				"url":        downloaded.Input.URL,
 				"statusCode": downloaded.StatusCode,
@@ -103,28 +183,93 @@ func (e *engine) init(fs cacher.Fs, httpClient *http.Client, logger *logrus.Logg
 			}).Error("Failed to write cache")
 		}
 
-		e.mutex.Lock()
-		if !e.stopped.IsSet() {
-			select {
-			case e.downloadedSomething <- true:
-			default:
-			}
-		}
-		e.mutex.Unlock()
+		e.notifyDownloadedSomething()
 	})
 
+	serveOffline := func(issue *web.ServerIssue) {
+		statusCode, body := e.GetOfflinePage()
+		issue.Info.SetStatusCode(statusCode)
+		issue.Info.WriteBody(body)
+	}
+
+	serveCache := func(issue *web.ServerIssue) bool {
+		cache, openError := e.cacher.Open(issue.URL)
+		if openError != nil {
+			return false
+		}
+
+		web.ServeHTTPCache(cache, issue.Info)
+		_ = cache.Close()
+		return true
+	}
+
+	serveRetry := func(issue *web.ServerIssue, wait time.Duration) {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+
+		issue.Info.SetStatusCode(http.StatusServiceUnavailable)
+		issue.Info.AddHeader(cacher.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		issue.Info.WriteBody([]byte(ResponseBodyMissRetry))
+	}
+
 	downloadAndServe := func(issue *web.ServerIssue) {
-		placeholderError := e.cacher.WritePlaceholder(issue.URL, e.bumpTTL)
+		if e.GetOffline() {
+			serveOffline(issue)
+			return
+		}
+
+		if e.checkHostBlacklisted(issue.URL.Host) || !e.checkURLAllowed(issue.URL) {
+			issue.Info.SetStatusCode(http.StatusNotFound)
+			issue.Info.WriteBody([]byte(ResponseBodyURLExcluded))
+			return
+		}
+
+		wait := e.GetMissWait()
+		var placeholderError error
+		if wait == 0 {
+			// other requests are served the placeholder until the download completes,
+			// with miss wait they join the download in flight instead
+			placeholderError = e.cacher.WritePlaceholder(issue.URL, e.bumpTTL)
+		}
 		if placeholderError != nil {
 			e.logger.WithFields(logrus.Fields{
 				"url":              issue.URL,
 				"placeholderError": placeholderError,
 			}).Error("Failed to write placeholder")
 		} else {
-			downloaded := e.crawler.Download(crawler.QueueItem{
-				URL:           issue.URL,
-				ForceDownload: true,
-			})
+			downloaded := e.downloadOnDemand(issue.URL, wait)
+			if downloaded == nil {
+				e.logger.WithFields(logrus.Fields{
+					"url":  issue.URL,
+					"wait": wait,
+				}).Debug("Download is still in progress")
+				serveRetry(issue, wait)
+				return
+			}
+
+			if downloaded.BodyReader != nil {
+				// the body has been streamed to cache
+				if serveCache(issue) {
+					return
+				}
+			}
+			web.ServeDownloaded(downloaded, issue.Info)
+		}
+	}
+
+	refreshAndServe := func(issue *web.ServerIssue) {
+		if e.GetOffline() {
+			if !serveCache(issue) {
+				serveOffline(issue)
+			}
+			return
+		}
+
+		downloaded := e.downloadOnDemand(issue.URL, 0)
+		// serve from cache because the last-good copy may have been kept
+		if !serveCache(issue) {
 			web.ServeDownloaded(downloaded, issue.Info)
 		}
 	}
@@ -136,12 +281,18 @@ func (e *engine) init(fs cacher.Fs, httpClient *http.Client, logger *logrus.Logg
 			downloadAndServe(issue)
 		case web.CacheError:
 			downloadAndServe(issue)
+		case web.CacheTooStale:
+			refreshAndServe(issue)
 		case web.CacheExpired:
+			if e.GetOffline() {
+				// stale cache has been served as is
+				return
+			}
+
+			item := e.buildRefreshQueueItem(issue.URL)
+			item.Priority = crawler.PriorityRefresh
 			_ = e.cacher.Bump(issue.URL, e.bumpTTL)
-			e.crawler.Enqueue(crawler.QueueItem{
-				URL:           issue.URL,
-				ForceDownload: true,
-			})
+			e.crawler.Enqueue(item)
 		}
 	})
 }
@@ -158,21 +309,24 @@ func (e *engine) GetServer() web.Server {
 	return e.server
 }
 
-func (e *engine) AddHostRewrite(from string, to string) {
+func (e *engine) AddHostRewrite(from string, to string) error {
+	pattern, err := newHostPattern(from)
+	if err != nil {
+		return err
+	}
+
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
-	if e.hostRewrites == nil {
-		e.hostRewrites = make(map[string]engineHostRewrite)
-	}
-
 	var parsedTo *neturl.URL
 	if strings.HasPrefix(to, "http") {
 		parsedTo, _ = neturl.Parse(to)
 	}
 
-	e.hostRewrites[from] = func(url *neturl.URL) string {
-		if url != nil {
+	hostRewrite := &engineHostRewrite{
+		pattern: pattern,
+		to:      to,
+		rewrite: func(url *neturl.URL) {
 			if parsedTo != nil {
 				url.Scheme = parsedTo.Scheme
 				url.Host = parsedTo.Host
@@ -180,16 +334,31 @@ func (e *engine) AddHostRewrite(from string, to string) {
 			} else {
 				url.Host = to
 			}
-		}
+		},
+	}
 
-		return to
+	// copy on write, rewriteURL iterates without holding the lock
+	hostRewrites := make([]*engineHostRewrite, 0, len(e.hostRewrites)+1)
+	replaced := false
+	for _, existing := range e.hostRewrites {
+		if existing.pattern.pattern == from {
+			existing = hostRewrite
+			replaced = true
+		}
+		hostRewrites = append(hostRewrites, existing)
+	}
+	if !replaced {
+		hostRewrites = append(hostRewrites, hostRewrite)
 	}
+	e.hostRewrites = hostRewrites
 
 	e.logger.WithFields(logrus.Fields{
 		"from":     from,
 		"to":       to,
 		"mappings": len(e.hostRewrites),
 	}).Info("Added host rewrite")
+
+	return nil
 }
 
 func (e *engine) GetHostRewrites() map[string]string {
@@ -197,59 +366,165 @@ func (e *engine) GetHostRewrites() map[string]string {
 	defer e.mutex.Unlock()
 
 	hostRewrites := make(map[string]string)
+	for _, hostRewrite := range e.hostRewrites {
+		hostRewrites[hostRewrite.pattern.pattern] = hostRewrite.to
+	}
+
+	return hostRewrites
+}
+
+func (e *engine) AddHostBlacklisted(host string) error {
+	pattern, err := newHostPattern(host)
+	if err != nil {
+		return err
+	}
 
-	if e.hostRewrites != nil {
-		for from, f := range e.hostRewrites {
-			hostRewrites[from] = f(nil)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, hostBlacklist := range e.hostsBlacklist {
+		if hostBlacklist.pattern == host {
+			return nil
 		}
 	}
 
-	return hostRewrites
+	e.hostsBlacklist = append(e.hostsBlacklist, pattern)
+
+	e.logger.WithFields(logrus.Fields{
+		"host":  host,
+		"count": len(e.hostsBlacklist),
+	}).Info("Added host into blacklist")
+
+	return nil
 }
 
-func (e *engine) AddHostWhitelisted(host string) {
+func (e *engine) GetHostsBlacklist() []string {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
-	if e.hostsWhitelist == nil {
-		e.hostsWhitelist = make([]string, 1)
-		e.hostsWhitelist[0] = host
-	} else {
-		for _, hostWhitelist := range e.hostsWhitelist {
-			if hostWhitelist == host {
-				e.logger.WithFields(logrus.Fields{
-					"host": host,
-					"list": e.hostsWhitelist,
-				}).Debug("Cannot add host: already in whitelist")
+	hostsBlacklist := make([]string, len(e.hostsBlacklist))
+	for i, hostBlacklist := range e.hostsBlacklist {
+		hostsBlacklist[i] = hostBlacklist.pattern
+	}
 
-				return
-			}
-		}
+	return hostsBlacklist
+}
+
+func (e *engine) AddHostWhitelisted(host string) error {
+	pattern, err := newHostPattern(host)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, hostWhitelist := range e.hostsWhitelist {
+		if hostWhitelist.pattern == host {
+			e.logger.WithFields(logrus.Fields{
+				"host": host,
+				"list": e.getHostsWhitelistLocked(),
+			}).Debug("Cannot add host: already in whitelist")
 
-		e.hostsWhitelist = append(e.hostsWhitelist, host)
+			return nil
+		}
 	}
 
+	e.hostsWhitelist = append(e.hostsWhitelist, pattern)
+
 	e.logger.WithFields(logrus.Fields{
 		"host": host,
-		"list": e.hostsWhitelist,
+		"list": e.getHostsWhitelistLocked(),
 	}).Info("Added host into whitelist")
+
+	return nil
 }
 
 func (e *engine) GetHostsWhitelist() []string {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
+	return e.getHostsWhitelistLocked()
+}
+
+func (e *engine) getHostsWhitelistLocked() []string {
 	hostsWhitelist := make([]string, len(e.hostsWhitelist))
-	if e.hostsWhitelist != nil {
-		i := 0
-		for _, host := range e.hostsWhitelist {
-			hostsWhitelist[i] = host
-		}
+	for i, hostWhitelist := range e.hostsWhitelist {
+		hostsWhitelist[i] = hostWhitelist.pattern
 	}
 
 	return hostsWhitelist
 }
 
+func (e *engine) AddURLRule(include bool, pattern string) error {
+	rule, err := newURLRule(include, pattern)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.urlRules = append(e.urlRules, rule)
+
+	e.logger.WithFields(logrus.Fields{
+		"include": include,
+		"pattern": pattern,
+		"count":   len(e.urlRules),
+	}).Info("Added url rule")
+
+	return nil
+}
+
+func (e *engine) GetURLRules() []URLRule {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	urlRules := make([]URLRule, len(e.urlRules))
+	for i, rule := range e.urlRules {
+		urlRules[i] = *rule
+	}
+
+	return urlRules
+}
+
+func (e *engine) AddStaleIfError(status string) error {
+	pattern, err := newStatusPattern(status)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, staleIfError := range e.staleIfError {
+		if staleIfError.pattern == status {
+			return nil
+		}
+	}
+
+	e.staleIfError = append(e.staleIfError, pattern)
+
+	e.logger.WithFields(logrus.Fields{
+		"status": status,
+		"count":  len(e.staleIfError),
+	}).Info("Added stale-if-error status")
+
+	return nil
+}
+
+func (e *engine) GetStaleIfError() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	staleIfError := make([]string, len(e.staleIfError))
+	for i, pattern := range e.staleIfError {
+		staleIfError[i] = pattern.pattern
+	}
+
+	return staleIfError
+}
+
 func (e *engine) SetBumpTTL(ttl time.Duration) {
 	e.mutex.Lock()
 	e.bumpTTL = ttl
@@ -264,6 +539,20 @@ func (e *engine) GetBumpTTL() time.Duration {
 	return ttl
 }
 
+func (e *engine) SetMissWait(wait time.Duration) {
+	e.mutex.Lock()
+	e.missWait = wait
+	e.mutex.Unlock()
+}
+
+func (e *engine) GetMissWait() time.Duration {
+	e.mutex.Lock()
+	wait := e.missWait
+	e.mutex.Unlock()
+
+	return wait
+}
+
 func (e *engine) SetAutoEnqueueInterval(interval time.Duration) {
 	e.mutex.Lock()
 	e.autoEnqueueInterval = interval
@@ -278,6 +567,56 @@ func (e *engine) GetAutoEnqueueInterval() time.Duration {
 	return interval
 }
 
+func (e *engine) SetSeedSitemaps(enabled bool) {
+	e.mutex.Lock()
+	e.seedSitemaps = enabled
+	e.mutex.Unlock()
+}
+
+func (e *engine) GetSeedSitemaps() bool {
+	e.mutex.Lock()
+	enabled := e.seedSitemaps
+	e.mutex.Unlock()
+
+	return enabled
+}
+
+func (e *engine) SetOffline(enabled bool) {
+	e.mutex.Lock()
+	e.offline = enabled
+	e.mutex.Unlock()
+}
+
+func (e *engine) GetOffline() bool {
+	e.mutex.Lock()
+	enabled := e.offline
+	e.mutex.Unlock()
+
+	return enabled
+}
+
+func (e *engine) SetOfflinePage(statusCode int, body []byte) error {
+	if statusCode != http.StatusNotFound && statusCode != http.StatusGatewayTimeout {
+		return fmt.Errorf("unsupported offline status code %d", statusCode)
+	}
+
+	e.mutex.Lock()
+	e.offlineStatusCode = statusCode
+	e.offlineBody = body
+	e.mutex.Unlock()
+
+	return nil
+}
+
+func (e *engine) GetOfflinePage() (int, []byte) {
+	e.mutex.Lock()
+	statusCode := e.offlineStatusCode
+	body := e.offlineBody
+	e.mutex.Unlock()
+
+	return statusCode, body
+}
+
 func (e *engine) Mirror(url *neturl.URL, port int) error {
 	var root *neturl.URL
 
@@ -287,8 +626,16 @@ func (e *engine) Mirror(url *neturl.URL, port int) error {
 			root.Path = "/"
 		}
 
-		e.autoEnqueue(root)
-		e.crawler.Enqueue(crawler.QueueItem{URL: root})
+		if e.GetOffline() {
+			e.logger.WithField("root", root).Debug("Engine is offline, skipped crawling")
+		} else {
+			e.autoEnqueue(root)
+			e.crawler.Enqueue(crawler.QueueItem{URL: root})
+
+			if e.GetSeedSitemaps() {
+				e.seedFromSitemaps(root)
+			}
+		}
 	}
 
 	if port < 0 {
@@ -311,16 +658,30 @@ func (e *engine) Mirror(url *neturl.URL, port int) error {
 	return err
 }
 
-func (e *engine) Stop() {
-	if e.stopped.IsSet() {
-		return
+func (e *engine) GetStats() Stats {
+	return Stats{
+		Enqueued:      e.crawler.GetEnqueuedCount(),
+		Downloaded:    e.crawler.GetDownloadedCount(),
+		LinkFound:     e.crawler.GetLinkFoundCount(),
+		BudgetSkipped: e.crawler.GetBudgetSkippedCount(),
+
+		NetworkErrors: atomic.LoadUint64(&e.stats.networkErrors),
+		ServerErrors:  atomic.LoadUint64(&e.stats.serverErrors),
+		ClientErrors:  atomic.LoadUint64(&e.stats.clientErrors),
+		CacheErrors:   atomic.LoadUint64(&e.stats.cacheErrors),
 	}
+}
 
+func (e *engine) Wait() {
 	for {
-		if !e.crawler.IsBusy() {
-			e.cleanUp()
-			break
+		if e.stopped.IsSet() {
+			return
 		}
+
+		if !e.crawler.IsBusy() && atomic.LoadInt64(&e.seedingCount) == 0 {
+			return
+		}
+
 		select {
 		case <-e.downloadedSomething:
 		case <-time.After(10 * time.Millisecond):
@@ -328,10 +689,29 @@ func (e *engine) Stop() {
 	}
 }
 
+func (e *engine) Stop() {
+	if e.stopped.IsSet() {
+		return
+	}
+
+	// no more refreshes, those that were due before now are still enqueued
+	e.autoEnqueueStopOnce.Do(func() {
+		e.autoEnqueueStop <- time.Now()
+		close(e.autoEnqueueStop)
+	})
+	e.autoEnqueueWg.Wait()
+
+	if e.crawler.IsPaused() {
+		// queued items will never be picked up, drop them and only wait for downloads in flight
+		e.crawler.Stop()
+	}
+
+	e.Wait()
+	e.cleanUp()
+}
+
 func (e *engine) autoEnqueue(url *neturl.URL) {
-	e.autoEnqueueMutex.Lock()
-	interval := e.autoEnqueueInterval
-	e.autoEnqueueMutex.Unlock()
+	interval := e.GetAutoEnqueueInterval()
 
 	if interval == 0 {
 		e.logger.Debug("Engine.autoEnqueue skipped")
@@ -347,51 +727,341 @@ func (e *engine) autoEnqueue(url *neturl.URL) {
 	e.autoEnqueueMutex.Unlock()
 
 	e.autoEnqueueOnce.Do(func() {
+		// the schedule starts right away so that it does not drift
+		// with goroutine start up or the time it takes to enqueue
+		next := time.Now().Add(interval)
+		timer := time.NewTimer(interval)
+		e.autoEnqueueWg.Add(1)
+
 		go func() {
+			defer e.autoEnqueueWg.Done()
+			defer timer.Stop()
+
 			for {
-				<-time.After(interval)
+				var now time.Time
+				stopping := false
+				select {
+				case now = <-timer.C:
+				case now = <-e.autoEnqueueStop:
+					stopping = true
+				}
+
+				// catch up if this goroutine has not been scheduled in time
+				for !next.After(now) {
+					e.doAutoEnqueue()
+					next = next.Add(interval)
+				}
 
-				if e.stopped.IsSet() {
+				if stopping {
 					e.logger.Info("Engine.autoEnqueue stopped")
 					return
 				}
 
-				e.autoEnqueueMutex.Lock()
-				for _, url := range e.autoEnqueueUrls {
-					e.GetCrawler().Enqueue(crawler.QueueItem{
-						URL:           url,
-						ForceDownload: true,
-					})
-					e.logger.WithField("url", url).Debug("Engine.autoEnqueue enqueued")
-				}
-				e.autoEnqueueMutex.Unlock()
+				timer.Reset(next.Sub(now))
 			}
 		}()
 	})
 }
 
+func (e *engine) doAutoEnqueue() {
+	e.autoEnqueueMutex.Lock()
+	defer e.autoEnqueueMutex.Unlock()
+
+	for _, url := range e.autoEnqueueUrls {
+		e.GetCrawler().Enqueue(e.buildRefreshQueueItem(url))
+		e.logger.WithField("url", url).Debug("Engine.autoEnqueue enqueued")
+	}
+}
+
+func (e *engine) seedFromSitemaps(root *neturl.URL) {
+	atomic.AddInt64(&e.seedingCount, 1)
+
+	go func() {
+		defer atomic.AddInt64(&e.seedingCount, -1)
+
+		var (
+			loggerContext = e.logger.WithField("root", root)
+			queue         = e.crawler.GetSitemapURLs(root)
+			seen          = make(map[string]bool)
+			enqueued      = 0
+		)
+
+		for len(queue) > 0 && len(seen) < maxSitemapsPerRoot {
+			if e.stopped.IsSet() {
+				loggerContext.Info("Engine.seedFromSitemaps stopped")
+				return
+			}
+
+			sitemapURL := queue[0]
+			queue = queue[1:]
+			if seen[sitemapURL.String()] {
+				continue
+			}
+			seen[sitemapURL.String()] = true
+
+			sitemap, err := e.crawler.DownloadSitemap(sitemapURL)
+			if err != nil {
+				loggerContext.WithFields(logrus.Fields{
+					"sitemap": sitemapURL,
+					"error":   err,
+				}).Warn("Cannot download sitemap")
+				continue
+			}
+
+			for _, index := range sitemap.Sitemaps {
+				queue = append(queue, index.Loc)
+			}
+
+			for _, entry := range sitemap.URLs {
+				if e.seedFromSitemapURL(entry) {
+					enqueued++
+				}
+			}
+		}
+
+		loggerContext.WithFields(logrus.Fields{
+			"sitemaps": len(seen),
+			"enqueued": enqueued,
+		}).Info("Seeded from sitemaps")
+	}()
+}
+
+func (e *engine) seedFromSitemapURL(entry crawler.SitemapURL) bool {
+	url := entry.Loc
+	e.rewriteURL(url)
+
+	if e.checkHostBlacklisted(url.Host) || !e.checkHostWhitelisted(url.Host) || !e.checkURLAllowed(url) {
+		return false
+	}
+
+	// use the maximum depth so assets are downloaded but links are not followed,
+	// the sitemap should already list all pages worth mirroring
+	depth := e.crawler.GetAutoDownloadDepth()
+	item := crawler.QueueItem{
+		URL:      url,
+		Depth:    depth,
+		Priority: crawler.PriorityDiscovered - int(depth),
+	}
+
+	if entry.LastMod != nil && e.checkCacheModifiedBefore(url, *entry.LastMod) {
+		item.ForceDownload = true
+	}
+
+	e.crawler.Enqueue(item)
+	return true
+}
+
+// downloadOnDemand returns nil if the download takes longer than the specified wait duration,
+// it will continue in the background and write cache as usual.
+// downloadOnDemand downloads the url or joins the download in flight for the same url.
+// It returns nil if the download is still in progress after the specified wait.
+func (e *engine) downloadOnDemand(url *neturl.URL, wait time.Duration) *crawler.Downloaded {
+	key := url.String()
+
+	e.onDemandMutex.Lock()
+	d, ok := e.onDemand[key]
+	if !ok {
+		d = &engineOnDemand{done: make(chan interface{})}
+		e.onDemand[key] = d
+
+		go func() {
+			d.downloaded = e.crawler.Download(crawler.QueueItem{
+				URL:           url,
+				ForceDownload: true,
+				Priority:      crawler.PriorityOnDemand,
+			})
+
+			e.onDemandMutex.Lock()
+			delete(e.onDemand, key)
+			e.onDemandMutex.Unlock()
+			close(d.done)
+		}()
+	} else {
+		e.logger.WithField("url", url).Debug("Joined download in flight")
+	}
+	e.onDemandMutex.Unlock()
+
+	if wait == 0 {
+		<-d.done
+		return d.downloaded
+	}
+
+	select {
+	case <-d.done:
+		return d.downloaded
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// buildRefreshQueueItem returns a forced queue item with validators from existing cache, if any
+func (e *engine) buildRefreshQueueItem(url *neturl.URL) crawler.QueueItem {
+	item := crawler.QueueItem{
+		URL:           url,
+		ForceDownload: true,
+	}
+
+	info, err := e.cacher.GetInfo(url)
+	if err != nil || info.StatusCode < 200 || info.StatusCode > 299 {
+		return item
+	}
+
+	item.ETag = info.Header.Get(cacher.HeaderETag)
+	// Last-Modified may be the cache write time, only the origin value can be sent back
+	item.LastModified = info.Header.Get(cacher.CustomHeaderLastModified)
+
+	return item
+}
+
+func (e *engine) bumpNotModified(downloaded *crawler.Downloaded) {
+	url := downloaded.Input.URL
+	now := time.Now()
+	ttl := e.cacher.GetDefaultTTL()
+
+	input := BuildCacherInputFromCrawlerDownloaded(downloaded)
+	if expires := cacher.GetExpires(input.Header, ttl, now); expires != nil {
+		ttl = expires.Sub(now)
+	}
+
+	// the not modified response may include updated validators
+	revalidateError := e.cacher.Revalidate(url, input.Header, ttl)
+	if revalidateError != nil {
+		e.logger.WithFields(logrus.Fields{
+			"url":             url,
+			"revalidateError": revalidateError,
+		}).Error("Failed to revalidate not modified cache")
+	}
+
+	if info, infoError := e.cacher.GetInfo(url); infoError == nil && len(info.Header.Get(cacher.CustomHeaderStale)) > 0 {
+		// the cache has been revalidated after a failed refresh
+		staleError := e.cacher.SetStale(url, false)
+		if staleError != nil {
+			e.logger.WithFields(logrus.Fields{
+				"url":        url,
+				"staleError": staleError,
+			}).Error("Failed to unmark stale cache")
+		}
+	}
+}
+
+func (e *engine) notifyDownloadedSomething() {
+	e.mutex.Lock()
+	if !e.stopped.IsSet() {
+		select {
+		case e.downloadedSomething <- true:
+		default:
+		}
+	}
+	e.mutex.Unlock()
+}
+
+func (e *engine) checkCacheModifiedBefore(url *neturl.URL, t time.Time) bool {
+	if !e.cacher.CheckCacheExists(url) {
+		// no need to force, it will be downloaded anyway
+		return false
+	}
+
+	info, err := e.cacher.GetInfo(url)
+	if err != nil {
+		return true
+	}
+
+	lastModified, err := http.ParseTime(info.Header.Get(cacher.HeaderLastModified))
+	if err != nil {
+		return true
+	}
+
+	return t.After(lastModified)
+}
+
+// rewriteURL applies the most specific matching host rewrite,
+// patterns with the same specificity are checked in the order they were added
 func (e *engine) rewriteURL(url *neturl.URL) {
 	e.mutex.Lock()
 	hostRewrites := e.hostRewrites
 	e.mutex.Unlock()
 
-	if hostRewrites == nil {
+	var best *engineHostRewrite
+	bestSpecificity := -1
+	for _, hostRewrite := range hostRewrites {
+		if !hostRewrite.pattern.match(url.Host) {
+			continue
+		}
+
+		specificity := hostRewrite.pattern.specificity(url.Host)
+		if specificity > bestSpecificity {
+			best = hostRewrite
+			bestSpecificity = specificity
+		}
+	}
+
+	if best == nil {
 		return
 	}
 
-	for from, f := range hostRewrites {
-		if url.Host == from {
-			urlBefore := url.String()
-			f(url)
+	urlBefore := url.String()
+	best.rewrite(url)
 
-			e.logger.WithFields(logrus.Fields{
-				"before": urlBefore,
-				"after":  url.String(),
-			}).Debug("Rewritten url")
+	e.logger.WithFields(logrus.Fields{
+		"before": urlBefore,
+		"after":  url.String(),
+	}).Debug("Rewritten url")
+}
 
-			return
+func (e *engine) checkURLAllowed(url *neturl.URL) bool {
+	e.mutex.Lock()
+	urlRules := e.urlRules
+	e.mutex.Unlock()
+
+	return checkURLRules(urlRules, url)
+}
+
+// checkKeepStale returns true if the downloaded data should not replace the existing cache.
+// Network errors and 5xx never replace any cache,
+// stale-if-error status codes never replace a 2xx cache.
+func (e *engine) checkKeepStale(downloaded *crawler.Downloaded) bool {
+	url := downloaded.Input.URL
+	statusCode := downloaded.StatusCode
+
+	if statusCode == 0 || statusCode >= 500 {
+		return e.cacher.CheckCacheExists(url)
+	}
+
+	e.mutex.Lock()
+	staleIfError := e.staleIfError
+	e.mutex.Unlock()
+
+	matched := false
+	for _, pattern := range staleIfError {
+		if pattern.match(statusCode) {
+			matched = true
+			break
 		}
 	}
+	if !matched || !e.cacher.CheckCacheExists(url) {
+		return false
+	}
+
+	info, err := e.cacher.GetInfo(url)
+	if err != nil {
+		return false
+	}
+
+	return info.StatusCode >= 200 && info.StatusCode <= 299
+}
+
+func (e *engine) checkHostBlacklisted(host string) bool {
+	e.mutex.Lock()
+	hostsBlacklist := e.hostsBlacklist
+	e.mutex.Unlock()
+
+	for _, hostBlacklist := range hostsBlacklist {
+		if hostBlacklist.match(host) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (e *engine) checkHostWhitelisted(host string) bool {
@@ -404,7 +1074,7 @@ func (e *engine) checkHostWhitelisted(host string) bool {
 	}
 
 	for _, hostWhitelist := range hostsWhitelist {
-		if host == hostWhitelist {
+		if hostWhitelist.match(host) {
 			return true
 		}
 	}
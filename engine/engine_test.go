@@ -8,12 +8,14 @@ import (
 	"net/http/httptest"
 	neturl "net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/daohoangson/go-sitemirror/cacher"
 	"github.com/daohoangson/go-sitemirror/crawler"
 	. "github.com/daohoangson/go-sitemirror/engine"
 	t "github.com/daohoangson/go-sitemirror/testing"
+	"github.com/daohoangson/go-sitemirror/web"
 	"github.com/jarcoal/httpmock"
 
 	. "github.com/onsi/ginkgo"
@@ -155,6 +157,62 @@ var _ = Describe("Engine", func() {
 				written, _ := io.ReadAll(f)
 				Expect(string(written)).To(HavePrefix("HTTP 200\n"))
 			})
+
+			It("should stream body to cache", func() {
+				url := "https://domain.com/engine/mirror/download/downloaded/stream"
+				parsedURL, _ := neturl.Parse(url)
+				httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, "foo/bar"))
+
+				e := newEngine()
+				defer e.Stop()
+				downloaded := e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL})
+				Expect(downloaded.BodyReader).ToNot(BeNil())
+
+				f, _ := e.GetCacher().Open(parsedURL)
+				written, _ := io.ReadAll(f)
+				_ = f.Close()
+				Expect(string(written)).To(HavePrefix("HTTP 200\n"))
+				Expect(string(written)).To(HaveSuffix("\n\nfoo/bar"))
+			})
+
+			It("should write error entry for body too large", func() {
+				url := "https://domain.com/engine/mirror/download/downloaded/too/large"
+				parsedURL, _ := neturl.Parse(url)
+				httpmock.RegisterResponder("GET", url, t.NewHTMLResponder(t.NewHTMLMarkup("foo/bar")))
+
+				e := newEngine()
+				defer e.Stop()
+				e.GetCrawler().SetMaxBodySize(uint64Two)
+				e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL})
+
+				f, _ := e.GetCacher().Open(parsedURL)
+				written, _ := io.ReadAll(f)
+				_ = f.Close()
+				Expect(string(written)).To(HavePrefix(fmt.Sprintf("HTTP %d\n", http.StatusBadGateway)))
+			})
+
+			It("should write error entry for streamed body too large", func() {
+				url := "https://domain.com/engine/mirror/download/downloaded/stream/too/large"
+				parsedURL, _ := neturl.Parse(url)
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					resp := httpmock.NewStringResponse(http.StatusOK, "foo/bar")
+					// chunked
+					resp.ContentLength = -1
+					return resp, nil
+				})
+
+				e := newEngine()
+				defer e.Stop()
+				e.GetCrawler().SetMaxBodySize(uint64Two)
+				downloaded := e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL})
+				Expect(downloaded.BodyReader).ToNot(BeNil())
+
+				f, _ := e.GetCacher().Open(parsedURL)
+				written, _ := io.ReadAll(f)
+				_ = f.Close()
+				Expect(string(written)).To(HavePrefix(fmt.Sprintf("HTTP %d\n", http.StatusBadGateway)))
+				Expect(e.GetStats().CacheErrors).To(BeZero())
+			})
 		})
 
 		Context("Crawler cache exists", func() {
@@ -199,6 +257,27 @@ var _ = Describe("Engine", func() {
 				Expect(string(respBody)).To(Equal(ResponseBodyMethodNotAllowed))
 			})
 
+			It("should response not found for excluded url", func() {
+				urlRoot := "https://domain.com"
+				urlPath := "/logout"
+				httpmock.RegisterResponder("GET", urlRoot+"/", httpmock.NewStringResponder(200, ""))
+				httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(200, ""))
+
+				e := newEngine()
+				Expect(e.AddURLRule(false, urlPath)).To(Succeed())
+				_ = mirrorURL(e, urlRoot+"/", 0)
+				defer e.Stop()
+
+				port, _ := e.GetServer().GetListeningPort("domain.com")
+				resp, _ := httpClient.Get(fmt.Sprintf("http://localhost:%d"+urlPath, port))
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+				respBody, _ := io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				Expect(string(respBody)).To(Equal(ResponseBodyURLExcluded))
+				Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64One))
+			})
+
 			It("should download for cache not found", func() {
 				urlRoot := "https://domain.com"
 				urlPath := "/engine/mirror/cache/not/found/should/download"
@@ -219,6 +298,25 @@ var _ = Describe("Engine", func() {
 				Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
 			})
 
+			It("should serve streamed body for cache not found", func() {
+				urlRoot := "https://domain.com"
+				urlPath := "/engine/mirror/cache/not/found/should/stream"
+				httpmock.RegisterResponder("GET", urlRoot+"/", httpmock.NewStringResponder(200, ""))
+				httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(200, "foo/bar"))
+
+				e := newEngine()
+				_ = mirrorURL(e, urlRoot+"/", 0)
+				defer e.Stop()
+
+				port, _ := e.GetServer().GetListeningPort("domain.com")
+
+				resp, _ := httpClient.Get(fmt.Sprintf("http://localhost:%d"+urlPath, port))
+				Expect(resp.StatusCode).To(Equal(200))
+				respBody, _ := io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				Expect(string(respBody)).To(Equal("foo/bar"))
+			})
+
 			It("should download for cache error", func() {
 				urlRoot := "https://domain.com"
 				urlPath := "/engine/mirror/cache/error/should/download"
@@ -277,6 +375,106 @@ var _ = Describe("Engine", func() {
 				Expect(e.GetCrawler().GetDownloadedCount()).To(BeNumerically(">=", 3))
 			})
 		})
+
+		Context("Revalidate", func() {
+			It("should bump expired cache on not modified", func() {
+				host := "revalidate.domain.com"
+				urlRoot := "https://" + host + "/"
+				urlPath := "/engine/mirror/cache/expired/revalidate"
+				url := "https://" + host + urlPath
+				parsedURL, _ := neturl.Parse(url)
+				etag := `"v1"`
+				notModifiedCount := int64(0)
+				httpmock.RegisterResponder("GET", urlRoot, httpmock.NewStringResponder(http.StatusOK, ""))
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					if req.Header.Get("If-None-Match") == etag {
+						atomic.AddInt64(&notModifiedCount, 1)
+						resp := httpmock.NewStringResponse(http.StatusNotModified, "")
+						resp.Header.Set(cacher.HeaderCacheControl, "max-age=3600")
+						return resp, nil
+					}
+
+					return httpmock.NewStringResponse(http.StatusOK, "bar"), nil
+				})
+
+				e := newEngine()
+				header := make(http.Header)
+				header.Set(cacher.HeaderETag, etag)
+				_ = e.GetCacher().Write(&cacher.Input{
+					URL:        parsedURL,
+					StatusCode: http.StatusOK,
+					Header:     header,
+					Body:       "foo",
+					TTL:        time.Millisecond,
+				})
+				_ = mirrorURL(e, urlRoot, 0)
+				defer e.Stop()
+
+				time.Sleep(sleepTime)
+				port, _ := e.GetServer().GetListeningPort(host)
+				resp, _ := httpClient.Get(fmt.Sprintf("http://localhost:%d"+urlPath, port))
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				time.Sleep(sleepTime)
+				Expect(atomic.LoadInt64(&notModifiedCount)).To(Equal(int64(1)))
+
+				info, _ := e.GetCacher().GetInfo(parsedURL)
+				Expect(info.Expires.After(time.Now().Add(59 * time.Minute))).To(BeTrue())
+
+				f, _ := e.GetCacher().Open(parsedURL)
+				written, _ := io.ReadAll(f)
+				_ = f.Close()
+				Expect(string(written)).To(HaveSuffix("\n\nfoo"))
+			})
+
+			It("should only send origin validators and merge new ones", func() {
+				host := "revalidate.domain.com"
+				urlRoot := "https://" + host + "/"
+				urlPath := "/engine/mirror/cache/expired/revalidate/merge"
+				url := "https://" + host + urlPath
+				parsedURL, _ := neturl.Parse(url)
+				lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+				var ifModifiedSince atomic.Value
+				httpmock.RegisterResponder("GET", urlRoot, httpmock.NewStringResponder(http.StatusOK, ""))
+				httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+					ifModifiedSince.Store(req.Header.Get(cacher.HeaderIfModifiedSince))
+					if req.Header.Get(cacher.HeaderIfNoneMatch) == `"v1"` {
+						resp := httpmock.NewStringResponse(http.StatusNotModified, "")
+						resp.Header.Set(cacher.HeaderETag, `"v2"`)
+						resp.Header.Set(cacher.HeaderLastModified, lastModified)
+						return resp, nil
+					}
+
+					return httpmock.NewStringResponse(http.StatusOK, "bar"), nil
+				})
+
+				e := newEngine()
+				header := make(http.Header)
+				header.Set(cacher.HeaderETag, `"v1"`)
+				_ = e.GetCacher().Write(&cacher.Input{
+					URL:        parsedURL,
+					StatusCode: http.StatusOK,
+					Header:     header,
+					Body:       "foo",
+					TTL:        time.Millisecond,
+				})
+				_ = mirrorURL(e, urlRoot, 0)
+				defer e.Stop()
+
+				time.Sleep(sleepTime)
+				port, _ := e.GetServer().GetListeningPort(host)
+				resp, _ := httpClient.Get(fmt.Sprintf("http://localhost:%d"+urlPath, port))
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				time.Sleep(sleepTime)
+				Expect(ifModifiedSince.Load()).To(Equal(""))
+
+				info, _ := e.GetCacher().GetInfo(parsedURL)
+				Expect(info.Header.Get(cacher.HeaderETag)).To(Equal(`"v2"`))
+				Expect(info.Header.Get(cacher.HeaderLastModified)).To(Equal(lastModified))
+				Expect(info.Header.Get(cacher.CustomHeaderLastModified)).To(Equal(lastModified))
+			})
+		})
 	})
 
 	Describe("hostRewrites", func() {
@@ -311,6 +509,70 @@ var _ = Describe("Engine", func() {
 			Expect(url1OtherDomainDownloaded).To(BeFalse())
 		})
 
+		It("should rewrite wildcard subdomain", func() {
+			url0 := "https://domain.com/engine/download/rewrite/wildcard/0"
+			url1Path := "/engine/download/rewrite/wildcard/1"
+			url1 := "https://domain.com" + url1Path
+			url1OtherDomain := "https://a.b.domain.com" + url1Path
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>", url1OtherDomain))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			url1Downloaded := false
+			httpmock.RegisterResponder("GET", url1, func(req *http.Request) (*http.Response, error) {
+				url1Downloaded = true
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+			e := newEngine()
+			Expect(e.AddHostRewrite("*.domain.com", "domain.com")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
+			Expect(url1Downloaded).To(BeTrue())
+		})
+
+		It("should rewrite with the most specific pattern", func() {
+			url0 := "https://domain.com/engine/download/rewrite/specific/0"
+			url1Path := "/engine/download/rewrite/specific/1"
+			url1 := "https://domain.com" + url1Path
+			url1OtherDomain := "https://cdn1.other.domain.com" + url1Path
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>", url1OtherDomain))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			url1Downloaded := false
+			httpmock.RegisterResponder("GET", url1, func(req *http.Request) (*http.Response, error) {
+				url1Downloaded = true
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+			e := newEngine()
+			Expect(e.AddHostRewrite("re:cdn[0-9]\\..+", "regex.domain.com")).To(Succeed())
+			Expect(e.AddHostRewrite(".domain.com", "suffix.domain.com")).To(Succeed())
+			Expect(e.AddHostRewrite("*.other.domain.com", "domain.com")).To(Succeed())
+			Expect(e.AddHostRewrite("other.domain.com", "exact.domain.com")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
+			Expect(url1Downloaded).To(BeTrue())
+		})
+
+		It("should replace rewrite of the same source", func() {
+			e := newEngine()
+			Expect(e.AddHostRewrite("*.domain.com", "domain1.com")).To(Succeed())
+			Expect(e.AddHostRewrite("*.domain.com", "domain2.com")).To(Succeed())
+
+			Expect(e.GetHostRewrites()).To(Equal(map[string]string{"*.domain.com": "domain2.com"}))
+		})
+
+		It("should return error for invalid regex", func() {
+			e := newEngine()
+
+			Expect(e.AddHostRewrite("re:(", "domain.com")).ToNot(Succeed())
+			Expect(e.GetHostRewrites()).To(BeEmpty())
+		})
+
 		It("should rewrite scheme", func() {
 			url0 := "https://domain.com/engine/download/rewrite/scheme/0"
 			url1Path := "/engine/download/rewrite/scheme/1"
@@ -375,6 +637,44 @@ var _ = Describe("Engine", func() {
 		})
 	})
 
+	Describe("hostsBlacklist", func() {
+		It("should not download nor rewrite blacklisted host", func() {
+			url0 := "https://domain.com/engine/download/blacklisted/0"
+			parsedURL0, _ := neturl.Parse(url0)
+			url1 := "https://ads.domain1.com/engine/download/blacklisted/1.js"
+			url2 := "https://domain2.com/engine/download/blacklisted/2.js"
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<script src=\"%s\"></script>"+
+				"<script src=\"%s\"></script>", url1, url2))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(200, ""))
+
+			e := newEngine()
+			Expect(e.AddHostBlacklisted(".domain1.com")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetLinkFoundCount()).To(Equal(uint64One))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
+
+			f, err := e.GetCacher().Open(parsedURL0)
+			Expect(err).ToNot(HaveOccurred())
+			cached, _ := io.ReadAll(f)
+			_ = f.Close()
+			Expect(string(cached)).To(ContainSubstring(url1))
+			Expect(string(cached)).ToNot(ContainSubstring(url2))
+		})
+
+		It("should not add host twice", func() {
+			e := newEngine()
+			Expect(e.AddHostBlacklisted("ads.domain.com")).To(Succeed())
+			Expect(e.AddHostBlacklisted("ads.domain.com")).To(Succeed())
+
+			Expect(e.GetHostsBlacklist()).To(Equal([]string{"ads.domain.com"}))
+		})
+	})
+
 	Describe("hostsWhitelist", func() {
 		It("should download from whitelisted host", func() {
 			url0 := "https://domain.com/engine/download/whitelisted/0"
@@ -414,6 +714,63 @@ var _ = Describe("Engine", func() {
 			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Three))
 		})
 
+		It("should download from wildcard and regex whitelisted hosts", func() {
+			url0 := "https://domain.com/engine/download/whitelisted/0"
+			url1 := "https://a.domain1.com/engine/download/whitelisted/1"
+			url2 := "https://cdn1.domain2.com/engine/download/whitelisted/2"
+			url3 := "https://domain1.com/engine/download/whitelisted/3"
+			url4 := "https://cdnx.domain2.com/engine/download/whitelisted/4"
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>", url1, url2, url3, url4))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url3, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url4, httpmock.NewStringResponder(200, ""))
+
+			e := newEngine()
+			Expect(e.AddHostWhitelisted("*.domain1.com")).To(Succeed())
+			Expect(e.AddHostWhitelisted("re:cdn[0-9]\\.domain2\\.com")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetLinkFoundCount()).To(Equal(uint64(4)))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Three))
+		})
+
+		It("should download from suffix whitelisted hosts", func() {
+			url0 := "https://domain.com/engine/download/whitelisted/0"
+			url1 := "https://a.domain1.com/engine/download/whitelisted/1"
+			url2 := "https://domain1.com/engine/download/whitelisted/2"
+			url3 := "https://notdomain1.com/engine/download/whitelisted/3"
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>", url1, url2, url3))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url3, httpmock.NewStringResponder(200, ""))
+
+			e := newEngine()
+			Expect(e.AddHostWhitelisted(".domain1.com")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetLinkFoundCount()).To(Equal(uint64Three))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Three))
+		})
+
+		It("should return error for invalid whitelist regex", func() {
+			e := newEngine()
+
+			Expect(e.AddHostWhitelisted("re:(")).ToNot(Succeed())
+			Expect(e.GetHostsWhitelist()).To(BeEmpty())
+		})
+
 		It("should not download from non-whitelisted host", func() {
 			url0 := "https://domain.com/engine/download/whitelisted/0"
 			url1 := "https://domain1.com/engine/download/whitelisted/1"
@@ -433,6 +790,227 @@ var _ = Describe("Engine", func() {
 		})
 	})
 
+	Describe("urlRules", func() {
+		It("should not download excluded links", func() {
+			url0 := "https://domain.com/engine/download/rules/0"
+			url1 := "https://domain.com/docs/1"
+			url2 := "https://domain.com/search?q=2"
+			url3 := "https://domain.com/logout"
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>", url1, url2, url3))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url3, httpmock.NewStringResponder(200, ""))
+
+			e := newEngine()
+			Expect(e.AddURLRule(false, "/search?*")).To(Succeed())
+			Expect(e.AddURLRule(false, "re:^https://domain\\.com/logout")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetLinkFoundCount()).To(Equal(uint64Three))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
+		})
+
+		It("should download included links only", func() {
+			url0 := "https://domain.com/engine/download/rules/0"
+			url1 := "https://domain.com/docs/a/1"
+			url2 := "https://domain.com/docs/private/2"
+			url3 := "https://domain.com/blog/3"
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>", url1, url2, url3))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url3, httpmock.NewStringResponder(200, ""))
+
+			e := newEngine()
+			Expect(e.AddURLRule(false, "/docs/private/*")).To(Succeed())
+			Expect(e.AddURLRule(true, "https://domain.com/docs/**")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetLinkFoundCount()).To(Equal(uint64Three))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
+		})
+
+		It("should not match slash with single star", func() {
+			url0 := "https://domain.com/engine/download/rules/0"
+			url1 := "https://domain.com/docs/1"
+			url2 := "https://domain.com/docs/a/2"
+			html0 := t.NewHTMLMarkup(fmt.Sprintf("<a href=\"%s\">Link</a>"+
+				"<a href=\"%s\">Link</a>", url1, url2))
+			httpmock.RegisterResponder("GET", url0, t.NewHTMLResponder(html0))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(200, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(200, ""))
+
+			e := newEngine()
+			Expect(e.AddURLRule(true, "/docs/*")).To(Succeed())
+			_ = mirrorURL(e, url0, -1)
+			defer e.Stop()
+
+			time.Sleep(sleepTime)
+			Expect(e.GetCrawler().GetLinkFoundCount()).To(Equal(uint64Two))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
+		})
+
+		It("should return error for invalid regex", func() {
+			e := newEngine()
+
+			Expect(e.AddURLRule(true, "re:(")).ToNot(Succeed())
+			Expect(e.GetURLRules()).To(BeEmpty())
+		})
+
+		It("should keep rules in order", func() {
+			e := newEngine()
+			Expect(e.AddURLRule(false, "/logout")).To(Succeed())
+			Expect(e.AddURLRule(true, "/**")).To(Succeed())
+
+			rules := e.GetURLRules()
+			Expect(len(rules)).To(Equal(2))
+			Expect(rules[0].Include).To(BeFalse())
+			Expect(rules[0].Pattern).To(Equal("/logout"))
+			Expect(rules[1].Include).To(BeTrue())
+			Expect(rules[1].Pattern).To(Equal("/**"))
+		})
+	})
+
+	Describe("staleIfError", func() {
+		const urlRoot = "https://domain.com"
+		const urlPath = "/engine/staleIfError"
+
+		var writeCache = func(e Engine, statusCode int, body string) *neturl.URL {
+			parsedURL, _ := neturl.Parse(urlRoot + urlPath)
+			header := make(http.Header)
+			header.Set(cacher.HeaderETag, `"v1"`)
+			_ = e.GetCacher().Write(&cacher.Input{
+				URL:        parsedURL,
+				StatusCode: statusCode,
+				Header:     header,
+				Body:       body,
+			})
+
+			return parsedURL
+		}
+
+		var serve = func(e Engine) *httptest.ResponseRecorder {
+			parsedURLRoot, _ := neturl.Parse(urlRoot)
+			w := httptest.NewRecorder()
+			e.GetServer().Serve(parsedURLRoot, w, httptest.NewRequest("GET", urlPath, nil))
+
+			return w
+		}
+
+		It("should keep 2xx cache", func() {
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusNotFound, "bar"))
+
+			e := newEngine()
+			Expect(e.AddStaleIfError("4xx")).To(Succeed())
+			parsedURL := writeCache(e, http.StatusOK, "foo")
+			defer e.Stop()
+
+			e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL, ForceDownload: true})
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("foo"))
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(Equal(web.WarningRevalidationFailed))
+		})
+
+		It("should keep cache on server error", func() {
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusServiceUnavailable, "bar"))
+
+			e := newEngine()
+			e.GetCrawler().SetRetries(0)
+			parsedURL := writeCache(e, http.StatusOK, "foo")
+			defer e.Stop()
+
+			e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL, ForceDownload: true})
+
+			w := serve(e)
+			Expect(w.Body.String()).To(Equal("foo"))
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(Equal(web.WarningRevalidationFailed))
+		})
+
+		It("should replace cache without matching status", func() {
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusForbidden, "bar"))
+
+			e := newEngine()
+			Expect(e.AddStaleIfError("404")).To(Succeed())
+			parsedURL := writeCache(e, http.StatusOK, "foo")
+			defer e.Stop()
+
+			e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL, ForceDownload: true})
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(BeEmpty())
+		})
+
+		It("should replace non-2xx cache", func() {
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusForbidden, "bar"))
+
+			e := newEngine()
+			Expect(e.AddStaleIfError("4xx")).To(Succeed())
+			parsedURL := writeCache(e, http.StatusNotFound, "foo")
+			defer e.Stop()
+
+			e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL, ForceDownload: true})
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("should unmark stale cache after revalidation", func() {
+			var failing int64 = 1
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, func(req *http.Request) (*http.Response, error) {
+				if atomic.LoadInt64(&failing) == 1 {
+					return httpmock.NewStringResponse(http.StatusNotFound, "bar"), nil
+				}
+
+				return httpmock.NewStringResponse(http.StatusNotModified, ""), nil
+			})
+
+			e := newEngine()
+			Expect(e.AddStaleIfError("404")).To(Succeed())
+			parsedURL := writeCache(e, http.StatusOK, "foo")
+			defer e.Stop()
+
+			e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL, ForceDownload: true})
+			Expect(serve(e).Header().Get(cacher.HeaderWarning)).To(Equal(web.WarningRevalidationFailed))
+
+			atomic.StoreInt64(&failing, 0)
+			e.GetCrawler().Download(crawler.QueueItem{URL: parsedURL, ForceDownload: true, ETag: `"v1"`})
+
+			w := serve(e)
+			Expect(w.Body.String()).To(Equal("foo"))
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(BeEmpty())
+		})
+
+		It("should return error for unsupported status", func() {
+			e := newEngine()
+
+			for _, status := range []string{"2xx", "6xx", "200", "600", "abc", "4x"} {
+				Expect(e.AddStaleIfError(status)).ToNot(Succeed(), status)
+			}
+			Expect(e.GetStaleIfError()).To(BeEmpty())
+		})
+
+		It("should add status once", func() {
+			e := newEngine()
+			Expect(e.AddStaleIfError("4xx")).To(Succeed())
+			Expect(e.AddStaleIfError("503")).To(Succeed())
+			Expect(e.AddStaleIfError("4xx")).To(Succeed())
+
+			Expect(e.GetStaleIfError()).To(Equal([]string{"4xx", "503"}))
+		})
+	})
+
 	Describe("SetBumpTTL", func() {
 
 		testSetBumpTTLDuration := time.Millisecond
@@ -483,6 +1061,148 @@ var _ = Describe("Engine", func() {
 		})
 	})
 
+	Describe("SetMissWait", func() {
+		const urlRoot = "https://domain.com"
+
+		var serve = func(e Engine, urlPath string) *httptest.ResponseRecorder {
+			parsedURLRoot, _ := neturl.Parse(urlRoot)
+			w := httptest.NewRecorder()
+			e.GetServer().Serve(parsedURLRoot, w, httptest.NewRequest("GET", urlPath, nil))
+
+			return w
+		}
+
+		It("should serve retry page", func() {
+			urlPath := "/engine/SetMissWait/retry"
+			parsedURL, _ := neturl.Parse(urlRoot + urlPath)
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, t.NewSlowResponder(20*sleepTime))
+
+			e := newEngine()
+			e.SetMissWait(sleepTime)
+			Expect(e.GetMissWait()).To(Equal(sleepTime))
+			defer e.Stop()
+
+			w := serve(e, urlPath)
+			Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(w.Header().Get(cacher.HeaderRetryAfter)).To(Equal("1"))
+			Expect(w.Body.String()).To(Equal(ResponseBodyMissRetry))
+
+			Eventually(func() bool { return e.GetCacher().CheckCacheExists(parsedURL) }).Should(BeTrue())
+		})
+
+		It("should not download again on retry", func() {
+			urlPath := "/engine/SetMissWait/retry/again"
+			var requests int64
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt64(&requests, 1)
+				time.Sleep(20 * sleepTime)
+				return httpmock.NewStringResponse(http.StatusOK, "foo"), nil
+			})
+
+			e := newEngine()
+			e.SetMissWait(sleepTime)
+			defer e.Stop()
+
+			Expect(serve(e, urlPath).Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(serve(e, urlPath).Code).To(Equal(http.StatusServiceUnavailable))
+
+			e.SetMissWait(time.Second)
+			w := serve(e, urlPath)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("foo"))
+			Expect(atomic.LoadInt64(&requests)).To(Equal(int64(1)))
+		})
+
+		It("should serve downloaded within wait", func() {
+			urlPath := "/engine/SetMissWait/downloaded"
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusOK, "foo"))
+
+			e := newEngine()
+			e.SetMissWait(time.Second)
+			defer e.Stop()
+
+			w := serve(e, urlPath)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("foo"))
+		})
+	})
+
+	Describe("SetMaxStale", func() {
+		const urlRoot = "https://domain.com"
+		const urlPath = "/engine/SetMaxStale"
+
+		var newStaleEngine = func() Engine {
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusOK, "bar"))
+			parsedURL, _ := neturl.Parse(urlRoot + urlPath)
+
+			e := newEngine()
+			e.GetServer().SetMaxStale(time.Millisecond)
+			_ = e.GetCacher().Write(&cacher.Input{
+				URL:        parsedURL,
+				StatusCode: http.StatusOK,
+				Body:       "foo",
+				TTL:        time.Millisecond,
+			})
+			time.Sleep(sleepTime)
+
+			return e
+		}
+
+		var serve = func(e Engine) *httptest.ResponseRecorder {
+			parsedURLRoot, _ := neturl.Parse(urlRoot)
+			w := httptest.NewRecorder()
+			e.GetServer().Serve(parsedURLRoot, w, httptest.NewRequest("GET", urlPath, nil))
+
+			return w
+		}
+
+		It("should block on refresh", func() {
+			e := newStaleEngine()
+			defer e.Stop()
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("bar"))
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(BeEmpty())
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64One))
+		})
+
+		It("should serve last-good cache after failed refresh", func() {
+			e := newStaleEngine()
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusNotFound, ""))
+			Expect(e.AddStaleIfError("404")).To(Succeed())
+			defer e.Stop()
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("foo"))
+			Expect(w.Header()[cacher.HeaderWarning]).To(ContainElement(web.WarningRevalidationFailed))
+		})
+
+		It("should block on refresh under steady traffic", func() {
+			e := newStaleEngine()
+			e.GetServer().SetMaxStale(20 * time.Millisecond)
+			e.SetBumpTTL(time.Hour)
+			// queued refreshes never run, only on demand downloads do
+			e.GetCrawler().Pause()
+			defer e.Stop()
+
+			Expect(serve(e).Body.String()).To(Equal("foo"))
+			Eventually(func() string { return serve(e).Body.String() }).Should(Equal("bar"))
+		})
+
+		It("should serve stale cache offline", func() {
+			e := newStaleEngine()
+			e.SetOffline(true)
+			defer e.Stop()
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("foo"))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(BeZero())
+		})
+	})
+
 	Describe("SetAutoEnqueueInterval", func() {
 		intervalBase := time.Millisecond
 		interval := 4 * intervalBase
@@ -527,6 +1247,155 @@ var _ = Describe("Engine", func() {
 		})
 	})
 
+	Describe("SetSeedSitemaps", func() {
+		It("should not seed by default", func() {
+			e := newEngine()
+
+			Expect(e.GetSeedSitemaps()).To(BeFalse())
+		})
+
+		It("should enqueue sitemap urls", func() {
+			urlRoot := "https://sitemap.domain.com/"
+			url1 := "https://sitemap.domain.com/engine/SetSeedSitemaps/1"
+			url2 := "https://sitemap.domain.com/engine/SetSeedSitemaps/2"
+			urlNotWhitelisted := "https://other.domain.com/engine/SetSeedSitemaps"
+			sitemapIndex := "https://sitemap.domain.com/sitemap_index.xml"
+			sitemap := "https://sitemap.domain.com/sitemap-1.xml"
+			httpmock.RegisterResponder("GET", urlRoot, httpmock.NewStringResponder(http.StatusOK, ""))
+			httpmock.RegisterResponder("GET", "https://sitemap.domain.com/robots.txt",
+				httpmock.NewStringResponder(http.StatusOK, "Sitemap: "+sitemapIndex+"\n"))
+			httpmock.RegisterResponder("GET", sitemapIndex, httpmock.NewStringResponder(http.StatusOK,
+				fmt.Sprintf("<sitemapindex><sitemap><loc>%s</loc></sitemap>"+
+					"<sitemap><loc>%s</loc></sitemap></sitemapindex>", sitemap, sitemapIndex)))
+			httpmock.RegisterResponder("GET", sitemap, httpmock.NewStringResponder(http.StatusOK,
+				fmt.Sprintf("<urlset><url><loc>%s</loc></url><url><loc>%s</loc></url>"+
+					"<url><loc>%s</loc></url></urlset>", url1, url2, urlNotWhitelisted)))
+			httpmock.RegisterResponder("GET", url1, httpmock.NewStringResponder(http.StatusOK, ""))
+			httpmock.RegisterResponder("GET", url2, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			e := newEngine()
+			e.AddHostWhitelisted("sitemap.domain.com")
+			e.SetSeedSitemaps(true)
+			_ = mirrorURL(e, urlRoot, -1)
+			e.Stop()
+
+			Expect(e.GetCrawler().GetEnqueuedCount()).To(Equal(uint64Three))
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Three))
+		})
+
+		It("should force download for newer lastmod", func() {
+			urlRoot := "https://sitemap.lastmod.com/"
+			urlNewer := "https://sitemap.lastmod.com/engine/SetSeedSitemaps/newer"
+			urlOlder := "https://sitemap.lastmod.com/engine/SetSeedSitemaps/older"
+			parsedURLNewer, _ := neturl.Parse(urlNewer)
+			parsedURLOlder, _ := neturl.Parse(urlOlder)
+			httpmock.RegisterResponder("GET", urlRoot, httpmock.NewStringResponder(http.StatusOK, ""))
+			httpmock.RegisterResponder("GET", "https://sitemap.lastmod.com/robots.txt",
+				httpmock.NewStringResponder(http.StatusNotFound, ""))
+			httpmock.RegisterResponder("GET", "https://sitemap.lastmod.com/sitemap.xml", httpmock.NewStringResponder(http.StatusOK,
+				fmt.Sprintf("<urlset><url><loc>%s</loc><lastmod>%s</lastmod></url>"+
+					"<url><loc>%s</loc><lastmod>2000-01-01</lastmod></url></urlset>",
+					urlNewer, time.Now().Add(time.Hour).Format(time.RFC3339), urlOlder)))
+			httpmock.RegisterResponder("GET", urlNewer, httpmock.NewStringResponder(http.StatusOK, ""))
+			httpmock.RegisterResponder("GET", urlOlder, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			e := newEngine()
+			_ = e.GetCacher().Write(&cacher.Input{URL: parsedURLNewer, StatusCode: http.StatusOK})
+			_ = e.GetCacher().Write(&cacher.Input{URL: parsedURLOlder, StatusCode: http.StatusOK})
+			e.SetSeedSitemaps(true)
+			_ = mirrorURL(e, urlRoot, -1)
+			e.Stop()
+
+			// root + newer
+			Expect(e.GetCrawler().GetDownloadedCount()).To(Equal(uint64Two))
+		})
+	})
+
+	Describe("SetOffline", func() {
+		const urlRoot = "https://domain.com"
+		const urlPath = "/engine/SetOffline"
+
+		var serve = func(e Engine) *httptest.ResponseRecorder {
+			parsedURLRoot, _ := neturl.Parse(urlRoot)
+			w := httptest.NewRecorder()
+			e.GetServer().Serve(parsedURLRoot, w, httptest.NewRequest("GET", urlPath, nil))
+
+			return w
+		}
+
+		It("should be online by default", func() {
+			e := newEngine()
+			Expect(e.GetOffline()).To(BeFalse())
+
+			statusCode, body := e.GetOfflinePage()
+			Expect(statusCode).To(Equal(http.StatusNotFound))
+			Expect(string(body)).To(Equal(ResponseBodyOffline))
+		})
+
+		It("should not crawl", func() {
+			httpmock.RegisterResponder("GET", urlRoot+urlPath, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			e := newEngine()
+			e.SetOffline(true)
+			e.SetSeedSitemaps(true)
+			_ = mirrorURL(e, urlRoot+urlPath, -1)
+			e.Stop()
+
+			Expect(e.GetCrawler().GetEnqueuedCount()).To(BeZero())
+			Expect(e.GetCrawler().GetDownloadedCount()).To(BeZero())
+		})
+
+		It("should serve miss without placeholder", func() {
+			e := newEngine()
+			e.SetOffline(true)
+			Expect(e.SetOfflinePage(http.StatusGatewayTimeout, []byte("offline"))).To(Succeed())
+			defer e.Stop()
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusGatewayTimeout))
+			Expect(w.Body.String()).To(Equal("offline"))
+
+			parsedURL, _ := neturl.Parse(urlRoot + urlPath)
+			Expect(e.GetCacher().CheckCacheExists(parsedURL)).To(BeFalse())
+			Expect(e.GetCrawler().GetDownloadedCount()).To(BeZero())
+		})
+
+		It("should serve stale cache without bump", func() {
+			parsedURL, _ := neturl.Parse(urlRoot + urlPath)
+
+			e := newEngine()
+			e.SetOffline(true)
+			_ = e.GetCacher().Write(&cacher.Input{
+				URL:        parsedURL,
+				StatusCode: http.StatusOK,
+				Body:       "foo",
+				TTL:        time.Millisecond,
+			})
+			defer e.Stop()
+
+			info, _ := e.GetCacher().GetInfo(parsedURL)
+			expires := info.Expires
+			time.Sleep(sleepTime)
+
+			w := serve(e)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("foo"))
+
+			time.Sleep(sleepTime)
+			info, _ = e.GetCacher().GetInfo(parsedURL)
+			Expect(info.Expires).To(Equal(expires))
+			Expect(e.GetCrawler().GetEnqueuedCount()).To(BeZero())
+		})
+
+		It("should return error for unsupported status code", func() {
+			e := newEngine()
+
+			Expect(e.SetOfflinePage(http.StatusInternalServerError, nil)).ToNot(Succeed())
+			statusCode, _ := e.GetOfflinePage()
+			Expect(statusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+
 	Describe("WaitAndStop", func() {
 		It("should stop crawler", func() {
 			url0 := "https://domain.com/engine/WaitAndStop/0"
@@ -564,10 +1433,131 @@ var _ = Describe("Engine", func() {
 			e.Stop()
 		})
 
+		It("should stop while paused", func() {
+			url := "https://domain.com/engine/should/stop/while/paused"
+			parsedURL, _ := neturl.Parse(url)
+			httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, ""))
+
+			e := newEngine()
+			e.GetCrawler().Pause()
+			e.GetCrawler().Enqueue(crawler.QueueItem{URL: parsedURL})
+
+			stopped := make(chan bool)
+			go func() {
+				e.Stop()
+				close(stopped)
+			}()
+			Eventually(stopped).Should(BeClosed())
+			Expect(e.GetCrawler().GetDownloadedCount()).To(BeZero())
+		})
+
 		It("should run without panic if being called twice", func() {
 			e := newEngine()
 			e.Stop()
 			e.Stop()
 		})
 	})
+
+	Describe("OneShot", func() {
+		const urlPrefix = "https://domain.com/engine/OneShot/"
+
+		var newOneShotEngine = func() Engine {
+			httpmock.RegisterResponder("GET", urlPrefix+"ok", httpmock.NewStringResponder(http.StatusOK, "ok"))
+			httpmock.RegisterResponder("GET", urlPrefix+"not/found", httpmock.NewStringResponder(http.StatusNotFound, ""))
+			httpmock.RegisterResponder("GET", urlPrefix+"server/error", httpmock.NewStringResponder(http.StatusInternalServerError, ""))
+			httpmock.RegisterResponder("GET", urlPrefix+"network/error", httpmock.NewErrorResponder(fmt.Errorf("connection reset")))
+
+			e := newEngine()
+			e.GetCrawler().SetRetries(0)
+			for _, path := range []string{"ok", "not/found", "server/error", "network/error"} {
+				_ = mirrorURL(e, urlPrefix+path, -1)
+			}
+
+			return e
+		}
+
+		It("should wait and count errors", func() {
+			e := newOneShotEngine()
+			e.Wait()
+
+			stats := e.GetStats()
+			Expect(stats.Downloaded).To(Equal(uint64(4)))
+			Expect(stats.NetworkErrors).To(Equal(uint64One))
+			Expect(stats.ServerErrors).To(Equal(uint64One))
+			Expect(stats.ClientErrors).To(Equal(uint64One))
+			Expect(stats.CacheErrors).To(BeZero())
+			Expect(stats.GetErrors()).To(Equal(uint64Two))
+
+			e.Stop()
+		})
+
+		It("should return true without thresholds", func() {
+			e := newOneShotEngine()
+			config, _ := ParseConfig("", []string{"-one-shot"}, io.Discard)
+			output := &bytes.Buffer{}
+
+			Expect(OneShot(e, config, output)).To(BeTrue())
+			Eventually(e.GetCrawler().HasStopped).Should(BeTrue())
+			Expect(output.String()).To(ContainSubstring("Downloaded: 4\n"))
+		})
+
+		It("should return false with too many errors", func() {
+			e := newOneShotEngine()
+			config, _ := ParseConfig("", []string{"-one-shot", "-one-shot-max-errors", "1"}, io.Discard)
+			output := &bytes.Buffer{}
+
+			Expect(OneShot(e, config, output)).To(BeFalse())
+			Expect(output.String()).To(ContainSubstring("Too many errors: 2 > 1"))
+		})
+
+		It("should return false with too many client errors", func() {
+			e := newOneShotEngine()
+			config, _ := ParseConfig("", []string{"-one-shot", "-one-shot-max-errors", "2", "-one-shot-max-4xx", "0"}, io.Discard)
+			output := &bytes.Buffer{}
+
+			Expect(OneShot(e, config, output)).To(BeFalse())
+			Expect(output.String()).ToNot(ContainSubstring("Too many errors"))
+			Expect(output.String()).To(ContainSubstring("Too many client errors: 1 > 0"))
+		})
+
+		It("should wait for linked pages to be cached", func() {
+			rootURL := urlPrefix + "links"
+			links := make([]string, 3)
+			markup := ""
+			for i := range links {
+				links[i] = fmt.Sprintf("%slinks/%d", urlPrefix, i)
+				markup += fmt.Sprintf("<a href=\"%s\">%d</a>", links[i], i)
+				httpmock.RegisterResponder("GET", links[i], t.NewHTMLResponder(""))
+			}
+			httpmock.RegisterResponder("GET", rootURL, t.NewHTMLResponder(markup))
+
+			fs = &slowRenameFs{Fs: fs, delay: 30 * time.Millisecond}
+			e := newEngine()
+			_ = mirrorURL(e, rootURL, -1)
+			config, _ := ParseConfig("", []string{"-one-shot"}, io.Discard)
+
+			Expect(OneShot(e, config, io.Discard)).To(BeTrue())
+			for _, link := range links {
+				parsedURL, _ := neturl.Parse(link)
+				Expect(e.GetCacher().CheckCacheExists(parsedURL)).To(BeTrue(), link)
+			}
+		})
+
+		It("should not wait after Stop", func() {
+			e := newEngine()
+			e.Stop()
+			e.Wait()
+		})
+	})
 })
+
+type slowRenameFs struct {
+	cacher.Fs
+
+	delay time.Duration
+}
+
+func (fs *slowRenameFs) Rename(oldpath string, newpath string) error {
+	time.Sleep(fs.delay)
+	return fs.Fs.Rename(oldpath, newpath)
+}
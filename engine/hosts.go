@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// hostPattern matches hosts by one of these syntaxes:
+// `domain.com` matches the exact host,
+// `*.domain.com` matches all subdomains but not domain.com itself,
+// `.domain.com` matches domain.com and all its subdomains,
+// `re:cdn[0-9]\.domain\.net` matches the whole host against the regular expression.
+type hostPattern struct {
+	pattern string
+
+	exact  string
+	suffix string
+	regexp *regexp.Regexp
+}
+
+func newHostPattern(pattern string) (*hostPattern, error) {
+	p := &hostPattern{pattern: pattern}
+
+	switch {
+	case strings.HasPrefix(pattern, RegexpPatternPrefix):
+		expr := "^(?:" + pattern[len(RegexpPatternPrefix):] + ")$"
+		compiled, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("regexp.Compile: %w", err)
+		}
+		p.regexp = compiled
+	case strings.HasPrefix(pattern, "*."):
+		p.suffix = strings.ToLower(pattern[1:])
+	case strings.HasPrefix(pattern, "."):
+		p.exact = strings.ToLower(pattern[1:])
+		p.suffix = strings.ToLower(pattern)
+	default:
+		p.exact = strings.ToLower(pattern)
+	}
+
+	return p, nil
+}
+
+func (p *hostPattern) match(host string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(host)
+	}
+
+	host = strings.ToLower(host)
+	if len(p.exact) > 0 && host == p.exact {
+		return true
+	}
+
+	return len(p.suffix) > 0 && strings.HasSuffix(host, p.suffix)
+}
+
+// specificity returns a higher value for a more specific pattern of the matched host:
+// exact hosts come first, then suffixes by length, then regular expressions.
+func (p *hostPattern) specificity(host string) int {
+	if len(p.exact) > 0 && strings.ToLower(host) == p.exact {
+		return int(^uint(0) >> 1)
+	}
+
+	return len(p.suffix)
+}
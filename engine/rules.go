@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// URLRule represents an include or exclude rule for urls.
+// Pattern is a regular expression if it starts with RegexpPatternPrefix,
+// it is matched against the full url and is not anchored.
+// Otherwise, it is a glob with `*` matching anything except `/` and `**` matching anything,
+// other characters (including `?`) are literal. A glob starting with `/` is matched against
+// the path and query of the url, other globs are matched against the full url.
+type URLRule struct {
+	Include bool
+	Pattern string
+
+	pathOnly bool
+	regexp   *regexp.Regexp
+}
+
+func newURLRule(include bool, pattern string) (*URLRule, error) {
+	rule := &URLRule{
+		Include: include,
+		Pattern: pattern,
+	}
+
+	var expr string
+	if strings.HasPrefix(pattern, RegexpPatternPrefix) {
+		expr = pattern[len(RegexpPatternPrefix):]
+	} else {
+		rule.pathOnly = strings.HasPrefix(pattern, "/")
+		expr = globToRegexp(pattern)
+	}
+
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("regexp.Compile: %w", err)
+	}
+	rule.regexp = compiled
+
+	return rule, nil
+}
+
+func (r *URLRule) match(url *neturl.URL) bool {
+	if r.pathOnly {
+		target := url.EscapedPath()
+		if len(url.RawQuery) > 0 {
+			target += "?" + url.RawQuery
+		}
+
+		return r.regexp.MatchString(target)
+	}
+
+	return r.regexp.MatchString(url.String())
+}
+
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		if glob[i] != '*' {
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			continue
+		}
+
+		if i+1 < len(glob) && glob[i+1] == '*' {
+			sb.WriteString(".*")
+			i++
+		} else {
+			sb.WriteString("[^/]*")
+		}
+	}
+
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// checkURLRules returns true if the first matching rule is an include rule.
+// Url without any match is allowed unless there is at least one include rule.
+func checkURLRules(rules []*URLRule, url *neturl.URL) bool {
+	hasInclude := false
+
+	for _, rule := range rules {
+		if rule.match(url) {
+			return rule.Include
+		}
+
+		if rule.Include {
+			hasInclude = true
+		}
+	}
+
+	return !hasInclude
+}
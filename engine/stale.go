@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statusPattern matches status codes by one of these syntaxes:
+// `404` matches the exact status code,
+// `4xx` matches all status codes of the class.
+type statusPattern struct {
+	pattern string
+
+	code  int
+	class int
+}
+
+func newStatusPattern(pattern string) (*statusPattern, error) {
+	p := &statusPattern{pattern: pattern}
+
+	if len(pattern) == 3 && strings.HasSuffix(strings.ToLower(pattern), "xx") {
+		class, err := strconv.Atoi(pattern[:1])
+		if err != nil || class < 3 || class > 5 {
+			return nil, fmt.Errorf("unsupported status class %q", pattern)
+		}
+		p.class = class
+	} else {
+		code, err := strconv.Atoi(pattern)
+		if err != nil || code < 300 || code > 599 {
+			return nil, fmt.Errorf("unsupported status code %q", pattern)
+		}
+		p.code = code
+	}
+
+	return p, nil
+}
+
+func (p *statusPattern) match(statusCode int) bool {
+	if p.class > 0 {
+		return statusCode/100 == p.class
+	}
+
+	return statusCode == p.code
+}
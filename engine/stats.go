@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/daohoangson/go-sitemirror/crawler"
+)
+
+// Stats represents crawl counters of an engine
+type Stats struct {
+	Enqueued      uint64
+	Downloaded    uint64
+	LinkFound     uint64
+	BudgetSkipped uint64
+
+	// NetworkErrors counts downloads without any response after all retries
+	NetworkErrors uint64
+	// ServerErrors counts downloads with 5xx status code after all retries
+	ServerErrors uint64
+	// ClientErrors counts downloads with 4xx status code
+	ClientErrors uint64
+	// CacheErrors counts downloads that cannot be written to cache
+	CacheErrors uint64
+}
+
+type engineStats struct {
+	networkErrors uint64
+	serverErrors  uint64
+	clientErrors  uint64
+	cacheErrors   uint64
+}
+
+// GetErrors returns the total number of network, server and cache errors
+func (s Stats) GetErrors() uint64 {
+	return s.NetworkErrors + s.ServerErrors + s.CacheErrors
+}
+
+// WriteSummary writes human readable counters to w
+func (s Stats) WriteSummary(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "Enqueued: %d\n"+
+		"Downloaded: %d\n"+
+		"Links found: %d\n"+
+		"Budget skipped: %d\n"+
+		"Network errors: %d\n"+
+		"Server errors (5xx): %d\n"+
+		"Client errors (4xx): %d\n"+
+		"Cache errors: %d\n",
+		s.Enqueued,
+		s.Downloaded,
+		s.LinkFound,
+		s.BudgetSkipped,
+		s.NetworkErrors,
+		s.ServerErrors,
+		s.ClientErrors,
+		s.CacheErrors,
+	)
+
+	return err
+}
+
+// OneShot waits for the crawl to complete, stops the engine and writes a summary to output.
+// It returns false if any error threshold of the config has been exceeded.
+func OneShot(e Engine, config *Config, output io.Writer) bool {
+	e.Wait()
+	e.Stop()
+
+	stats := e.GetStats()
+	_ = stats.WriteSummary(output)
+
+	ok := true
+	if config.OneShot.MaxErrors > -1 && stats.GetErrors() > uint64(config.OneShot.MaxErrors) {
+		_, _ = fmt.Fprintf(output, "Too many errors: %d > %d\n", stats.GetErrors(), config.OneShot.MaxErrors)
+		ok = false
+	}
+	if config.OneShot.MaxClientErrors > -1 && stats.ClientErrors > uint64(config.OneShot.MaxClientErrors) {
+		_, _ = fmt.Fprintf(output, "Too many client errors: %d > %d\n", stats.ClientErrors, config.OneShot.MaxClientErrors)
+		ok = false
+	}
+
+	return ok
+}
+
+func (s *engineStats) recordDownloaded(downloaded *crawler.Downloaded) {
+	switch {
+	case downloaded.StatusCode == 0:
+		atomic.AddUint64(&s.networkErrors, 1)
+	case downloaded.StatusCode >= http.StatusInternalServerError:
+		atomic.AddUint64(&s.serverErrors, 1)
+	case downloaded.StatusCode >= http.StatusBadRequest:
+		atomic.AddUint64(&s.clientErrors, 1)
+	}
+}
+
+func (s *engineStats) recordCacheError() {
+	atomic.AddUint64(&s.cacheErrors, 1)
+}
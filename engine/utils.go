@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/daohoangson/go-sitemirror/cacher"
@@ -19,7 +20,14 @@ func BuildCacherInputFromCrawlerDownloaded(d *crawler.Downloaded) *cacher.Input
 		i.URL = d.Input.URL
 	}
 
+	if errors.Is(d.Error, crawler.ErrBodyTooLarge) {
+		// store an error entry instead of a partial body
+		i.StatusCode = http.StatusBadGateway
+		return i
+	}
+
 	i.Body = d.Body
+	i.BodyReader = d.BodyReader
 
 	i.Header = make(http.Header)
 	for _, headerKey := range d.GetHeaderKeys() {
@@ -4,25 +4,24 @@ go 1.20
 
 require (
 	github.com/Sirupsen/logrus v1.0.3
+	github.com/andybalholm/brotli v1.1.0
 	github.com/gorilla/css v1.0.0
-	github.com/hectane/go-nonblockingchan v0.1.0
 	github.com/jarcoal/httpmock v1.3.0
 	github.com/namsral/flag v1.7.4-pre
 	github.com/onsi/ginkgo v1.4.0
 	github.com/onsi/gomega v1.2.0
 	github.com/tevino/abool v1.0.0
 	golang.org/x/net v0.17.0
+	golang.org/x/text v0.14.0
 )
 
 require (
 	github.com/golang/protobuf v1.5.3 // indirect
-	github.com/hectane/go-attest v0.1.2 // indirect
 	github.com/sirupsen/logrus v1.9.2 // indirect
 	github.com/stretchr/testify v1.8.3 // indirect
 	golang.org/x/crypto v0.17.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/term v0.15.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
@@ -16,6 +16,13 @@ func main() {
 
 	e := engine.FromConfig(cacher.NewFs(), config)
 
+	if config.OneShot.Enabled {
+		if !engine.OneShot(e, config, os.Stdout) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	for sig := range c {
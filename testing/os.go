@@ -35,6 +35,9 @@ type fakeFile struct {
 	node  *fakeNode
 	bytes []byte
 	pos   int64
+
+	// dirty is set after changes so that closing a read only file does not overwrite other writes
+	dirty bool
 }
 
 // NewFs returns an in memory file system
@@ -203,8 +206,96 @@ func (fs *fakeFs) OpenFile(name string, flag int, perm os.FileMode) (cacher.File
 	return f, nil
 }
 
-func (fs *fakeFs) RemoveAll(_ string) error {
-	panic("Not implemented")
+func (fs *fakeFs) RemoveAll(name string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	parent, element, err := fs.findParent(name)
+	if err != nil {
+		// similar to os.RemoveAll, it is not an error if the path does not exist
+		return nil
+	}
+
+	parent.mutex.Lock()
+	delete(parent.nodes, element)
+	parent.mutex.Unlock()
+
+	fs.logger.WithField("name", name).Debug("RemoveAll: ok")
+
+	return nil
+}
+
+func (fs *fakeFs) Rename(oldpath string, newpath string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	oldParent, oldElement, oldError := fs.findParent(oldpath)
+	if oldError != nil {
+		return oldError
+	}
+	newParent, newElement, newError := fs.findParent(newpath)
+	if newError != nil {
+		return newError
+	}
+
+	oldParent.mutex.Lock()
+	node, ok := oldParent.nodes[oldElement]
+	oldParent.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("%s/%s does not exists", oldParent.path, oldElement)
+	}
+
+	newParent.mutex.Lock()
+	existing, exists := newParent.nodes[newElement]
+	newParent.mutex.Unlock()
+	if exists && existing.isDir() {
+		return fmt.Errorf("%s is dir", existing.path)
+	}
+
+	oldParent.mutex.Lock()
+	delete(oldParent.nodes, oldElement)
+	oldParent.mutex.Unlock()
+
+	node.mutex.Lock()
+	node.path = path.Join(newParent.path, newElement)
+	node.logger = newParent.logger.WithField("path", node.path)
+	node.mutex.Unlock()
+
+	newParent.mutex.Lock()
+	newParent.nodes[newElement] = node
+	newParent.mutex.Unlock()
+
+	fs.logger.WithFields(logrus.Fields{
+		"oldpath": oldpath,
+		"newpath": newpath,
+	}).Debug("Rename: ok")
+
+	return nil
+}
+
+// findParent returns the directory node containing the specified name, fs.mutex must be locked
+func (fs *fakeFs) findParent(name string) (*fakeNode, string, error) {
+	if !path.IsAbs(name) {
+		name = path.Join(fs.wd, name)
+	}
+
+	parts := strings.Split(path.Clean(name), "/")
+	node := fs.root
+	for i := 1; i < len(parts)-1; i++ {
+		node.mutex.Lock()
+		nextNode, ok := node.nodes[parts[i]]
+		node.mutex.Unlock()
+		if !ok {
+			return nil, "", fmt.Errorf("%s/%s does not exists", node.path, parts[i])
+		}
+		if nextNode.isFile() {
+			return nil, "", fmt.Errorf("%s is file", nextNode.path)
+		}
+
+		node = nextNode
+	}
+
+	return node, parts[len(parts)-1], nil
 }
 
 func (fn *fakeNode) isDir() bool {
@@ -302,6 +393,7 @@ func (ff *fakeFile) Write(p []byte) (int, error) {
 
 	written := len(p)
 	ff.pos = int64(len(before) + written)
+	ff.dirty = true
 
 	ff.node.logger.WithFields(logrus.Fields{
 		"written": written,
@@ -324,8 +416,10 @@ func (ff *fakeFile) Close() error {
 	ff.node.mutex.Lock()
 	defer ff.node.mutex.Unlock()
 
-	ff.node.bytes = make([]byte, len(ff.bytes))
-	copy(ff.node.bytes, ff.bytes)
+	if ff.dirty {
+		ff.node.bytes = make([]byte, len(ff.bytes))
+		copy(ff.node.bytes, ff.bytes)
+	}
 
 	ff.node.logger.WithField("len", len(ff.bytes)).Debug("File.Close: ok")
 
@@ -346,7 +440,7 @@ func (ff *fakeFile) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekCurrent:
 		ff.pos += offset
 	case io.SeekEnd:
-		ff.pos = int64(len(ff.bytes)-1) - offset
+		ff.pos = int64(len(ff.bytes)) + offset
 	}
 
 	return ff.pos, nil
@@ -367,6 +461,7 @@ func (ff *fakeFile) Truncate(size int64) error {
 
 	ff.bytes = make([]byte, 0)
 	ff.pos = 0
+	ff.dirty = true
 
 	return nil
 }
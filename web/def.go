@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/daohoangson/go-sitemirror/cacher"
@@ -15,6 +16,8 @@ type Server interface {
 	init(cacher.Cacher, *logrus.Logger)
 
 	GetCacher() cacher.Cacher
+	SetMaxStale(time.Duration)
+	GetMaxStale() time.Duration
 	SetOnServerIssue(func(*ServerIssue))
 
 	ListenAndServe(*url.URL, int) (io.Closer, error)
@@ -41,6 +44,15 @@ const (
 	CacheExpired
 	// CrossHostInvalidPath server issue type when an invalid path came in cross-host mode
 	CrossHostInvalidPath
+	// CacheTooStale server issue type when cache has expired for longer than the max stale duration
+	CacheTooStale
+)
+
+const (
+	// WarningResponseIsStale warning header value when expired cache is served
+	WarningResponseIsStale = `110 - "Response is Stale"`
+	// WarningRevalidationFailed warning header value when cache is served after a failed refresh
+	WarningRevalidationFailed = `111 - "Revalidation Failed"`
 )
 
 type serverIssueType int
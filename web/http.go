@@ -123,8 +123,15 @@ func serveHTTPAddHeader(line string, info internal.ServeInfo) bool {
 		if expires, err := strconv.ParseInt(headerValue, 10, 64); err == nil {
 			t := time.Unix(0, expires)
 			info.SetExpires(t)
+
+			if t.Before(time.Now()) {
+				info.AddHeader(cacher.HeaderWarning, WarningResponseIsStale)
+			}
 		}
 
+		return false
+	case cacher.CustomHeaderStale:
+		info.AddHeader(cacher.HeaderWarning, WarningRevalidationFailed)
 		return false
 	default:
 		if strings.HasPrefix(headerKey, cacher.CustomHeaderPrefix) {
@@ -237,6 +237,35 @@ var _ = Describe("HTTP", func() {
 			Expect(siExpires.UnixNano()).To(Equal(expires.UnixNano()))
 		})
 
+		It("should add warning header for expired cache", func() {
+			expires := time.Now().Add(-time.Minute)
+			r := newBufioReader(fmt.Sprintf("%s: %d\n\n", cacher.CustomHeaderExpires, expires.UnixNano()))
+			si, w := newServeInfo()
+			ServeHTTPAddHeaders(r, si)
+			si.Flush()
+
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(Equal(WarningResponseIsStale))
+		})
+
+		It("should not add warning header for fresh cache", func() {
+			expires := time.Now().Add(time.Minute)
+			r := newBufioReader(fmt.Sprintf("%s: %d\n\n", cacher.CustomHeaderExpires, expires.UnixNano()))
+			si, w := newServeInfo()
+			ServeHTTPAddHeaders(r, si)
+			si.Flush()
+
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(BeEmpty())
+		})
+
+		It("should add warning header for stale cache", func() {
+			r := newBufioReader(fmt.Sprintf("%s: %d\n\n", cacher.CustomHeaderStale, time.Now().UnixNano()))
+			si, w := newServeInfo()
+			ServeHTTPAddHeaders(r, si)
+			si.Flush()
+
+			Expect(w.Header().Get(cacher.HeaderWarning)).To(Equal(WarningRevalidationFailed))
+		})
+
 		It("should not add internal headers", func() {
 			r := newBufioReader(fmt.Sprintf("%s-One: 1\nTwo: 2\n%s-Three: 3\n\n",
 				cacher.CustomHeaderPrefix, cacher.CustomHeaderPrefix))
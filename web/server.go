@@ -21,6 +21,7 @@ type server struct {
 	cacher cacher.Cacher
 	logger *logrus.Logger
 
+	maxStale      time.Duration
 	onServerIssue *func(*ServerIssue)
 
 	mutex     sync.Mutex
@@ -61,6 +62,26 @@ func (s *server) GetCacher() cacher.Cacher {
 	return s.cacher
 }
 
+func (s *server) SetMaxStale(maxStale time.Duration) {
+	s.mutex.Lock()
+	old := s.maxStale
+	s.maxStale = maxStale
+	s.mutex.Unlock()
+
+	s.logger.WithFields(logrus.Fields{
+		"old": old,
+		"new": maxStale,
+	}).Info("Updated server max stale")
+}
+
+func (s *server) GetMaxStale() time.Duration {
+	s.mutex.Lock()
+	maxStale := s.maxStale
+	s.mutex.Unlock()
+
+	return maxStale
+}
+
 func (s *server) SetOnServerIssue(f func(*ServerIssue)) {
 	s.onServerIssue = &f
 }
@@ -253,6 +274,14 @@ func (s *server) serveURL(url *url.URL, si internal.ServeInfo, req *http.Request
 	}
 	defer func() { _ = cache.Close() }()
 
+	if s.checkTooStale(url) {
+		return s.serveServerIssue(&ServerIssue{
+			Type: CacheTooStale,
+			URL:  url,
+			Info: si,
+		})
+	}
+
 	ServeHTTPCache(cache, si)
 	if si.HasError() {
 		return s.serveServerIssue(&ServerIssue{
@@ -277,6 +306,34 @@ func (s *server) serveURL(url *url.URL, si internal.ServeInfo, req *http.Request
 	return si.Flush()
 }
 
+// checkTooStale returns true if the cache has expired for longer than the max stale duration,
+// it must be checked before any cached data is served.
+// Expiry is measured from the last successful fetch because the expires header is bumped on every refresh.
+func (s *server) checkTooStale(url *url.URL) bool {
+	maxStale := s.GetMaxStale()
+	if maxStale == 0 {
+		return false
+	}
+
+	info, err := s.cacher.GetInfo(url)
+	if err != nil {
+		return false
+	}
+
+	expires := info.Expires
+	if info.Fetched != nil {
+		expires = cacher.GetExpires(info.Header, 0, *info.Fetched)
+		if expires == nil {
+			expires = info.Fetched
+		}
+	}
+	if expires == nil {
+		return false
+	}
+
+	return time.Since(*expires) > maxStale
+}
+
 func (s *server) serveRobotsTxt(si internal.ServeInfo) internal.ServeInfo {
 	si.SetStatusCode(http.StatusOK)
 	si.WriteBody([]byte("User-agent: *\nDisallow: /\n"))
@@ -328,6 +328,99 @@ var _ = Describe("Server", func() {
 				Expect(cacheExpiredIssue).ToNot(BeNil())
 			})
 
+			Describe("SetMaxStale", func() {
+				var writeExpiredCache = func(urlPath string, expired time.Duration) *url.URL {
+					url, _ := url.Parse("https://domain.com" + urlPath)
+					cachePath := cacher.GenerateHTTPCachePath(rootPath, url)
+					cacheDir, _ := path.Split(cachePath)
+					_ = fs.MkdirAll(cacheDir, 0777)
+					f, _ := t.FsCreate(fs, cachePath)
+					_, _ = f.Write([]byte(fmt.Sprintf(
+						"HTTP 200\n%s: %d\nContent-Length: 3\n\nfoo",
+						cacher.CustomHeaderExpires,
+						time.Now().Add(-expired).UnixNano(),
+					)))
+					_ = f.Close()
+
+					return url
+				}
+
+				It("should trigger func on cache too stale", func() {
+					urlPath := "/SetOnServerIssue/cache/too/stale"
+					url := writeExpiredCache(urlPath, time.Hour)
+
+					s := newServer()
+					s.SetMaxStale(time.Minute)
+					Expect(s.GetMaxStale()).To(Equal(time.Minute))
+					w := httptest.NewRecorder()
+					req := httptest.NewRequest("", urlPath, nil)
+
+					var issueTypes []interface{}
+					s.SetOnServerIssue(func(issue *ServerIssue) {
+						issueTypes = append(issueTypes, issue.Type)
+						issue.Info.SetStatusCode(http.StatusAccepted)
+					})
+
+					s.Serve(url, w, req)
+
+					Expect(issueTypes).To(Equal([]interface{}{CacheTooStale}))
+					Expect(w.Code).To(Equal(http.StatusAccepted))
+					Expect(w.Body.String()).To(BeEmpty())
+				})
+
+				It("should trigger func on bumped cache fetched long ago", func() {
+					urlPath := "/SetOnServerIssue/cache/too/stale/bumped"
+					url, _ := url.Parse("https://domain.com" + urlPath)
+					cachePath := cacher.GenerateHTTPCachePath(rootPath, url)
+					cacheDir, _ := path.Split(cachePath)
+					_ = fs.MkdirAll(cacheDir, 0777)
+					f, _ := t.FsCreate(fs, cachePath)
+					_, _ = f.Write([]byte(fmt.Sprintf(
+						"HTTP 200\n%s: %d\n%s: %d\nContent-Length: 3\n\nfoo",
+						cacher.CustomHeaderFetched,
+						time.Now().Add(-time.Hour).UnixNano(),
+						cacher.CustomHeaderExpires,
+						time.Now().Add(time.Minute).UnixNano(),
+					)))
+					_ = f.Close()
+
+					s := newServer()
+					s.SetMaxStale(time.Minute)
+					w := httptest.NewRecorder()
+					req := httptest.NewRequest("", urlPath, nil)
+
+					var issueTypes []interface{}
+					s.SetOnServerIssue(func(issue *ServerIssue) {
+						issueTypes = append(issueTypes, issue.Type)
+					})
+
+					s.Serve(url, w, req)
+
+					Expect(issueTypes).To(Equal([]interface{}{CacheTooStale}))
+				})
+
+				It("should serve stale cache within max stale", func() {
+					urlPath := "/SetOnServerIssue/cache/stale"
+					url := writeExpiredCache(urlPath, time.Minute)
+
+					s := newServer()
+					s.SetMaxStale(time.Hour)
+					w := httptest.NewRecorder()
+					req := httptest.NewRequest("", urlPath, nil)
+
+					var issueTypes []interface{}
+					s.SetOnServerIssue(func(issue *ServerIssue) {
+						issueTypes = append(issueTypes, issue.Type)
+					})
+
+					s.Serve(url, w, req)
+
+					Expect(issueTypes).To(Equal([]interface{}{CacheExpired}))
+					Expect(w.Body.String()).To(Equal("foo"))
+					Expect(w.Header().Get(cacher.HeaderWarning)).To(Equal(WarningResponseIsStale))
+				})
+			})
+
 			It("should trigger func on cross host invalid path", func() {
 				s := newServer()
 				w := httptest.NewRecorder()